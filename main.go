@@ -22,13 +22,48 @@ Oh is released under an MIT-style license.
 package main
 
 import (
+	"flag"
 	"github.com/michaelmacinnis/oh/pkg/parser"
 	"github.com/michaelmacinnis/oh/pkg/task"
 	"github.com/michaelmacinnis/oh/pkg/ui"
 	"os"
 )
 
+var deterministic = flag.Bool("deterministic", false,
+	"seed random numbers and freeze the clock for reproducible output")
+
+func init() {
+	flag.StringVar(&task.BundleOutput, "bundle", "",
+		"write a binary that runs the script to the named file")
+	flag.StringVar(&task.CommandString, "c", "",
+		"evaluate the command string instead of a script")
+	flag.StringVar(&task.Control, "control", "",
+		"serve JSON requests on the named socket, or - for stdin")
+	flag.BoolVar(&task.FormatOnly, "fmt", false,
+		"write the script, formatted, instead of evaluating it")
+	flag.BoolVar(&task.Login, "login", false,
+		"source ~/.oh_profile, as a login shell")
+	flag.BoolVar(&task.NoProfile, "noprofile", false,
+		"do not source ~/.oh_profile")
+	flag.BoolVar(&task.NoRC, "norc", false,
+		"do not source /etc/oh/ohrc or ~/.ohrc")
+	flag.BoolVar(&task.ParseOnly, "n", false,
+		"check syntax without evaluating commands")
+}
+
 func main() {
+	/* A bundle runs its script with all of its arguments. */
+	if script := task.LoadBundle(); script != "" {
+		os.Args = append([]string{os.Args[0], script}, os.Args[1:]...)
+	} else {
+		flag.Parse()
+		os.Args = append(os.Args[:1], flag.Args()...)
+	}
+
+	if *deterministic {
+		task.Deterministic()
+	}
+
 	task.Start(parser.Parse, ui.New(os.Args))
 }
 
@@ -9,15 +9,18 @@ define $connect: syntax (conduit name) as {
 	set conduit: eval conduit
 	syntax e (left right) as {
 		define p: conduit
-		spawn {
+		block {
 			eval: quasiquote: dynamic (unquote name) p
-			e::eval left
-			p::writer-close
+			spawn {
+				e::eval left
+			}
 		}
+		p::writer-close
 		block {
 			dynamic $stdin = p
-			e::eval right
-			p::reader-close
+			unwind-protect (e::eval right) {
+				p::reader-close
+			}
 		}
 	}
 }
@@ -27,11 +30,13 @@ define $redirect: syntax (name mode closer) as {
 		define f = ()
 		if (not: or (is-channel c) (is-pipe c)) {
 			set f: open mode c
+			if (is-error f): f::raise
 			set c = f
 		}
 		eval: quasiquote: dynamic (unquote name) c
-		e::eval cmd
-		if (not: is-null f): eval: quasiquote: f::(unquote closer)
+		unwind-protect (e::eval cmd) {
+			if (not: is-null f): eval: quasiquote: f::(unquote closer)
+		}
 	}
 }
 define ...: method (: args) as {
@@ -48,25 +53,17 @@ define ...: method (: args) as {
 		cd ..
 	}
 }
-define and: syntax e (: lst) as {
-	define r = false
-	while (not: is-null: car lst) {
-		set r: e::eval: car lst
-		if (not r): return r
-		set lst: cdr lst
-	}
-	return r
-}
 define append-stderr: $redirect $stderr "a" writer-close
 define append-stdout: $redirect $stdout "a" writer-close
-define apply: method (f: args) as: f @args
 define backtick: syntax e (cmd) as {
 	define p: pipe
-	spawn {
+	block {
 		dynamic $stdout = p
-		e::eval cmd
-		p::writer-close
+		spawn {
+			e::eval cmd
+		}
 	}
+	p::writer-close
 	define r: cons () ()
 	define c = r
 	while (define l: p::readline) {
@@ -104,8 +101,45 @@ define cddaar: method (l) as: cddr: caar l
 define cddadr: method (l) as: cddr: cadr l
 define cdddar: method (l) as: cddr: cdar l
 define cddddr: method (l) as: cddr: cddr l
+define capture: syntax e (cmd --lines) as {
+	define p: pipe
+	block {
+		dynamic $stdout = p
+		spawn {
+			e::eval cmd
+		}
+	}
+	p::writer-close
+	define l: p::read-lines
+	p::reader-close
+	define i = 0
+	define n = 0
+	for line in l {
+		set i: add i 1
+		if (ne "" line): set n = i
+	}
+	set l: take n l
+	if lines: return l
+	return: "\n"::join @l
+}
 define channel-stderr: $connect channel $stderr
 define channel-stdout: $connect channel $stdout
+define define-syntax: syntax e (name transformer) as {
+	define expand: e::eval transformer
+	e::eval: list (quote define) name: syntax c (: args) as {
+		if (is-syntax expand) {
+			c::eval: c::eval: cons expand args
+		} else {
+			c::eval: apply expand args
+		}
+	}
+}
+define dynamic-wind: method (before thunk after) as {
+	before
+	unwind-protect (thunk) {
+		after
+	}
+}
 define echo: builtin (: args) as {
 	if (is-null args) {
 		$stdout::write: symbol ""
@@ -114,15 +148,14 @@ define echo: builtin (: args) as {
 	}
 }
 define error: builtin (: args) as: $stderr::write @args
-define for: method (l m) as {
-	define r: cons () ()
-	define c = r
-	while (not: is-null l) {
-		set-cdr c: cons (m: car l) ()
-		set c: cdr c
-		set l: cdr l
+define generator: method (body) as {
+	define c: channel
+	spawn {
+		unwind-protect (body: method (: args) as: c::write @args) {
+			c::writer-close
+		}
 	}
-	return: cdr r
+	return c
 }
 define glob: builtin (: args) as: return args
 define import: syntax e (name) as {
@@ -154,22 +187,25 @@ define list-tail: method (k x) as {
 define object: syntax e (: body) as {
 	e::eval: cons (quote block): append body (quote: context)
 }
-define or: syntax e (: lst) as {
-	define r = false
-	while (not: is-null: car lst) {
-		set r: e::eval: car lst
-		if r: return r
-		set lst: cdr lst 
-	}
-	return r
+define partial: method (f: rest) as {
+	return: method (: args) as: f @rest @args
 }
 define pipe-stderr: $connect pipe $stderr
 define pipe-stdout: $connect pipe $stdout
+define pp: method (value: args) as: echo: pretty value @args
 define printf: method (f: args) as: echo: f::sprintf @args
 define quasiquote: syntax e (cell) as {
 	if (not: is-cons cell): return cell
 	if (is-null cell): return cell
 	if (eq (quote unquote): car cell): return: e::eval: cadr cell
+	define head: car cell
+	if (and (is-cons head) (not: is-null head) \
+	        (eq (quote unquote-splicing): car head)) {
+		define l: e::eval: cadr head
+		define r: e::eval: list (quote quasiquote): cdr cell
+		if (is-null l): return r
+		return: append l @r
+	}
 	cons {
 		e::eval: list (quote quasiquote): car cell
 		e::eval: list (quote quasiquote): cdr cell
@@ -194,23 +230,17 @@ define source: syntax e (name) as {
 
 	if (not: exists name): set name = basename
 
-        define r: cons () ()
-        define c = r
-	define f: open r- name
-	while (define l: f::read) {
-		set-cdr c: cons l ()
-		set c: cdr c
-	}
-	set c: cdr r
-	f::close
-	define eval-list: syntax o (rval first rest) as {
+	define c: read-commands name
+	define eval-list: syntax o (prev rval first rest) as {
+                set prev: o::eval prev
                 set rval: o::eval rval
                 set first: o::eval first
                 set rest: o::eval rest
 		if (is-null first): return rval
-		eval-list (e::eval first) (car rest) (cdr rest)
+		$options::check prev rval
+		eval-list first (e::eval first) (car rest) (cdr rest)
 	}
-	eval-list (status 0) (car c) (cdr c)
+	eval-list () (status 0) (car c) (cdr c)
 }
 define process-substitution: syntax e (:args) as {
 	define fifos = ()
@@ -241,10 +271,11 @@ define process-substitution: syntax e (:args) as {
 	wait @procs
 	rm @fifos
 }
+define with-host: syntax e (host: body) as {
+	define d: list (quote dynamic) (quote $remote) (e::eval host)
+	e::eval: cons (quote block): cons d body
+}
 define write: method (: args) as: $stdout::write @args
-
-exists ("/"::join $HOME .ohrc) && source ("/"::join $HOME .ohrc)
-
 `
 
 //go:generate ./generate.oh
@@ -2,6 +2,11 @@
 
 package cell
 
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
 func AppendTo(list Cell, elements ...Cell) Cell {
 	var pair, prev, start Cell
 
@@ -38,6 +43,15 @@ func Car(c Cell) Cell {
 	return c.(*Pair).car
 }
 
+/*
+ * Compiled returns the instruction cached on the pair c by SetCompiled,
+ * or nil. Code may be shared by concurrent tasks so the cache is read and
+ * written atomically.
+ */
+func Compiled(c Cell) *Instruction {
+	return (*Instruction)(atomic.LoadPointer(&c.(*Pair).code))
+}
+
 func Cdr(c Cell) Cell {
 	return c.(*Pair).cdr
 }
@@ -148,9 +162,17 @@ func Reverse(list Cell) Cell {
 }
 
 func SetCar(c, value Cell) {
-	c.(*Pair).car = value
+	p := c.(*Pair)
+	p.car = value
+	p.uncompile()
 }
 
 func SetCdr(c, value Cell) {
-	c.(*Pair).cdr = value
+	p := c.(*Pair)
+	p.cdr = value
+	p.uncompile()
+}
+
+func SetCompiled(c Cell, i *Instruction) {
+	atomic.StorePointer(&c.(*Pair).code, unsafe.Pointer(i))
 }
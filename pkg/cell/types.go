@@ -4,8 +4,12 @@ package cell
 
 import (
 	"fmt"
+	"math"
 	"math/big"
 	"strconv"
+	"sync"
+	"sync/atomic"
+	"unsafe"
 )
 
 type Atom interface {
@@ -23,6 +27,16 @@ type Cell interface {
 	String() string
 }
 
+/*
+ * An Instruction records how the element held in a pair is evaluated, so
+ * that it is decided once rather than each time the pair is visited. The
+ * instructions for a list are allocated together and each pair caches its
+ * own. A pair's instruction is dropped when its car or cdr is changed.
+ */
+type Instruction struct {
+	Op int64
+}
+
 type Number interface {
 	Atom
 
@@ -57,6 +71,9 @@ var (
 	res [256]*Status
 	sym = map[string]*Symbol{}
 	zip *big.Rat
+
+	/* Symbols may be created by concurrent tasks. */
+	symlock sync.RWMutex
 )
 
 func init() {
@@ -68,6 +85,24 @@ func init() {
 	rat[257] = Rational{one}
 	rat[256] = Rational{zip}
 
+	/*
+	 * Small numbers are created up front so that the caches are only
+	 * read, and can be shared by concurrent tasks without locking.
+	 */
+	for i := range num {
+		n := Integer(i - 256)
+		num[i] = &n
+
+		if rat[i].v == nil {
+			rat[i] = Rational{big.NewRat(int64(i-256), 1)}
+		}
+	}
+
+	for i := range res {
+		s := Status(i)
+		res[i] = &s
+	}
+
 	pair := new(Pair)
 	pair.car = pair
 	pair.cdr = pair
@@ -83,8 +118,83 @@ func init() {
 
 func CacheSymbols(symbols ...string) {
 	for _, v := range symbols {
-		sym[v] = NewSymbol(v)
+		p := NewSymbol(v)
+
+		symlock.Lock()
+		sym[v] = p
+		symlock.Unlock()
+	}
+}
+
+/*
+ * Arithmetic promotes its operands as needed. If either operand is a
+ * float, the result is a float. Otherwise the result is exact: an integer,
+ * if both operands are integers (or statuses) and the result is a whole
+ * number that fits in 64 bits, or else a rational. As rationals have
+ * arbitrary precision, integer arithmetic never overflows.
+ */
+type operation struct {
+	exact   func(z, x, y *big.Rat) *big.Rat
+	inexact func(x, y float64) float64
+}
+
+var (
+	difference = operation{(*big.Rat).Sub, func(x, y float64) float64 {
+		return x - y
+	}}
+	product = operation{(*big.Rat).Mul, func(x, y float64) float64 {
+		return x * y
+	}}
+	quotient = operation{(*big.Rat).Quo, func(x, y float64) float64 {
+		if y == 0 {
+			panic("division by zero")
+		}
+		return x / y
+	}}
+	remainder = operation{func(z, x, y *big.Rat) *big.Rat {
+		return ratmod(x, y)
+	}, func(x, y float64) float64 {
+		if y == 0 {
+			panic("division by zero")
+		}
+		return math.Mod(x, y)
+	}}
+	sum = operation{(*big.Rat).Add, func(x, y float64) float64 {
+		return x + y
+	}}
+)
+
+func arithmetic(a Atom, c Cell, op operation) Number {
+	b := c.(Atom)
+	if IsFloat(a) || IsFloat(b) {
+		return NewFloat(op.inexact(inexact(a), inexact(b)))
+	}
+
+	r := op.exact(new(big.Rat), a.Rat(), b.Rat())
+	if integral(a) && integral(b) && r.IsInt() && r.Num().IsInt64() {
+		return NewInteger(r.Num().Int64())
+	}
+
+	return NewRational(r)
+}
+
+/* Return the value of a as a float. */
+func inexact(a Atom) float64 {
+	if f, ok := a.(*Float); ok {
+		return float64(*f)
+	}
+
+	f, _ := a.Rat().Float64()
+	return f
+}
+
+/* Is a an integer, rather than a number that may have a fraction? */
+func integral(a Atom) bool {
+	switch a.(type) {
+	case *Integer, *Status:
+		return true
 	}
+	return false
 }
 
 func ratmod(x, y *big.Rat) *big.Rat {
@@ -167,13 +277,17 @@ type Constant struct {
 }
 
 func NewConstant(v Cell) *Constant {
-	return &Constant{Variable{v}}
+	return &Constant{Variable{v: v}}
 }
 
 func (ct *Constant) String() string {
 	return fmt.Sprintf("%%ct %p%%", ct)
 }
 
+func (ct *Constant) Copy() Reference {
+	return NewConstant(ct.Get())
+}
+
 func (ct *Constant) Set(c Cell) {
 	panic("constant cannot be set")
 }
@@ -215,6 +329,9 @@ func (f *Float) Float() float64 {
 }
 
 func (f *Float) Int() int64 {
+	if *f < math.MinInt64 || *f >= math.MaxInt64 || *f != *f {
+		panic("integer overflow")
+	}
 	return int64(*f)
 }
 
@@ -235,23 +352,23 @@ func (f *Float) Less(c Cell) bool {
 }
 
 func (f *Float) Add(c Cell) Number {
-	return NewRational(new(big.Rat).Add(f.Rat(), c.(Atom).Rat()))
+	return arithmetic(f, c, sum)
 }
 
 func (f *Float) Divide(c Cell) Number {
-	return NewRational(new(big.Rat).Quo(f.Rat(), c.(Atom).Rat()))
+	return arithmetic(f, c, quotient)
 }
 
 func (f *Float) Modulo(c Cell) Number {
-	return NewRational(ratmod(f.Rat(), c.(Atom).Rat()))
+	return arithmetic(f, c, remainder)
 }
 
 func (f *Float) Multiply(c Cell) Number {
-	return NewRational(new(big.Rat).Mul(f.Rat(), c.(Atom).Rat()))
+	return arithmetic(f, c, product)
 }
 
 func (f *Float) Subtract(c Cell) Number {
-	return NewRational(new(big.Rat).Sub(f.Rat(), c.(Atom).Rat()))
+	return arithmetic(f, c, difference)
 }
 
 /* Integer cell definition. */
@@ -268,17 +385,7 @@ func IsInteger(c Cell) bool {
 
 func NewInteger(v int64) *Integer {
 	if -256 <= v && v <= 255 {
-		n := v + 256
-		p := num[n]
-
-		if p == nil {
-			i := Integer(v)
-			p = &i
-
-			num[n] = p
-		}
-
-		return p
+		return num[v+256]
 	}
 
 	i := Integer(v)
@@ -325,30 +432,31 @@ func (i *Integer) Less(c Cell) bool {
 }
 
 func (i *Integer) Add(c Cell) Number {
-	return NewRational(new(big.Rat).Add(i.Rat(), c.(Atom).Rat()))
+	return arithmetic(i, c, sum)
 }
 
 func (i *Integer) Divide(c Cell) Number {
-	return NewRational(new(big.Rat).Quo(i.Rat(), c.(Atom).Rat()))
+	return arithmetic(i, c, quotient)
 }
 
 func (i *Integer) Modulo(c Cell) Number {
-	return NewRational(ratmod(i.Rat(), c.(Atom).Rat()))
+	return arithmetic(i, c, remainder)
 }
 
 func (i *Integer) Multiply(c Cell) Number {
-	return NewRational(new(big.Rat).Mul(i.Rat(), c.(Atom).Rat()))
+	return arithmetic(i, c, product)
 }
 
 func (i *Integer) Subtract(c Cell) Number {
-	return NewRational(new(big.Rat).Sub(i.Rat(), c.(Atom).Rat()))
+	return arithmetic(i, c, difference)
 }
 
 /* Pair cell definition. */
 
 type Pair struct {
-	car Cell
-	cdr Cell
+	car  Cell
+	cdr  Cell
+	code unsafe.Pointer
 }
 
 func IsCons(c Cell) bool {
@@ -368,8 +476,8 @@ func (p *Pair) Bool() bool {
 }
 
 func (p *Pair) Equal(c Cell) bool {
-	if p == Null && c == Null {
-		return true
+	if p == Null || c == Null || !IsCons(c) {
+		return p == c
 	}
 	return p.car.Equal(Car(c)) && p.cdr.Equal(Cdr(c))
 }
@@ -404,6 +512,14 @@ func (p *Pair) String() (s string) {
 	return s
 }
 
+/* Pair-specific functions. */
+
+func (p *Pair) uncompile() {
+	if atomic.LoadPointer(&p.code) != nil {
+		atomic.StorePointer(&p.code, nil)
+	}
+}
+
 /* Rational cell definition. */
 
 type Rational struct {
@@ -423,16 +539,7 @@ func NewRational(r *big.Rat) Rational {
 		return Rational{r}
 	}
 
-	n := r.Num().Int64()
-	i := n + 256
-	p := rat[i]
-
-	if p.v == nil {
-		p = Rational{r}
-		rat[i] = p
-	}
-
-	return p
+	return rat[r.Num().Int64()+256]
 }
 
 func (r Rational) Bool() bool {
@@ -458,7 +565,11 @@ func (r Rational) Float() float64 {
 func (r Rational) Int() int64 {
 	n := r.v.Num()
 	d := r.v.Denom()
-	return new(big.Int).Div(n, d).Int64()
+	i := new(big.Int).Quo(n, d)
+	if !i.IsInt64() {
+		panic("integer overflow")
+	}
+	return i.Int64()
 }
 
 func (r Rational) Rat() *big.Rat {
@@ -478,23 +589,23 @@ func (r Rational) Less(c Cell) bool {
 }
 
 func (r Rational) Add(c Cell) Number {
-	return NewRational(new(big.Rat).Add(r.v, c.(Atom).Rat()))
+	return arithmetic(r, c, sum)
 }
 
 func (r Rational) Divide(c Cell) Number {
-	return NewRational(new(big.Rat).Quo(r.v, c.(Atom).Rat()))
+	return arithmetic(r, c, quotient)
 }
 
 func (r Rational) Modulo(c Cell) Number {
-	return NewRational(ratmod(r.v, c.(Atom).Rat()))
+	return arithmetic(r, c, remainder)
 }
 
 func (r Rational) Multiply(c Cell) Number {
-	return NewRational(new(big.Rat).Mul(r.v, c.(Atom).Rat()))
+	return arithmetic(r, c, product)
 }
 
 func (r Rational) Subtract(c Cell) Number {
-	return NewRational(new(big.Rat).Sub(r.v, c.(Atom).Rat()))
+	return arithmetic(r, c, difference)
 }
 
 /* Status cell definition. */
@@ -511,16 +622,7 @@ func IsStatus(c Cell) bool {
 
 func NewStatus(v int64) *Status {
 	if 0 <= v && v <= 255 {
-		p := res[v]
-
-		if p == nil {
-			s := Status(v)
-			p = &s
-
-			res[v] = p
-		}
-
-		return p
+		return res[v]
 	}
 
 	s := Status(v)
@@ -567,23 +669,23 @@ func (s *Status) Less(c Cell) bool {
 }
 
 func (s *Status) Add(c Cell) Number {
-	return NewRational(new(big.Rat).Add(s.Rat(), c.(Atom).Rat()))
+	return arithmetic(s, c, sum)
 }
 
 func (s *Status) Divide(c Cell) Number {
-	return NewRational(new(big.Rat).Quo(s.Rat(), c.(Atom).Rat()))
+	return arithmetic(s, c, quotient)
 }
 
 func (s *Status) Modulo(c Cell) Number {
-	return NewRational(ratmod(s.Rat(), c.(Atom).Rat()))
+	return arithmetic(s, c, remainder)
 }
 
 func (s *Status) Multiply(c Cell) Number {
-	return NewRational(new(big.Rat).Mul(s.Rat(), c.(Atom).Rat()))
+	return arithmetic(s, c, product)
 }
 
 func (s *Status) Subtract(c Cell) Number {
-	return NewRational(new(big.Rat).Sub(s.Rat(), c.(Atom).Rat()))
+	return arithmetic(s, c, difference)
 }
 
 /* Symbol cell definition. */
@@ -599,7 +701,9 @@ func IsSymbol(c Cell) bool {
 }
 
 func NewSymbol(v string) *Symbol {
+	symlock.RLock()
 	p, ok := sym[v]
+	symlock.RUnlock()
 
 	if ok {
 		return p
@@ -609,7 +713,9 @@ func NewSymbol(v string) *Symbol {
 	p = &s
 
 	if len(v) <= 3 {
+		symlock.Lock()
 		sym[v] = p
+		symlock.Unlock()
 	}
 
 	return p
@@ -624,6 +730,10 @@ func (s *Symbol) Bool() bool {
 }
 
 func (s *Symbol) Equal(c Cell) bool {
+	/* A string's text is compared, rather than its quoted form. */
+	if r, ok := c.(interface{ Raw() string }); ok {
+		return string(*s) == r.Raw()
+	}
 	if a, ok := c.(Atom); ok {
 		return string(*s) == a.String()
 	}
@@ -671,23 +781,23 @@ func (s *Symbol) Less(c Cell) bool {
 }
 
 func (s *Symbol) Add(c Cell) Number {
-	return NewRational(new(big.Rat).Add(s.Rat(), c.(Atom).Rat()))
+	return arithmetic(s, c, sum)
 }
 
 func (s *Symbol) Divide(c Cell) Number {
-	return NewRational(new(big.Rat).Quo(s.Rat(), c.(Atom).Rat()))
+	return arithmetic(s, c, quotient)
 }
 
 func (s *Symbol) Modulo(c Cell) Number {
-	return NewRational(ratmod(s.Rat(), c.(Atom).Rat()))
+	return arithmetic(s, c, remainder)
 }
 
 func (s *Symbol) Multiply(c Cell) Number {
-	return NewRational(new(big.Rat).Mul(s.Rat(), c.(Atom).Rat()))
+	return arithmetic(s, c, product)
 }
 
 func (s *Symbol) Subtract(c Cell) Number {
-	return NewRational(new(big.Rat).Sub(s.Rat(), c.(Atom).Rat()))
+	return arithmetic(s, c, difference)
 }
 
 /* Symbol-specific functions. */
@@ -700,12 +810,14 @@ func (s *Symbol) isNumeric() bool {
 
 /* Variable cell definition. */
 
+/* A variable can be shared by concurrent tasks. */
 type Variable struct {
+	sync.RWMutex
 	v Cell
 }
 
 func NewVariable(v Cell) Reference {
-	return &Variable{v}
+	return &Variable{v: v}
 }
 
 func (vr *Variable) Bool() bool {
@@ -713,7 +825,7 @@ func (vr *Variable) Bool() bool {
 }
 
 func (vr *Variable) Equal(c Cell) bool {
-	return vr.v.Equal(c)
+	return vr.Get().Equal(c)
 }
 
 func (vr *Variable) String() string {
@@ -723,13 +835,19 @@ func (vr *Variable) String() string {
 /* Variable-specific functions */
 
 func (vr *Variable) Copy() Reference {
-	return NewVariable(vr.v)
+	return NewVariable(vr.Get())
 }
 
 func (vr *Variable) Get() Cell {
+	vr.RLock()
+	defer vr.RUnlock()
+
 	return vr.v
 }
 
 func (vr *Variable) Set(c Cell) {
+	vr.Lock()
+	defer vr.Unlock()
+
 	vr.v = c
 }
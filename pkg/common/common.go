@@ -2,6 +2,27 @@
 
 package common
 
+/*
+ * A LineEditor reads interactive input. The task package only depends on
+ * this interface so that editors other than liner can be plugged in.
+ */
+type LineEditor interface {
+	ReadStringer
+
+	AppendHistory(item string)
+	Close() error
+	Exists() bool
+	SetCompleter(f func(line string, pos int) (string, []string, string))
+	SetPrompt(prompt string)
+	SetRightPrompt(prompt string)
+	TerminalMode() (TerminalMode, error)
+}
+
 type ReadStringer interface {
 	ReadString(delim byte) (line string, err error)
 }
+
+/* A TerminalMode restores the terminal to a previously saved mode. */
+type TerminalMode interface {
+	ApplyMode() error
+}
@@ -3,36 +3,66 @@
 package common
 
 var Symbols = []string{
-	"...", "abs", "add", "and", "append", "append-stderr",
-	"append-stdout", "apply", "arg", "args", "$args", "backtick",
-	"basename", "block", "body", "boolean", "builtin", "caaaar",
-	"caaadr", "caaar", "caadar", "caaddr", "caadr", "caar", "cadaar",
-	"cadadr", "cadar", "caddar", "cadddr", "caddr", "cadr", "car",
-	"cdaaar", "cdaadr", "cdaar", "cdadar", "cdaddr", "cdadr",
-	"cdar", "cddaar", "cddadr", "cddar", "cdddar", "cddddr", "cdddr",
-	"cddr", "cdr", "cell", "channel", "channel-stderr", "channel-stdout",
-	"child", "clone", "close", "closer", "cmd", "conduit", "$connect",
-	"cons", "context", "$cwd", "debug", "define", "div", "dynamic",
-	"echo", "else", "entry", "error", "eval", "eval-list", "exists",
-	"exit", "false", "fifo", "fifos", "first", "float", "for",
-	"get-slot", "glob", "handler", "handlers", "$handlers", "has",
-	"$HOME", "import", "integer", "interpolate", "is-atom", "is-boolean",
-	"is-builtin", "is-channel", "is-cons", "is-continuation", "is-float",
+	"...", "$_", "$__", "$___", "abs", "acquire", "add", "after", "and",
+	"append", "append-stderr", "append-stdout", "arg", "argparse", "args",
+	"$args", "assert-equal", "assert-status", "$assume-yes", "$autoload",
+	"autoload", "backtick", "band", "basename", "before", "block", "bnot",
+	"body", "boolean", "bor", "break", "buffer", "builtin", "bxor",
+	"caaaar", "caaadr", "caaar", "caadar", "caaddr", "caadr", "caar",
+	"cadaar", "cadadr", "cadar", "caddar", "cadddr", "caddr", "cadr",
+	"calls", "cancel", "capture", "car", "cbor-decode", "cbor-encode",
+	"cdaaar", "cdaadr", "cdaar", "cdadar", "cdaddr", "cdadr", "cdar",
+	"cddaar", "cddadr", "cddar", "cdddar", "cddddr", "cdddr", "cddr",
+	"cdr", "ceil", "cell", "channel", "channel-stderr", "channel-stdout",
+	"check", "checksum-file", "child", "choose", "choose-many", "clone",
+	"close", "closer", "cmd", "cond", "conduit", "confirm", "conforms?",
+	"$connect", "cons", "context", "continue", "correct", "cos",
+	"cpu-count", "$cwd", "debug", "decode", "define", "define-constant",
+	"define-record", "define-syntax", "$describe", "describe", "dial",
+	"diff-cells", "diff-lines", "disk-usage", "$display", "display-width",
+	"div", "done?", "dynamic", "dynamic-wind", "echo", "else", "encode",
+	"entry", "eq?", "equal?", "errexit", "error", "eval", "eval-list",
+	"exists", "exit", "exp", "expand", "false", "fifo", "fifos", "first",
+	"$flags", "float", "floor", "for", "format-bytes", "format-duration",
+	"format-number", "format-source", "generator", "get-slot", "glob",
+	"graphemes", "handler", "handlers", "$handlers", "has", "hash",
+	"hashed", "head", "$HOME", "hostname", "$ifs", "import", "in", "info",
+	"integer", "interpolate", "is-atom", "is-boolean", "is-builtin",
+	"is-channel", "is-cons", "is-continuation", "is-error", "is-float",
 	"is-integer", "is-list", "is-method", "is-null", "is-number",
-	"is-object", "is-pipe", "is-rational", "is-status", "is-string",
-	"is-symbol", "is-syntax", "is-text", "jobs", "join", "left",
-	"length", "list", "list-ref", "list-tail", "list-to-string",
-	"list-to-symbol", "lst", "make-env", "make-scope", "match", "method",
-	"mod", "mode", "module", "msg", "mul", "name", "not", "object",
-	"$OHPATH", "open", "$origin", "$PATH", "path", "paths", "pattern",
-	"pipe", "pipe-stderr", "pipe-stdout", "$platform", "printf", "proc",
-	"process-substitution", "procs", "public", "quasiquote", "quote",
-	"rational", "read", "reader-close", "readline", "$redirect",
-	"redirect-stderr", "redirect-stdin", "redirect-stdout", "rest",
-	"return", "reverse", "right", "$root", "run", "rval", "set",
-	"set-car", "set-cdr", "setenv", "set-slot", "source", "spawn",
-	"splice", "split", "sprintf", "status", "$stderr", "$stdin",
-	"$stdout", "strict", "string", "sub", "symbol", "syntax",
-	"temp-fifo", "true", "unquote", "unset", "$USER", "wait",
-	"while", "write", "writer-close",
+	"is-object", "is-pipe", "is-rational", "is-secret", "is-status",
+	"is-string", "is-symbol", "is-syntax", "is-text", "isatty", "it",
+	"$job-count", "jobs", "join", "journal", "kill", "$last-duration",
+	"left", "length", "let", "letrec", "list", "list-ref", "list-tail",
+	"list-to-string", "list-to-symbol", "listen", "local", "lock", "log",
+	"$log-format", "$log-level", "$log-sink", "lst", "make-env",
+	"make-scope", "match", "math", "memory-info", "method", "mixin",
+	"mkfifo", "mock-command", "$mocks", "mod", "mode", "module", "mounts",
+	"msg", "msgpack-decode", "msgpack-encode", "mul", "mutex", "name",
+	"normalize", "not", "now", "numbers", "object", "$OHPATH", "open",
+	"$options", "$origin", "os-release", "parse-bytes", "parse-duration",
+	"parse-number", "parse-string", "partial", "$PATH", "path", "paths",
+	"pattern", "pi", "pidof", "pipe", "pipe-stderr", "pipe-stdout",
+	"$platform", "pmap", "pow", "pp", "pretty", "printf", "$priority",
+	"proc", "process-exists?", "process-list", "process-substitution",
+	"procs", "$PROMPT", "public", "public-slots", "quasiquote", "quote",
+	"random", "range", "rational", "reachable?", "read", "read-all",
+	"read-commands", "read-from-string", "read-lines", "read-secret",
+	"reader-close", "readline", "readonly", "$redirect", "redirect-stderr",
+	"redirect-stdin", "redirect-stdout", "rehash", "release", "$resize",
+	"responds-to?", "rest", "restrict", "result", "return", "reveal",
+	"reverse", "right", "$rlimits", "$root", "round", "$RPROMPT", "run",
+	"run-tests", "rval", "$sandbox", "secret", "semaphore", "set",
+	"set-car", "set-cdr", "set-clock", "setenv", "set-slot", "shl", "shr",
+	"$signals", "sin", "slice", "slots", "source", "spawn", "splice",
+	"split", "split-words", "sprintf", "sqlite-open", "sqrt", "status",
+	"$stderr", "$stdin", "$stdout", "store-open", "string", "strip-ansi",
+	"style", "sub", "super", "symbol", "syntax", "syslog", "tan",
+	"tcp-check", "temp-fifo", "term-size", "$test-format", "then", "thunk",
+	"ticker", "timer", "to-list", "to-string", "true", "umask",
+	"undefined", "unless", "unlock", "unmatched", "unparse", "unquote",
+	"unquote-splicing", "unset", "unwind-protect", "uptime", "$USER",
+	"verify-checksums", "wait", "wait-group", "warn", "while", "with",
+	"with-cwd", "with-env", "with-host", "with-open", "with-priority",
+	"with-rlimit", "write", "write-to-string", "writer-close",
 }
@@ -800,13 +800,13 @@ yydefault:
 		yyDollar = yyS[yypt-2 : yypt+1]
 		//line grammar.y:187
 		{
-			yyVAL.c = List(NewSymbol("splice"), yyDollar[2].c)
+			yyVAL.c = List(NewSymbol(yyDollar[1].s), yyDollar[2].c)
 		}
 	case 43:
 		yyDollar = yyS[yypt-2 : yypt+1]
 		//line grammar.y:191
 		{
-			yyVAL.c = List(NewSymbol("backtick"), yyDollar[2].c)
+			yyVAL.c = List(NewSymbol(yyDollar[1].s), yyDollar[2].c)
 		}
 	case 44:
 		yyDollar = yyS[yypt-3 : yypt+1]
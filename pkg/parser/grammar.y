@@ -185,11 +185,11 @@ expression: expression "^" expression {
 };
 
 expression: "@" expression {
-	$$.c = List(NewSymbol("splice"), $2.c)
+	$$.c = List(NewSymbol($1.s), $2.c)
 };
 
 expression: "`" expression {
-	$$.c = List(NewSymbol("backtick"), $2.c)
+	$$.c = List(NewSymbol($1.s), $2.c)
 };
 
 expression: expression CONS expression {
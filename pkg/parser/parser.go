@@ -7,6 +7,7 @@ import (
 	"github.com/michaelmacinnis/oh/pkg/common"
 	"github.com/michaelmacinnis/oh/pkg/task"
 	"github.com/michaelmacinnis/oh/pkg/ui"
+	"strconv"
 )
 
 type scanner struct {
@@ -26,15 +27,35 @@ type scanner struct {
 	previous rune
 	token    rune
 
-	finished bool
+	brackets  []rune
+	continued bool
+	failed    bool
+	finished  bool
+	lineno    int
+
+	/*
+	 * Whether the previous token was a quasiquote and, for each template
+	 * being read, the number of brackets open outside it. Outside a
+	 * template, a comma is an ordinary character.
+	 */
+	quasiquoted bool
+	templates   []int
 }
 
+/* Prompts used when reading interactively. */
+const (
+	primary   = "> "
+	secondary = ">> "
+)
+
 const (
 	ssStart = iota
 	ssAmpersand
+	ssBacktick
 	ssBang
 	ssBangGreater
 	ssColon
+	ssComma
 	ssComment
 	ssDoubleQuoted
 	ssDoubleQuotedEscape
@@ -53,11 +74,16 @@ func (s *scanner) Lex(lval *yySymType) (token int) {
 		"!|+": "channel-stderr",
 		"&":   "spawn",
 		"&&":  "and",
+		",":   "unquote",
+		",@":  "unquote-splicing",
 		"<":   "redirect-stdin",
 		"<(":  "substitute-stdout",
 		">":   "redirect-stdout",
 		">(":  "substitute-stdin",
 		">>":  "append-stdout",
+		"@":   "splice",
+		"`":   "backtick",
+		"``":  "quasiquote",
 		"|":   "pipe-stdout",
 		"|+":  "channel-stdout",
 		"||":  "or",
@@ -67,7 +93,7 @@ func (s *scanner) Lex(lval *yySymType) (token int) {
 		exists := false
 
 		switch s.token {
-		case BACKGROUND, ORF, ANDF, PIPE, REDIRECT, SUBSTITUTE:
+		case BACKGROUND, ORF, ANDF, PIPE, REDIRECT, SUBSTITUTE, '@', '`':
 			lval.s, exists = operator[string(s.line[s.start:s.cursor])]
 			if exists {
 				break
@@ -77,6 +103,7 @@ func (s *scanner) Lex(lval *yySymType) (token int) {
 			lval.s = string(s.line[s.start:s.cursor])
 		}
 
+		s.quasiquoted = s.token == '`' && lval.s == "quasiquote"
 		s.state = ssStart
 		s.previous = s.token
 		s.token = 0
@@ -89,13 +116,31 @@ main:
 				return 0
 			}
 
+			if p, ok := s.input.(prompter); ok {
+				if s.pending() {
+					p.SetPrompt(secondary)
+					p.SetRightPrompt("")
+				} else {
+					left, right := task.Prompts(primary)
+					p.SetPrompt(left)
+					p.SetRightPrompt(right)
+				}
+			}
+
 			line, error := s.input.ReadString('\n')
 			if error == ui.CtrlCPressed {
+				s.brackets = nil
+				s.templates = nil
+				s.continued = false
 				s.start = 0
 				s.token = CTRLC
 				break
 			}
 
+			if line != "" {
+				s.lineno++
+			}
+
 			runes := []rune(line)
 			last := len(runes) - 2
 			if last >= 0 && runes[last] == '\r' {
@@ -103,7 +148,8 @@ main:
 				last--
 			}
 
-			if last >= 0 && runes[last] == '\\' {
+			s.continued = last >= 0 && runes[last] == '\\'
+			if s.continued {
 				runes = runes[0:last]
 			}
 
@@ -131,10 +177,39 @@ main:
 			default:
 				s.state = ssSymbol
 				continue main
-			case '\n', '%', '(', ')', ';', '@', '^', '`', '{', '}':
+			case '\n':
+				if s.nested() {
+					break
+				}
+				s.token = '\n'
+			case '(', '{':
+				if s.quasiquoted {
+					s.templates = append(s.templates, len(s.brackets))
+				}
+				s.brackets = append(s.brackets, s.line[s.cursor])
+				s.token = s.line[s.cursor]
+			case ')', '}':
+				if len(s.brackets) > 0 {
+					s.brackets = s.brackets[:len(s.brackets)-1]
+				}
+				n := len(s.templates)
+				if n > 0 && s.templates[n-1] == len(s.brackets) {
+					s.templates = s.templates[:n-1]
+				}
+				s.token = s.line[s.cursor]
+			case '%', ';', '@', '^':
 				s.token = s.line[s.cursor]
 			case '&':
 				s.state = ssAmpersand
+			case '`':
+				s.state = ssBacktick
+			case ',':
+				if s.quasiquoted || len(s.templates) > 0 {
+					s.state = ssComma
+				} else {
+					s.state = ssSymbol
+					continue main
+				}
 			case '<':
 				s.state = ssLess
 			case '|':
@@ -164,6 +239,12 @@ main:
 				continue main
 			}
 
+		case ssBacktick:
+			s.token = '`'
+			if s.line[s.cursor] != '`' {
+				continue main
+			}
+
 		case ssBang:
 			switch s.line[s.cursor] {
 			case '>':
@@ -190,6 +271,18 @@ main:
 				continue main
 			}
 
+		case ssComma:
+			switch s.line[s.cursor] {
+			case '\n', '\t', ' ', ')', ':', ';', '}':
+				s.state = ssSymbol
+				continue main
+			case '@':
+				s.token = '@'
+			default:
+				s.token = '@'
+				continue main
+			}
+
 		case ssComment:
 			for s.line[s.cursor] != '\n' ||
 				s.line[s.cursor-1] == '\\' {
@@ -224,6 +317,7 @@ main:
 		case ssGreater:
 			s.token = REDIRECT
 			if s.line[s.cursor] == '(' {
+				s.brackets = append(s.brackets, '(')
 				s.token = SUBSTITUTE
 			} else if s.line[s.cursor] != '>' {
 				continue main
@@ -232,6 +326,7 @@ main:
 		case ssLess:
 			s.token = REDIRECT
 			if s.line[s.cursor] == '(' {
+				s.brackets = append(s.brackets, '(')
 				s.token = SUBSTITUTE
 			} else {
 				continue main
@@ -283,14 +378,46 @@ main:
 	return int(s.token)
 }
 
+/*
+ * Report a syntax error. When not reading interactively, the message
+ * includes the number of the line on which the error was found.
+ */
 func (s *scanner) Error(msg string) {
-	println(msg)
+	s.failed = true
+
+	if _, ok := s.input.(prompter); ok {
+		println(msg)
+	} else {
+		println("line " + strconv.Itoa(s.lineno) + ": " + msg)
+	}
+}
+
+/* Is a newline, at this point, whitespace within parentheses? */
+func (s *scanner) nested() bool {
+	n := len(s.brackets)
+	return n > 0 && s.brackets[n-1] == '('
+}
+
+/* Is the current command incomplete? */
+func (s *scanner) pending() bool {
+	switch s.previous {
+	case ORF, ANDF, PIPE, REDIRECT:
+		return true
+	}
+
+	return len(s.brackets) > 0 || s.continued || s.state != ssStart
+}
+
+type prompter interface {
+	SetPrompt(prompt string)
+	SetRightPrompt(prompt string)
 }
 
+/* Parse commands from r, passing each to p. Returns false on error. */
 func Parse(t *task.Task,
 	r common.ReadStringer,
 	d func(string, uintptr) Cell,
-	p func(Cell)) {
+	p func(Cell)) bool {
 
 	s := new(scanner)
 
@@ -310,7 +437,7 @@ func Parse(t *task.Task,
 	s.previous = 0
 	s.token = 0
 
-	yyParse(s)
+	return yyParse(s) == 0 && !s.failed
 }
 
 //go:generate go tool yacc -o grammar.go grammar.y
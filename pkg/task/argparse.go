@@ -0,0 +1,201 @@
+// Released under an MIT-style license. See LICENSE.
+
+package task
+
+import (
+	"fmt"
+	. "github.com/michaelmacinnis/oh/pkg/cell"
+	"strconv"
+	"strings"
+)
+
+/*
+ * Each option is specified as a list (name type default help), where type
+ * is one of boolean, integer, float or string, and default and help may be
+ * omitted. Options are given as --name value, --name=value or, for a
+ * boolean, --name (or --no-name). A name can also be given with a single
+ * dash. Anything else, or anything after --, is a positional argument.
+ */
+
+type option struct {
+	name  string
+	kind  string
+	value Cell
+	help  string
+}
+
+/*
+ * Parse args according to specs, returning an object with a member for
+ * each option and the positional arguments as the member args, or nil if
+ * help was requested, after writing the usage message to out.
+ */
+func argparse(t *Task, specs, args Cell, out Conduit) Cell {
+	options := []*option{}
+	byName := map[string]*option{}
+
+	for ; specs != Null; specs = Cdr(specs) {
+		s := Car(specs)
+
+		o := &option{name: raw(Car(s)), kind: "boolean"}
+		if Cdr(s) != Null {
+			o.kind = raw(Cadr(s))
+		}
+
+		switch o.kind {
+		case "boolean":
+			o.value = False
+		case "float":
+			o.value = NewFloat(0)
+		case "integer":
+			o.value = NewInteger(0)
+		case "string":
+			o.value = NewString(t, "")
+		default:
+			panic("error/runtime: argparse: unknown type: " + o.kind)
+		}
+
+		if c := Caddr(s); c != Null {
+			o.value = o.convert(t, raw(c))
+		}
+		if c := Car(Cdr(Cddr(s))); c != Null {
+			o.help = raw(c)
+		}
+
+		options = append(options, o)
+		byName[o.name] = o
+	}
+
+	positional := []Cell{}
+	for ; args != Null; args = Cdr(args) {
+		arg := raw(Car(args))
+		if arg == "--" {
+			for args = Cdr(args); args != Null; args = Cdr(args) {
+				positional = append(positional, Car(args))
+			}
+			break
+		}
+
+		if len(arg) < 2 || arg[0] != '-' {
+			positional = append(positional, Car(args))
+			continue
+		}
+
+		name := strings.TrimLeft(arg, "-")
+		if name == "h" || name == "help" {
+			out.Write(List(NewSymbol(usage(options))))
+			return nil
+		}
+
+		value, given := "", false
+		if i := strings.Index(name, "="); i >= 0 {
+			name, value, given = name[:i], name[i+1:], true
+		}
+
+		o, ok := byName[name]
+		if !ok && strings.HasPrefix(name, "no-") && !given {
+			if o, ok = byName[name[3:]]; ok && o.kind == "boolean" {
+				o.value = False
+				continue
+			}
+		}
+		if !ok {
+			panic("error/runtime: argparse: unknown option: " + arg)
+		}
+
+		if o.kind == "boolean" && !given {
+			o.value = True
+			continue
+		}
+
+		if !given {
+			if args = Cdr(args); args == Null {
+				msg := "missing value for option: " + arg
+				panic("error/runtime: argparse: " + msg)
+			}
+			value = raw(Car(args))
+		}
+
+		o.value = o.convert(t, value)
+	}
+
+	result := NewObject(NewScope(scope0, nil))
+	for _, o := range options {
+		result.Public(NewSymbol(o.name), o.value)
+	}
+	result.Public(NewSymbol("args"), List(positional...))
+
+	return result
+}
+
+func (o *option) convert(t *Task, s string) Cell {
+	switch o.kind {
+	case "boolean":
+		switch s {
+		case "true":
+			return True
+		case "false":
+			return False
+		}
+	case "float":
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return NewFloat(f)
+		}
+	case "integer":
+		if i, err := strconv.ParseInt(s, 0, 64); err == nil {
+			return NewInteger(i)
+		}
+	case "string":
+		return NewString(t, s)
+	}
+
+	msg := fmt.Sprintf("%s expects %s value: %s", o.flag(), o.kind, s)
+	panic("error/runtime: argparse: " + msg)
+}
+
+func (o *option) flag() string {
+	if len(o.name) == 1 {
+		return "-" + o.name
+	}
+
+	return "--" + o.name
+}
+
+/* Return the help message for options. */
+func usage(options []*option) string {
+	name := "script"
+	if r := env0.Access(NewSymbol("$0")); r != nil {
+		name = raw(r.Get())
+	}
+
+	lines := [][2]string{}
+	for _, o := range options {
+		left := o.flag()
+		if o.kind != "boolean" {
+			left += " " + o.kind
+		}
+
+		right := o.help
+		if o.kind != "boolean" {
+			right = strings.TrimSpace(right + " (default " +
+				pretty(o.value, defaultWidth, false) + ")")
+		}
+
+		lines = append(lines, [2]string{left, right})
+	}
+	lines = append(lines, [2]string{"-h, --help", "Show this help"})
+
+	width := 0
+	for _, l := range lines {
+		if len(l[0]) > width {
+			width = len(l[0])
+		}
+	}
+
+	s := "usage: " + name + " [options] [args...]\n"
+	for _, l := range lines {
+		line := fmt.Sprintf("  %-*s  %s", width, l[0], l[1])
+		s += "\n" + strings.TrimRight(line, " ")
+	}
+
+	return s
+}
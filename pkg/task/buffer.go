@@ -0,0 +1,175 @@
+// Released under an MIT-style license. See LICENSE.
+
+package task
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	. "github.com/michaelmacinnis/oh/pkg/cell"
+	"strings"
+	"unicode/utf8"
+)
+
+/*
+ * A buffer holds raw bytes. Like a string, a buffer is not changed by its
+ * methods: append and slice return a new buffer. The buffer builtin
+ * creates a buffer from its arguments, each of which can be a buffer, a
+ * list of byte values or text, which is encoded as UTF-8.
+ *
+ * The to-string method decodes a buffer's bytes as utf-8 (the default) or
+ * another encoding, or encodes them as hex or base64.
+ */
+
+var envb *Env
+
+func bufferEnv() *Env {
+	if envb != nil {
+		goto created
+	}
+
+	envb = NewEnv(nil)
+	envb.Method("append", func(t *Task, args Cell) bool {
+		b := toBuffer(t.Self()).v
+		b = append(b[:len(b):len(b)], octets(args)...)
+
+		return t.Return(NewBuffer(t, b))
+	})
+	envb.Method("child", func(t *Task, args Cell) bool {
+		panic("buffers cannot be parents")
+	})
+	envb.Method("clone", func(t *Task, args Cell) bool {
+		panic("buffers cannot be cloned")
+	})
+	envb.Method("define", func(t *Task, args Cell) bool {
+		panic("private members cannot be added to a buffer")
+	})
+	envb.Method("length", func(t *Task, args Cell) bool {
+		return t.Return(NewInteger(int64(len(toBuffer(t.Self()).v))))
+	})
+	envb.Method("slice", func(t *Task, args Cell) bool {
+		b := toBuffer(t.Self()).v
+
+		start := int(Car(args).(Atom).Int())
+		end := len(b)
+
+		if Cdr(args) != Null {
+			end = int(Cadr(args).(Atom).Int())
+		}
+
+		if start < 0 || end < start || end > len(b) {
+			panic("error/runtime: slice out of range")
+		}
+
+		return t.Return(NewBuffer(t, b[start:end:end]))
+	})
+	envb.Method("to-list", func(t *Task, args Cell) bool {
+		l := Null
+		for _, c := range toBuffer(t.Self()).v {
+			l = Cons(NewInteger(int64(c)), l)
+		}
+
+		return t.Return(Reverse(l))
+	})
+	envb.Method("to-string", func(t *Task, args Cell) bool {
+		encoding := "utf-8"
+		if args != Null {
+			encoding = strings.ToLower(raw(Car(args)))
+		}
+
+		b := toBuffer(t.Self()).v
+
+		s := ""
+		switch encoding {
+		case "base64":
+			s = base64.StdEncoding.EncodeToString(b)
+		case "hex":
+			s = hex.EncodeToString(b)
+		case "utf-8":
+			if !utf8.Valid(b) {
+				panic("error/runtime: buffer is not valid utf-8")
+			}
+			s = string(b)
+		default:
+			s = decode(b, encoding)
+		}
+
+		return t.Return(NewString(t, s))
+	})
+
+created:
+	return envb
+}
+
+/* Buffer cell definition. */
+
+type Buffer struct {
+	*Scope
+	v []byte
+}
+
+func IsBuffer(c Cell) bool {
+	switch c.(type) {
+	case *Buffer:
+		return true
+	}
+	return false
+}
+
+func NewBuffer(t *Task, v []byte) *Buffer {
+	return &Buffer{NewScope(t.Lexical.Expose(), bufferEnv()), v}
+}
+
+func (b *Buffer) Equal(c Cell) bool {
+	if o, ok := c.(*Buffer); ok {
+		return string(b.v) == string(o.v)
+	}
+	return false
+}
+
+func (b *Buffer) Expose() Context {
+	return b
+}
+
+func (b *Buffer) String() string {
+	return identify("buffer", b)
+}
+
+/* Buffer-specific functions. */
+
+func (b *Buffer) Bytes() []byte {
+	return b.v
+}
+
+/*
+ * Return the bytes in args. Each is a buffer, a list of byte values, or
+ * text, which is encoded as UTF-8.
+ */
+func octets(args Cell) []byte {
+	v := []byte{}
+	for ; args != Null; args = Cdr(args) {
+		switch c := Car(args).(type) {
+		case *Buffer:
+			v = append(v, c.v...)
+		case *Pair:
+			for l := Cell(c); l != Null; l = Cdr(l) {
+				n := Car(l).(Atom).Int()
+				if n < 0 || n > 255 {
+					panic("error/runtime: not a byte: " + Car(l).String())
+				}
+				v = append(v, byte(n))
+			}
+		default:
+			v = append(v, raw(c)...)
+		}
+	}
+
+	return v
+}
+
+func toBuffer(o Context) *Buffer {
+	if b, ok := o.(*Buffer); ok {
+		return b
+	}
+
+	panic("not a buffer")
+}
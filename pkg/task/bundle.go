@@ -0,0 +1,245 @@
+// Released under an MIT-style license. See LICENSE.
+
+package task
+
+import (
+	archive "archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	. "github.com/michaelmacinnis/oh/pkg/cell"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+/*
+ * A bundle is an oh binary with a zip archive appended to it. The archive
+ * holds a script, named in the archive's comment, and the scripts that it
+ * sources by name, directly or indirectly. The archive is followed by its
+ * length, as an 8-byte big-endian integer, and bundleMagic. When a bundle
+ * is run, the script is run with the bundle's arguments, and a script in
+ * the archive is sourced from the archive rather than from disk.
+ */
+
+const bundleMagic = "ohbundle"
+
+/* Bundled scripts, by the name used to source them. */
+var bundled = map[string][]byte{}
+
+/*
+ * Bundle writes, to the file out, a copy of the running oh binary with
+ * the script and the scripts that it sources appended.
+ */
+func Bundle(out, script string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(exe)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	size, _, err := bundleOffset(f)
+	if err != nil {
+		return err
+	}
+
+	files := map[string][]byte{}
+	order := []string{}
+	err = sourced(script, filepath.Dir(script), files, &order)
+	if err != nil {
+		return err
+	}
+
+	var b bytes.Buffer
+	z := archive.NewWriter(&b)
+	for _, name := range order {
+		w, err := z.Create(name)
+		if err != nil {
+			return err
+		}
+		if _, err = w.Write(files[name]); err != nil {
+			return err
+		}
+	}
+	z.SetComment(script)
+	if err = z.Close(); err != nil {
+		return err
+	}
+
+	o, err := os.OpenFile(out, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0755)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(o, io.NewSectionReader(f, 0, size))
+	if err == nil {
+		_, err = b.WriteTo(o)
+	}
+	if err == nil {
+		err = binary.Write(o, binary.BigEndian, size)
+	}
+	if err == nil {
+		_, err = o.WriteString(bundleMagic)
+	}
+	if cerr := o.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
+
+/*
+ * LoadBundle reads the scripts bundled with the running oh binary and
+ * returns the name of the script to run, or "" if there is none.
+ */
+func LoadBundle() string {
+	exe, err := os.Executable()
+	if err != nil {
+		return ""
+	}
+
+	f, err := os.Open(exe)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	size, end, err := bundleOffset(f)
+	if err != nil || size == end {
+		return ""
+	}
+
+	z, err := archive.NewReader(io.NewSectionReader(f, size, end-size), end-size)
+	if err != nil {
+		return ""
+	}
+
+	for _, zf := range z.File {
+		r, err := zf.Open()
+		if err != nil {
+			return ""
+		}
+
+		b, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil {
+			return ""
+		}
+
+		bundled[zf.Name] = b
+	}
+
+	return z.Comment
+}
+
+/*
+ * Return the size of the binary f without any bundle and, if there is
+ * one, the offset at which the bundle's trailer starts.
+ */
+func bundleOffset(f *os.File) (int64, int64, error) {
+	i, err := f.Stat()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	end := i.Size() - int64(8+len(bundleMagic))
+	if end < 0 {
+		return i.Size(), i.Size(), nil
+	}
+
+	trailer := make([]byte, 8+len(bundleMagic))
+	if _, err = f.ReadAt(trailer, end); err != nil {
+		return 0, 0, err
+	}
+
+	if string(trailer[8:]) != bundleMagic {
+		return i.Size(), i.Size(), nil
+	}
+
+	n := int64(binary.BigEndian.Uint64(trailer[:8]))
+	if n < 0 || n > end {
+		return 0, 0, errors.New("corrupt bundle")
+	}
+
+	return n, end, nil
+}
+
+/* Bundle the script named by the command line, as for Bundle. */
+func bundle() int {
+	if len(os.Args) < 2 {
+		fmt.Fprintf(os.Stderr, "oh: -bundle requires a script\n")
+		return 1
+	}
+
+	if err := Bundle(BundleOutput, os.Args[1]); err != nil {
+		fmt.Fprintf(os.Stderr, "oh: %v\n", err)
+		return 1
+	}
+
+	return 0
+}
+
+/*
+ * Add name, and the scripts that it sources by name, to files, reading
+ * each from the current directory or, failing that, from dir. The names
+ * are appended to order in the order in which they are found.
+ */
+func sourced(name, dir string, files map[string][]byte, order *[]string) error {
+	if _, ok := files[name]; ok {
+		return nil
+	}
+
+	b, err := ioutil.ReadFile(name)
+	if os.IsNotExist(err) && !filepath.IsAbs(name) {
+		b, err = ioutil.ReadFile(filepath.Join(dir, name))
+	}
+	if err != nil {
+		return err
+	}
+
+	files[name] = b
+	*order = append(*order, name)
+
+	names := []string{}
+	var walk func(c Cell)
+	walk = func(c Cell) {
+		if !IsCons(c) || c == Null {
+			return
+		}
+
+		if s, ok := Car(c).(*Symbol); ok && s.String() == "source" {
+			switch arg := Cadr(c); arg.(type) {
+			case *String, *Symbol:
+				if s := raw(arg); !strings.HasPrefix(s, "$") {
+					names = append(names, s)
+				}
+			}
+		}
+
+		for ; IsCons(c) && c != Null; c = Cdr(c) {
+			walk(Car(c))
+		}
+	}
+
+	r := bufio.NewReader(bytes.NewReader(b))
+	if !parse(nil, r, deref, walk) {
+		return errors.New(name + ": syntax error")
+	}
+
+	for _, n := range names {
+		if err := sourced(n, dir, files, order); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,130 @@
+// Released under an MIT-style license. See LICENSE.
+
+package task
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	. "github.com/michaelmacinnis/oh/pkg/cell"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+/*
+ * The commands in a sourced script are cached, as written by
+ * write-to-string, in the directory oh under the user's cache directory
+ * (usually ~/.cache/oh). Each file is named for a hash of the script's
+ * contents, so a script that changes is parsed again, and a script that
+ * does not is read back from the cache rather than parsed. Only regular
+ * files are cached. The cache can be removed at any time.
+ */
+
+/* Changed when the parser changes what it produces for a script. */
+const cacheVersion = "oh 1\n"
+
+/* Save the commands l in path, if they can be written. */
+func cache(l Cell, path string) {
+	defer func() {
+		recover()
+	}()
+
+	s := serialize(l)
+
+	dir := filepath.Dir(path)
+	if os.MkdirAll(dir, 0700) != nil {
+		return
+	}
+
+	f, err := ioutil.TempFile(dir, filepath.Base(path)+".")
+	if err != nil {
+		return
+	}
+
+	_, err = f.WriteString(s)
+	if f.Close() != nil || err != nil {
+		os.Remove(f.Name())
+		return
+	}
+
+	os.Rename(f.Name(), path)
+}
+
+/* Return the path of the cache file for a script with contents b. */
+func cacheFile(b []byte) string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+
+	h := sha256.New()
+	h.Write([]byte(cacheVersion))
+	h.Write(b)
+
+	return filepath.Join(dir, "oh", hex.EncodeToString(h.Sum(nil)))
+}
+
+/* Return the commands cached in path, or nil if there are none. */
+func cached(t *Task, path string) (c Cell) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			c = nil
+		}
+	}()
+
+	return unserialize(t, string(b))
+}
+
+/*
+ * Return the commands in the script at path, or in the bundled script
+ * sourced as path. If the script cannot be parsed, the commands before
+ * the error are returned and the script is not cached.
+ */
+func readCommands(t *Task, path string) Cell {
+	file := ""
+	b, ok := bundled[path]
+	if !ok && path == "/dev/stdin" {
+		/* Not every platform has /dev/stdin. */
+		var err error
+		if b, err = ioutil.ReadAll(os.Stdin); err != nil {
+			panic(err)
+		}
+	} else if !ok {
+		path = resolvePath(t, path)
+
+		var err error
+		if b, err = ioutil.ReadFile(path); err != nil {
+			panic(err)
+		}
+
+		if i, err := os.Stat(path); err == nil && i.Mode().IsRegular() {
+			file = cacheFile(b)
+		}
+	}
+
+	if file != "" {
+		if c := cached(t, file); c != nil {
+			return c
+		}
+	}
+
+	commands := []Cell{}
+	r := bufio.NewReader(bytes.NewReader(b))
+	ok = parse(t, r, deref, func(c Cell) {
+		commands = append(commands, c)
+	})
+
+	l := List(commands...)
+	if ok && file != "" {
+		cache(l, file)
+	}
+
+	return l
+}
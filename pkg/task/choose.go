@@ -0,0 +1,282 @@
+// Released under an MIT-style license. See LICENSE.
+
+package task
+
+import (
+	"fmt"
+	. "github.com/michaelmacinnis/oh/pkg/cell"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+/*
+ * The choose command shows a list of items, on the terminal, that can be
+ * filtered by typing, and returns the item selected. The items are its
+ * arguments or, if it is given a single conduit, or none, the lines read
+ * from the conduit, or from $stdin. An item matches if it contains the
+ * characters typed, in order, ignoring case, and items with the closest
+ * matches are shown first. The up and down arrow keys, or Control-P and
+ * Control-N, move the selection, and Enter selects. Escape, Control-C or
+ * Control-G cancels, and choose returns false. The choose-many command is
+ * the same, but Tab marks items, and it returns a list of those marked or,
+ * if none were, of the item selected.
+ *
+ * The terminal is read and written directly, so the items can be piped to
+ * choose, and what it returns captured.
+ */
+
+/* The most items shown at once. */
+const maxChoices = 10
+
+type chooser struct {
+	items    []Cell
+	labels   []string
+	marked   map[int]bool
+	matches  []int
+	query    []rune
+	selected int
+	tty      *os.File
+	width    int
+}
+
+/* Return the items chosen from args, or nil if the choice was cancelled. */
+func chooseItems(t *Task, args Cell, many bool) []Cell {
+	items := elements(args)
+	if len(items) < 2 {
+		var c Conduit
+		if len(items) == 0 {
+			c = toConduit(t.dynamic("$stdin", nil).(Context))
+		} else if o, ok := items[0].(Context); ok {
+			c = asConduit(o)
+		}
+
+		if c != nil {
+			items = []Cell{}
+			for v := c.ReadLine(t); v != Null && v != False; v = c.ReadLine(t) {
+				items = append(items, v)
+			}
+		}
+	}
+
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		panic("error/runtime: choose: no terminal: " + err.Error())
+	}
+	defer tty.Close()
+
+	restore, err := RawTerminal(tty.Fd())
+	if err != nil {
+		panic("error/runtime: choose: " + err.Error())
+	}
+	defer restore()
+
+	ch := &chooser{items: items, marked: map[int]bool{}, tty: tty, width: 80}
+	if cols := TerminalWidth(tty.Fd()); cols > 0 {
+		ch.width = cols
+	}
+	for _, item := range items {
+		ch.labels = append(ch.labels, strings.Map(printable, raw(item)))
+	}
+
+	ch.filter()
+
+	defer fmt.Fprint(tty, "\r\x1b[J")
+
+	b := make([]byte, 64)
+	for {
+		ch.draw()
+
+		n, err := tty.Read(b)
+		if err != nil {
+			return nil
+		}
+
+		done, ok := ch.key(b[:n], many)
+		if !done {
+			continue
+		}
+
+		if !ok || len(ch.matches) == 0 {
+			return nil
+		}
+
+		chosen := []Cell{}
+		for i, item := range items {
+			if ch.marked[i] {
+				chosen = append(chosen, item)
+			}
+		}
+		if len(chosen) == 0 {
+			chosen = append(chosen, items[ch.matches[ch.selected]])
+		}
+
+		return chosen
+	}
+}
+
+/*
+ * Return how closely label matches query: the number of characters from
+ * the first matched to the last, or -1 if it does not contain the
+ * characters in query, in order.
+ */
+func closeness(label string, query []rune) int {
+	if len(query) == 0 {
+		return 0
+	}
+
+	first, i := -1, 0
+	for n, r := range []rune(strings.ToLower(label)) {
+		if r != unicode.ToLower(query[i]) {
+			continue
+		}
+
+		if first < 0 {
+			first = n
+		}
+
+		if i++; i == len(query) {
+			return n - first
+		}
+	}
+
+	return -1
+}
+
+/* Show the query and the matching items, leaving the cursor on the query. */
+func (ch *chooser) draw() {
+	var b strings.Builder
+
+	b.WriteString("\r\x1b[J> " + string(ch.query))
+	fmt.Fprintf(&b, "  %d/%d", len(ch.matches), len(ch.items))
+
+	start := 0
+	if ch.selected >= maxChoices {
+		start = ch.selected - maxChoices + 1
+	}
+
+	shown := 0
+	for n := start; n < len(ch.matches) && shown < maxChoices; n++ {
+		i := ch.matches[n]
+
+		mark := "  "
+		if ch.marked[i] {
+			mark = "* "
+		}
+
+		label := truncate(mark+ch.labels[i], ch.width-1)
+		if n == ch.selected {
+			label = ansiReverse + label + ansiReset
+		}
+
+		b.WriteString("\r\n" + label)
+		shown++
+	}
+
+	if shown > 0 {
+		fmt.Fprintf(&b, "\x1b[%dA", shown)
+	}
+	fmt.Fprintf(&b, "\r\x1b[%dC", 2+utf8.RuneCountInString(string(ch.query)))
+
+	ch.tty.WriteString(b.String())
+}
+
+/* Set matches to the items that match the query, closest first. */
+func (ch *chooser) filter() {
+	scores := map[int]int{}
+
+	ch.matches = ch.matches[:0]
+	for i, label := range ch.labels {
+		if n := closeness(label, ch.query); n >= 0 {
+			scores[i] = n
+			ch.matches = append(ch.matches, i)
+		}
+	}
+
+	sort.SliceStable(ch.matches, func(a, b int) bool {
+		return scores[ch.matches[a]] < scores[ch.matches[b]]
+	})
+
+	ch.selected = 0
+}
+
+/*
+ * Handle the keys in b. Returns done as true once a choice has been made,
+ * and ok as false if it was cancelled.
+ */
+func (ch *chooser) key(b []byte, many bool) (done, ok bool) {
+	switch string(b) {
+	case "\x1b", "\x03", "\x07":
+		return true, false
+	case "\r", "\n":
+		return true, true
+	case "\x1b[A", "\x1bOA", "\x10":
+		if ch.selected > 0 {
+			ch.selected--
+		}
+		return false, false
+	case "\x1b[B", "\x1bOB", "\x0e":
+		if ch.selected < len(ch.matches)-1 {
+			ch.selected++
+		}
+		return false, false
+	case "\t":
+		if many && len(ch.matches) > 0 {
+			i := ch.matches[ch.selected]
+			ch.marked[i] = !ch.marked[i]
+			if ch.selected < len(ch.matches)-1 {
+				ch.selected++
+			}
+		}
+		return false, false
+	case "\x7f", "\x08":
+		if len(ch.query) > 0 {
+			ch.query = ch.query[:len(ch.query)-1]
+			ch.filter()
+		}
+		return false, false
+	case "\x15":
+		ch.query = ch.query[:0]
+		ch.filter()
+		return false, false
+	}
+
+	if b[0] == 0x1b {
+		return false, false
+	}
+
+	changed := false
+	for _, r := range string(b) {
+		if unicode.IsPrint(r) {
+			ch.query = append(ch.query, r)
+			changed = true
+		}
+	}
+
+	if changed {
+		ch.filter()
+	}
+
+	return false, false
+}
+
+/* Return r, or a space if it is not printable. */
+func printable(r rune) rune {
+	if unicode.IsPrint(r) {
+		return r
+	}
+
+	return ' '
+}
+
+/* Return s, cut to at most n characters. */
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if n < 0 || len(r) <= n {
+		return s
+	}
+
+	return string(r[:n])
+}
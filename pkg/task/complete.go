@@ -0,0 +1,70 @@
+// Released under an MIT-style license. See LICENSE.
+
+package task
+
+import (
+	. "github.com/michaelmacinnis/oh/pkg/cell"
+	"path/filepath"
+	"strings"
+)
+
+/*
+ * The dynamic variable $flags holds an object whose public members, named
+ * for commands, are lists of the flags that the interactive completer
+ * offers for those commands. It starts with a few flags common to every
+ * system, and can be extended with set-slot:
+ *
+ *     $flags::set-slot tar (list -c -t -x -f -v -z)
+ */
+
+var knownFlags = map[string][]string{
+	"cp":    {"-R", "-f", "-i", "-p"},
+	"grep":  {"-E", "-F", "-c", "-i", "-l", "-n", "-v"},
+	"ls":    {"-a", "-d", "-l", "-t"},
+	"mkdir": {"-m", "-p"},
+	"mv":    {"-f", "-i"},
+	"rm":    {"-f", "-i", "-r"},
+}
+
+/* Return the default flags object. */
+func flags() *Object {
+	s := NewScope(scope0, nil)
+	for k, v := range knownFlags {
+		l := []Cell{}
+		for _, f := range v {
+			l = append(l, NewSymbol(f))
+		}
+		s.Public(NewSymbol(k), List(l...))
+	}
+
+	return NewObject(s)
+}
+
+/* Return the flags in $flags for the command name that begin with prefix. */
+func Flags(name, prefix string) (completions []string) {
+	completions = []string{}
+
+	defer func() {
+		recover()
+	}()
+
+	t := ForegroundTask()
+
+	o, ok := t.dynamic("$flags", nil).(Context)
+	if !ok {
+		return
+	}
+
+	r := o.Access(NewSymbol(filepath.Base(name)))
+	if r == nil {
+		return
+	}
+
+	for _, c := range elements(r.Get()) {
+		if f := raw(c); strings.HasPrefix(f, prefix) {
+			completions = append(completions, f)
+		}
+	}
+
+	return
+}
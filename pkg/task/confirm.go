@@ -0,0 +1,151 @@
+// Released under an MIT-style license. See LICENSE.
+
+package task
+
+import (
+	"errors"
+	"fmt"
+	. "github.com/michaelmacinnis/oh/pkg/cell"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+/*
+ * The confirm command asks a yes or no question, before a script does
+ * something that cannot be undone:
+ *
+ *     confirm message [--default answer] [--timeout duration]
+ *
+ * It writes the message to the terminal and reads the answer, y or yes for
+ * true and n or no for false, asking again until it gets one. An empty
+ * answer is the default, yes or no, if there is one. If $stdin is not a
+ * terminal, or no answer is given before the timeout, confirm returns the
+ * default or, if there is none, an error. If $assume-yes is true, confirm
+ * returns true without asking, so that a script can offer a --yes option.
+ */
+
+var confirmParams = List(
+	List(NewSymbol("--default"), Null),
+	List(NewSymbol("--timeout"), Null),
+)
+
+/* Return the answer to the question message, or an error. */
+func confirm(t *Task, args Cell) Cell {
+	args, values := keywords(confirmParams, args)
+
+	if t.dynamic("$assume-yes", False).Bool() {
+		return True
+	}
+
+	answer := Cell(nil)
+	hint := "[y/n]"
+	if d, ok := values["--default"]; ok {
+		answer = yesOrNo(raw(d))
+		if answer == nil {
+			panic("error/runtime: invalid default: " + raw(d))
+		}
+
+		hint = "[Y/n]"
+		if answer == False {
+			hint = "[y/N]"
+		}
+	}
+
+	fail := func(err error) Cell {
+		if answer != nil {
+			return answer
+		}
+
+		return NewError(t, err)
+	}
+
+	in := t.dynamic("$stdin", nil)
+	if p, ok := asConduit(in.(Context)).(*Pipe); !ok ||
+		p.ReadFd() == nil || !IsTerminal(p.ReadFd().Fd()) {
+		return fail(errors.New("confirm: not a terminal"))
+	}
+
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return fail(err)
+	}
+	defer tty.Close()
+
+	deadline := time.Time{}
+	if d, ok := values["--timeout"]; ok {
+		deadline = time.Now().Add(duration(d))
+	}
+
+	message := strings.TrimSpace(raw(Car(args)))
+	for {
+		fmt.Fprintf(tty, "%s %s ", message, hint)
+
+		line, err := readTerminalLine(t, tty, deadline)
+		if err != nil {
+			fmt.Fprintln(tty)
+			return fail(err)
+		}
+
+		line = strings.TrimSpace(line)
+		if line == "" && answer != nil {
+			return answer
+		}
+
+		if v := yesOrNo(line); v != nil {
+			return v
+		}
+	}
+}
+
+/*
+ * Read a line from the terminal tty, until the deadline, if it is not
+ * zero, or until t is interrupted. While t is suspended, it does not read.
+ */
+func readTerminalLine(t *Task, tty *os.File, deadline time.Time) (string, error) {
+	line := []byte{}
+	b := make([]byte, 1)
+	for {
+		if !t.Runnable() || t.Stack == Null ||
+			atomic.LoadInt32(&t.interrupted) != 0 {
+			return "", errors.New("interrupted")
+		}
+
+		next := time.Now().Add(pollInterval)
+		if !deadline.IsZero() && deadline.Before(next) {
+			next = deadline
+		}
+		tty.SetReadDeadline(next)
+
+		n, err := tty.Read(b)
+		if n > 0 {
+			if b[0] == '\n' {
+				return string(line), nil
+			}
+			line = append(line, b[0])
+
+			continue
+		}
+
+		if !errors.Is(err, os.ErrDeadlineExceeded) {
+			return "", err
+		}
+
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			return "", errors.New("confirm: timed out")
+		}
+	}
+}
+
+/* Return true for yes, false for no, or nil for anything else. */
+func yesOrNo(s string) Cell {
+	switch strings.ToLower(s) {
+	case "y", "yes", "true":
+		return True
+	case "n", "no", "false":
+		return False
+	}
+
+	return nil
+}
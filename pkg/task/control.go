@@ -0,0 +1,237 @@
+// Released under an MIT-style license. See LICENSE.
+
+package task
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	. "github.com/michaelmacinnis/oh/pkg/cell"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"sync"
+)
+
+/*
+ * With -control, oh is driven by another program rather than by a user.
+ * It reads requests from its standard input, if given -, or from
+ * connections to the Unix domain socket that it creates at the path
+ * given, and writes a response to each. A request, or response, is a
+ * JSON object preceded by its length, in bytes, as a 4-byte big-endian
+ * integer. A request holds the command text to evaluate, and an id that
+ * is returned with the response:
+ *
+ *     {"id": 1, "command": "echo hello; list 1 2"}
+ *
+ * The response holds the value of the last command, converted to JSON,
+ * what the commands wrote to their standard output and error, and the
+ * status of the last command:
+ *
+ *     {"id": 1, "value": ["1", "2"], "output": "hello\n", "errors": "",
+ *      "status": 0}
+ *
+ * Requests are evaluated one at a time, in the order that they arrive, in
+ * a single session, so that a definition made by one request is seen by
+ * the next. Commands read their standard input from /dev/null. When a
+ * command exits the shell, oh writes the response and exits.
+ */
+
+/* The largest request, in bytes, that oh will read. */
+const maxRequest = 1 << 24
+
+type request struct {
+	ID      interface{} `json:"id"`
+	Command string      `json:"command"`
+}
+
+type response struct {
+	ID     interface{} `json:"id"`
+	Value  interface{} `json:"value"`
+	Output string      `json:"output"`
+	Errors string      `json:"errors"`
+	Status int         `json:"status"`
+}
+
+/* Serve requests on the standard input, or at the socket named by path. */
+func control(eval func(Cell), path string) int {
+	var m sync.Mutex
+
+	serve := func(r io.Reader, w io.Writer) error {
+		b := bufio.NewReader(r)
+		for {
+			q := request{}
+			if err := receive(b, &q); err != nil {
+				return err
+			}
+
+			m.Lock()
+			p := respond(eval, q)
+			m.Unlock()
+
+			if err := send(w, p); err != nil {
+				return err
+			}
+
+			if task0.Stack == Null {
+				if path != "-" {
+					os.Remove(path)
+				}
+				os.Exit(p.Status)
+			}
+		}
+	}
+
+	if path == "-" {
+		if err := serve(os.Stdin, os.Stdout); err != io.EOF {
+			fmt.Fprintf(os.Stderr, "oh: %v\n", err)
+			return 1
+		}
+
+		return 0
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "oh: %v\n", err)
+		return 1
+	}
+	defer l.Close()
+
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "oh: %v\n", err)
+			return 1
+		}
+
+		go func() {
+			defer c.Close()
+
+			serve(c, c)
+		}()
+	}
+}
+
+/* Read a length-prefixed JSON value from r into v. */
+func receive(r io.Reader, v interface{}) error {
+	var n uint32
+	if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+		return err
+	}
+
+	if n > maxRequest {
+		return fmt.Errorf("request too large: %d bytes", n)
+	}
+
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, v)
+}
+
+/*
+ * Evaluate the commands in q, with their standard output and error
+ * captured, and return the response.
+ */
+func respond(eval func(Cell), q request) response {
+	p := response{ID: q.ID, Value: []interface{}{}}
+
+	commands := []Cell{}
+	r := bufio.NewReader(strings.NewReader(q.Command + "\n"))
+	if !parse(nil, r, deref, func(c Cell) { commands = append(commands, c) }) {
+		p.Errors = "oh: error/syntax: invalid syntax\n"
+		p.Status = 1
+
+		return p
+	}
+
+	null, err := os.Open(os.DevNull)
+	if err != nil {
+		p.Errors = "oh: " + err.Error() + "\n"
+		p.Status = 1
+
+		return p
+	}
+
+	stdout := NewPipe(scope0, nil, nil).(*Pipe)
+	stderr := NewPipe(scope0, nil, nil).(*Pipe)
+
+	var wg sync.WaitGroup
+	capture := func(s *string, c *Pipe) {
+		b, _ := ioutil.ReadAll(c.ReadFd())
+		*s = string(b)
+
+		c.ReaderClose()
+		wg.Done()
+	}
+
+	wg.Add(2)
+	go capture(&p.Output, stdout)
+	go capture(&p.Errors, stderr)
+
+	bound := map[string]Cell{
+		"$stdin":  NewPipe(scope0, null, nil),
+		"$stdout": stdout,
+		"$stderr": stderr,
+	}
+
+	saved := map[string]Cell{}
+	for k, v := range bound {
+		if r := env0.Access(NewSymbol(k)); r != nil {
+			saved[k] = r.Get()
+		}
+		env0.Add(NewSymbol(k), v)
+	}
+
+	for _, c := range commands {
+		eval(c)
+
+		if task0.Stack == Null {
+			break
+		}
+	}
+
+	for k, v := range saved {
+		env0.Add(NewSymbol(k), v)
+	}
+
+	toConduit(bound["$stdin"].(Context)).Close()
+	stdout.WriterClose()
+	stderr.WriterClose()
+
+	wg.Wait()
+
+	v := task0.result
+	if task0.Stack == Null {
+		v = Car(task0.Scratch)
+		p.Status = status(v)
+	} else if r := env0.Access(NewSymbol("$?")); r != nil {
+		p.Status = status(r.Get())
+	}
+
+	p.Value = jsonValue(v, map[Cell]bool{})
+
+	return p
+}
+
+/* Write v, as JSON, to w, preceded by its length. */
+func send(w io.Writer, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	if err = binary.Write(w, binary.BigEndian, uint32(len(b))); err != nil {
+		return err
+	}
+
+	_, err = w.Write(b)
+
+	return err
+}
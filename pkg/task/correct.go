@@ -0,0 +1,166 @@
+// Released under an MIT-style license. See LICENSE.
+
+package task
+
+import (
+	"bufio"
+	"fmt"
+	. "github.com/michaelmacinnis/oh/pkg/cell"
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+/*
+ * When a command cannot be found, the error suggests the commands on $PATH
+ * and the methods in scope whose names are within two edits (insertions,
+ * deletions or substitutions of a character, or transpositions of two
+ * adjacent characters) of its name. If the correct
+ * option is true, and oh is interactive, oh instead offers to run the
+ * closest command on $PATH, and runs it if the answer begins with y.
+ * Suggestions are only made for commands run locally.
+ */
+
+/* The greatest edit distance, and number, of the suggestions made. */
+const (
+	maxDistance    = 2
+	maxSuggestions = 3
+)
+
+/*
+ * Return the path of a correction for the command name, which cannot be
+ * found, if the user accepts it. Otherwise panic with problem and any
+ * suggestions.
+ */
+func (t *Task) correct(name string, problem error) string {
+	if _, ok := t.runner().(local); !ok || strings.ContainsRune(name, '/') {
+		panic("error/runtime: " + problem.Error())
+	}
+
+	s := t.suggestions(name)
+	if len(s) == 0 {
+		panic("error/runtime: " + problem.Error())
+	}
+
+	if t.Option("correct").Bool() && interactive &&
+		IsTerminal(os.Stdin.Fd()) && IsTerminal(os.Stderr.Fd()) {
+		for _, c := range s {
+			arg0, err := t.runner().LookPath(c)
+			if err != nil {
+				continue
+			}
+
+			fmt.Fprintf(os.Stderr, "oh: correct %s to %s? [y/n] ", name, c)
+			answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+			if strings.HasPrefix(strings.TrimSpace(answer), "y") {
+				return arg0
+			}
+
+			break
+		}
+	}
+
+	if len(s) > 1 {
+		last := len(s) - 1
+		s = append(s[:last-1], s[last-1]+" or "+s[last])
+	}
+
+	msg := problem.Error() + " (did you mean " + strings.Join(s, ", ") + "?)"
+	panic("error/runtime: " + msg)
+}
+
+/*
+ * Return the number of single character edits, or transpositions of
+ * adjacent characters, that turn a into b.
+ */
+func distance(a, b string) int {
+	s, u := []rune(a), []rune(b)
+
+	d := make([][]int, len(s)+1)
+	for i := range d {
+		d[i] = make([]int, len(u)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+
+	for i := 1; i <= len(s); i++ {
+		for j := 1; j <= len(u); j++ {
+			cost := 1
+			if s[i-1] == u[j-1] {
+				cost = 0
+			}
+
+			n := d[i-1][j-1] + cost
+			if d[i-1][j]+1 < n {
+				n = d[i-1][j] + 1
+			}
+			if d[i][j-1]+1 < n {
+				n = d[i][j-1] + 1
+			}
+			if i > 1 && j > 1 && s[i-1] == u[j-2] && s[i-2] == u[j-1] {
+				if d[i-2][j-2]+1 < n {
+					n = d[i-2][j-2] + 1
+				}
+			}
+
+			d[i][j] = n
+		}
+	}
+
+	return d[len(s)][len(u)]
+}
+
+/*
+ * Return the closest commands on $PATH, and methods in scope, to name,
+ * nearest first.
+ */
+func (t *Task) suggestions(name string) []string {
+	candidates := executables()
+	for _, k := range append(t.Lexical.Complete(""), t.Dynamic.Complete("")...) {
+		if strings.HasPrefix(k, "$") {
+			continue
+		}
+
+		r := Resolve(t.Lexical, t.Dynamic, NewSymbol(k))
+		if r == nil {
+			continue
+		}
+
+		if _, ok := r.Get().(Binding); ok {
+			candidates = append(candidates, k)
+		}
+	}
+
+	distances := map[string]int{}
+	for _, c := range candidates {
+		n := utf8.RuneCountInString(c) - utf8.RuneCountInString(name)
+		if n > maxDistance || -n > maxDistance {
+			continue
+		}
+
+		if d := distance(name, c); d <= maxDistance && d > 0 {
+			distances[c] = d
+		}
+	}
+
+	s := make([]string, 0, len(distances))
+	for c := range distances {
+		s = append(s, c)
+	}
+
+	sort.Slice(s, func(i, j int) bool {
+		if distances[s[i]] != distances[s[j]] {
+			return distances[s[i]] < distances[s[j]]
+		}
+		return s[i] < s[j]
+	})
+
+	if len(s) > maxSuggestions {
+		s = s[:maxSuggestions]
+	}
+
+	return s
+}
@@ -8,6 +8,13 @@ import (
 )
 
 func deref(name string, address uintptr) Cell {
+	/* In deterministic mode, most cells are written with a number. */
+	if deterministic {
+		if c := identified(address); c != nil {
+			return c
+		}
+	}
+
 	switch {
 	case name == "bound":
 		return (*Bound)(unsafe.Pointer(address))
@@ -23,20 +30,30 @@ func deref(name string, address uintptr) Cell {
 		return (*Env)(unsafe.Pointer(address))
 	case name == "method":
 		return (*Method)(unsafe.Pointer(address))
+	case name == "mutex":
+		return (*Mutex)(unsafe.Pointer(address))
 	case name == "object":
 		return (*Object)(unsafe.Pointer(address))
 	case name == "pipe":
 		return (*Pipe)(unsafe.Pointer(address))
 	case name == "scope":
 		return (*Scope)(unsafe.Pointer(address))
+	case name == "semaphore":
+		return (*Semaphore)(unsafe.Pointer(address))
+	case name == "super":
+		return (*Super)(unsafe.Pointer(address))
 	case name == "syntax":
 		return (*Syntax)(unsafe.Pointer(address))
 	case name == "task":
 		return (*Task)(unsafe.Pointer(address))
+	case name == "ticker", name == "timer":
+		return (*Timer)(unsafe.Pointer(address))
 	case name == "unbound":
 		return (*Unbound)(unsafe.Pointer(address))
 	case name == "variable":
 		return (*Variable)(unsafe.Pointer(address))
+	case name == "wait-group":
+		return (*WaitGroup)(unsafe.Pointer(address))
 	}
 
 	return Null
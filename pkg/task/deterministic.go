@@ -0,0 +1,125 @@
+// Released under an MIT-style license. See LICENSE.
+
+package task
+
+import (
+	"fmt"
+	. "github.com/michaelmacinnis/oh/pkg/cell"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+/*
+ * In deterministic mode, random numbers are generated from a fixed seed,
+ * the clock is frozen at the epoch until set with set-clock, and cells
+ * that would otherwise be written with their address are numbered in the
+ * order they are first written, so that the output of a script is the
+ * same from one run to the next.
+ */
+
+var deterministic bool
+
+var clock struct {
+	sync.Mutex
+	frozen bool
+	time   time.Time
+}
+
+var identities struct {
+	sync.Mutex
+	cells   []Cell
+	numbers map[Cell]int
+}
+
+var random struct {
+	sync.Mutex
+	*rand.Rand
+}
+
+func init() {
+	random.Rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+}
+
+/* Deterministic seeds random numbers and freezes the clock. */
+func Deterministic() {
+	deterministic = true
+
+	identities.numbers = map[Cell]int{}
+
+	random.Lock()
+	random.Rand = rand.New(rand.NewSource(1))
+	random.Unlock()
+
+	setClock(time.Unix(0, 0))
+}
+
+/* Return the cell numbered n by identify, or nil if there is none. */
+func identified(n uintptr) Cell {
+	identities.Lock()
+	defer identities.Unlock()
+
+	if n < 1 || n > uintptr(len(identities.cells)) {
+		return nil
+	}
+
+	return identities.cells[n-1]
+}
+
+/* Return the identity of c, a cell of the named kind, as written. */
+func identify(kind string, c Cell) string {
+	if !deterministic {
+		return fmt.Sprintf("%%%s %p%%", kind, c)
+	}
+
+	identities.Lock()
+	defer identities.Unlock()
+
+	n, ok := identities.numbers[c]
+	if !ok {
+		identities.cells = append(identities.cells, c)
+		n = len(identities.cells)
+		identities.numbers[c] = n
+	}
+
+	return fmt.Sprintf("%%%s %d%%", kind, n)
+}
+
+func now() time.Time {
+	clock.Lock()
+	defer clock.Unlock()
+
+	if clock.frozen {
+		return clock.time
+	}
+
+	return time.Now()
+}
+
+func randomFloat() float64 {
+	random.Lock()
+	defer random.Unlock()
+
+	return random.Float64()
+}
+
+/* Return a random integer in [0, n). */
+func randomInteger(n int64) int64 {
+	random.Lock()
+	defer random.Unlock()
+
+	return random.Int63n(n)
+}
+
+/* Freeze the clock at tm. */
+func setClock(tm time.Time) {
+	clock.Lock()
+	defer clock.Unlock()
+
+	clock.frozen = true
+	clock.time = tm
+}
+
+func since(tm time.Time) time.Duration {
+	return now().Sub(tm)
+}
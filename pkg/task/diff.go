@@ -0,0 +1,384 @@
+// Released under an MIT-style license. See LICENSE.
+
+package task
+
+import (
+	"fmt"
+	. "github.com/michaelmacinnis/oh/pkg/cell"
+	"sort"
+	"strings"
+)
+
+/*
+ * The diff-lines command compares two texts, each a string, which is split
+ * into lines, or a list of lines, and the diff-cells command compares two
+ * values, element by element for lists, and member by member for objects.
+ * Both return a patch, an object with the members:
+ *
+ *     edits             the changes, each a list of "-" or "+", where the
+ *                       change was made, and the value removed or added
+ *     render [context]  the changes, as text, in color if $stdout is a
+ *                       terminal
+ *     same?             true if there are no changes
+ *
+ * For diff-lines, where a change was made is the number of the line in
+ * the first text, for a line removed, or in the second, for a line added,
+ * and render writes the changes as a unified diff, with context lines, 3
+ * by default, around each. For diff-cells, it is the path, a list of
+ * indexes and member names, to the value changed, and a value that has
+ * changed is both removed and added. The longest sequence of unchanged
+ * lines, or elements, is kept, as found by Myers's algorithm.
+ */
+
+/* A step in turning one sequence into another. */
+type step struct {
+	op   byte
+	a, b int
+}
+
+/* Return a patch object for the changes in edits, written by render. */
+func patch(edits []Cell, render func(out Cell, context int) string) Cell {
+	s := NewScope(scope0, nil)
+	s.Public(NewSymbol("edits"), List(edits...))
+	s.PublicMethod("render", func(t *Task, args Cell) bool {
+		context := 3
+		if args != Null {
+			context = int(Car(args).(Atom).Int())
+		}
+
+		out := Resolve(t.Lexical, t.Dynamic, NewSymbol("$stdout")).Get()
+
+		return t.Return(NewString(t, render(out, context)))
+	})
+	s.PublicMethod("same?", func(t *Task, args Cell) bool {
+		return t.Return(NewBoolean(len(edits) == 0))
+	})
+
+	return NewObject(s)
+}
+
+/* Return the edit that removes, or adds, v at path. */
+func change(t *Task, op string, path, v Cell) Cell {
+	return List(NewString(t, op), path, v)
+}
+
+/* Return the changes, with their paths, that turn a into b. */
+func diffCells(t *Task, a, b Cell) Cell {
+	edits := []Cell{}
+
+	var walk func(path []Cell, a, b Cell)
+	walk = func(path []Cell, a, b Cell) {
+		at := func(k Cell) []Cell {
+			return append(append([]Cell{}, path...), k)
+		}
+		index := func(i int) []Cell {
+			return at(NewInteger(int64(i)))
+		}
+
+		if isList(a) && isList(b) {
+			x, y := elements(a), elements(b)
+
+			/* Compare what replaced each run of removed elements. */
+			removed, added := []int{}, []int{}
+			flush := func() {
+				n := 0
+				for ; n < len(removed) && n < len(added); n++ {
+					i, j := removed[n], added[n]
+					walk(index(i), x[i], y[j])
+				}
+				for _, i := range removed[n:] {
+					edits = append(edits, change(t, "-", List(index(i)...), x[i]))
+				}
+				for _, j := range added[n:] {
+					edits = append(edits, change(t, "+", List(index(j)...), y[j]))
+				}
+				removed, added = removed[:0], added[:0]
+			}
+
+			eq := func(i, j int) bool {
+				return equal(x[i], y[j])
+			}
+			for _, s := range steps(len(x), len(y), eq) {
+				switch s.op {
+				case '-':
+					removed = append(removed, s.a)
+				case '+':
+					added = append(added, s.b)
+				default:
+					flush()
+				}
+			}
+			flush()
+
+			return
+		}
+
+		if o, ok := a.(*Object); ok {
+			if p, ok := b.(*Object); ok {
+				x, y := fields(o), fields(p)
+
+				names := []string{}
+				for k := range x {
+					names = append(names, k)
+				}
+				for k := range y {
+					if _, ok := x[k]; !ok {
+						names = append(names, k)
+					}
+				}
+				sort.Strings(names)
+
+				for _, k := range names {
+					v, inA := x[k]
+					w, inB := y[k]
+
+					if !inB {
+						edits = append(edits, change(t, "-", List(at(NewSymbol(k))...), v))
+					} else if !inA {
+						edits = append(edits, change(t, "+", List(at(NewSymbol(k))...), w))
+					} else {
+						walk(at(NewSymbol(k)), v, w)
+					}
+				}
+
+				return
+			}
+		}
+
+		if !equal(a, b) {
+			edits = append(edits,
+				change(t, "-", List(path...), a),
+				change(t, "+", List(path...), b))
+		}
+	}
+
+	walk(nil, a, b)
+
+	return patch(edits, func(out Cell, context int) string {
+		l := []string{}
+		for _, e := range edits {
+			op := raw(Car(e))
+			line := op + " " + serialize(Cadr(e)) + " " + serialize(Caddr(e))
+			l = append(l, painted(out, op, line))
+		}
+
+		return strings.Join(l, "\n")
+	})
+}
+
+/* Return the changes, with line numbers, that turn a into b. */
+func diffLines(t *Task, a, b Cell) Cell {
+	x, y := textLines(a), textLines(b)
+
+	ss := steps(len(x), len(y), func(i, j int) bool {
+		return x[i] == y[j]
+	})
+
+	edits := []Cell{}
+	for _, s := range ss {
+		switch s.op {
+		case '-':
+			n := NewInteger(int64(s.a + 1))
+			edits = append(edits, change(t, "-", n, NewString(t, x[s.a])))
+		case '+':
+			n := NewInteger(int64(s.b + 1))
+			edits = append(edits, change(t, "+", n, NewString(t, y[s.b])))
+		}
+	}
+
+	return patch(edits, func(out Cell, context int) string {
+		return unified(out, ss, x, y, context)
+	})
+}
+
+/* Return the public members of o, by name. */
+func fields(o *Object) map[string]Cell {
+	m := map[string]Cell{}
+	for _, c := range members(o) {
+		m[raw(Car(c))] = Cdr(c)
+	}
+
+	return m
+}
+
+/* Return the lines in c, a list of lines or text split at each newline. */
+func textLines(c Cell) []string {
+	if isList(c) {
+		l := []string{}
+		for _, e := range elements(c) {
+			l = append(l, raw(e))
+		}
+
+		return l
+	}
+
+	s := strings.TrimSuffix(raw(c), "\n")
+	if s == "" {
+		return []string{}
+	}
+
+	return strings.Split(s, "\n")
+}
+
+/* Return line, in red if op is "-", or green if "+", if out is a terminal. */
+func painted(out Cell, op, line string) string {
+	if !terminal(out) {
+		return line
+	}
+
+	switch op {
+	case "-":
+		return ansiRed + line + ansiReset
+	case "+":
+		return ansiGreen + line + ansiReset
+	case "@":
+		return ansiCyan + line + ansiReset
+	}
+
+	return line
+}
+
+/*
+ * Return the shortest sequence of steps, each '-' to remove the a-th
+ * element of the first sequence, '+' to add the b-th of the second or '='
+ * to keep both, that turns a sequence of n elements into one of m.
+ */
+func steps(n, m int, eq func(i, j int) bool) []step {
+	max := n + m
+	offset := max + 1
+
+	v := make([]int, 2*max+3)
+	trace := [][]int{}
+
+	for d := 0; d <= max; d++ {
+		trace = append(trace, append([]int{}, v...))
+
+		done := false
+		for k := -d; k <= d && !done; k += 2 {
+			x := 0
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+
+			y := x - k
+			for x < n && y < m && eq(x, y) {
+				x++
+				y++
+			}
+
+			v[offset+k] = x
+
+			done = x >= n && y >= m
+		}
+
+		if done {
+			break
+		}
+	}
+
+	l := []step{}
+
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+
+		prev := k - 1
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prev = k + 1
+		}
+
+		px := v[offset+prev]
+		py := px - prev
+
+		for x > px && y > py {
+			x--
+			y--
+			l = append(l, step{'=', x, y})
+		}
+
+		if d > 0 {
+			if x == px {
+				l = append(l, step{'+', x, py})
+			} else {
+				l = append(l, step{'-', px, y})
+			}
+		}
+
+		x, y = px, py
+	}
+
+	for i, j := 0, len(l)-1; i < j; i, j = i+1, j-1 {
+		l[i], l[j] = l[j], l[i]
+	}
+
+	return l
+}
+
+/* Return the steps ss, that turn x into y, as a unified diff. */
+func unified(out Cell, ss []step, x, y []string, context int) string {
+	l := []string{}
+
+	for i := 0; i < len(ss); {
+		if ss[i].op == '=' {
+			i++
+			continue
+		}
+
+		/* Extend the hunk until there are no changes within 2*context. */
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+
+		end := i
+		for n := i; n < len(ss) && n-end <= 2*context; n++ {
+			if ss[n].op != '=' {
+				end = n
+			}
+		}
+
+		stop := end + context + 1
+		if stop > len(ss) {
+			stop = len(ss)
+		}
+
+		la, lb := 0, 0
+		for _, st := range ss[start:stop] {
+			if st.op != '+' {
+				la++
+			}
+			if st.op != '-' {
+				lb++
+			}
+		}
+
+		fa, fb := ss[start].a+1, ss[start].b+1
+		if la == 0 {
+			fa--
+		}
+		if lb == 0 {
+			fb--
+		}
+
+		header := fmt.Sprintf("@@ -%d,%d +%d,%d @@", fa, la, fb, lb)
+		l = append(l, painted(out, "@", header))
+
+		for _, st := range ss[start:stop] {
+			switch st.op {
+			case '-':
+				l = append(l, painted(out, "-", "-"+x[st.a]))
+			case '+':
+				l = append(l, painted(out, "+", "+"+y[st.b]))
+			default:
+				l = append(l, " "+x[st.a])
+			}
+		}
+
+		i = stop
+	}
+
+	return strings.Join(l, "\n")
+}
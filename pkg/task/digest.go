@@ -0,0 +1,169 @@
+// Released under an MIT-style license. See LICENSE.
+
+package task
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	gohash "hash"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+/*
+ * The checksum-file command returns the checksum of a file, in hex, using
+ * the algorithm named, md5, sha1, sha256 (the default) or sha512. The file
+ * is read a block at a time, so it can be larger than memory, and reading
+ * it can be interrupted.
+ *
+ * The verify-checksums command reads a list of checksums, in the format
+ * written by sha256sum and the like, a checksum and a path on each line:
+ *
+ *     e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855  empty
+ *
+ * and checks each file, several at once. The algorithm is chosen by the
+ * length of the checksum. It returns true if every file matches, and
+ * otherwise an error naming those that do not.
+ */
+
+/* Hash functions, by name. */
+var digests = map[string]func() gohash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+/* The names of the hash functions, by the length of their checksums in hex. */
+var digestLengths = map[int]string{
+	32:  "md5",
+	40:  "sha1",
+	64:  "sha256",
+	128: "sha512",
+}
+
+/* Return the checksum, in hex, of the file at path. */
+func (t *Task) digest(path string, h gohash.Hash) (string, error) {
+	f, err := os.Open(resolvePath(t, path))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	b := make([]byte, 1<<16)
+	for {
+		if atomic.LoadInt32(&t.interrupted) != 0 {
+			return "", &os.PathError{
+				Op:   "read",
+				Path: path,
+				Err:  errors.New("interrupted"),
+			}
+		}
+
+		n, err := f.Read(b)
+		h.Write(b[:n])
+
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return "", err
+		}
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+/* Return the checksum, in hex, of the file at path, using algorithm. */
+func checksumFile(t *Task, path, algorithm string) (string, error) {
+	f, ok := digests[strings.ToLower(algorithm)]
+	if !ok {
+		panic("error/runtime: unknown checksum algorithm: " + algorithm)
+	}
+
+	return t.digest(path, f())
+}
+
+/* Check each file in the list at path against its checksum. */
+func verifyChecksums(t *Task, path string) error {
+	f, err := os.Open(resolvePath(t, path))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	type entry struct {
+		sum, path string
+		failure   string
+	}
+
+	entries := []*entry{}
+
+	s := bufio.NewScanner(f)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.SplitN(line, " ", 2)
+		if len(fields) != 2 || digestLengths[len(fields[0])] == "" {
+			return fmt.Errorf("%s:%d: invalid checksum line", path, n)
+		}
+
+		name := strings.TrimPrefix(strings.TrimPrefix(fields[1], " "), "*")
+		sum := strings.ToLower(fields[0])
+		entries = append(entries, &entry{sum: sum, path: name})
+	}
+	if err = s.Err(); err != nil {
+		return err
+	}
+
+	work := make(chan *entry)
+
+	var wg sync.WaitGroup
+	for i := 0; i < runtime.NumCPU(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for e := range work {
+				h := digests[digestLengths[len(e.sum)]]()
+				if sum, err := t.digest(e.path, h); err != nil {
+					e.failure = err.Error()
+				} else if sum != e.sum {
+					e.failure = e.path + ": checksum does not match"
+				}
+			}
+		}()
+	}
+
+	for _, e := range entries {
+		work <- e
+	}
+	close(work)
+
+	wg.Wait()
+
+	failures := []string{}
+	for _, e := range entries {
+		if e.failure != "" {
+			failures = append(failures, e.failure)
+		}
+	}
+
+	if len(failures) > 0 {
+		return errors.New(strings.Join(failures, "; "))
+	}
+
+	return nil
+}
@@ -0,0 +1,72 @@
+// Released under an MIT-style license. See LICENSE.
+
+package task
+
+import (
+	. "github.com/michaelmacinnis/oh/pkg/cell"
+)
+
+/*
+ * The disk-usage command returns an object describing the file system
+ * that holds a path, the current directory by default, with the members:
+ *
+ *     total      its size, in bytes
+ *     free       the bytes not in use
+ *     used       the bytes in use, total less free
+ *     available  the bytes free that can be used by those without
+ *                privileges, which can be fewer than free
+ *
+ * The mounts command returns an object for each file system mounted, with
+ * the members device, path (where it is mounted), type and options (a
+ * list). The mount table is read from /proc on Linux and by getfsstat on
+ * BSD and macOS, where options only says whether the file system is
+ * read-only (ro) or not (rw).
+ */
+
+/* A MountInfo describes a mounted file system. */
+type MountInfo struct {
+	Device, Path, Type string
+	Options            []string
+}
+
+/* Return an object describing the file system that holds path. */
+func diskUsage(t *Task, path string) Cell {
+	total, free, available, err := DiskUsage(resolvePath(t, path))
+	if err != nil {
+		return NewError(t, err)
+	}
+
+	s := NewScope(scope0, nil)
+	s.Public(NewSymbol("available"), NewInteger(int64(available)))
+	s.Public(NewSymbol("free"), NewInteger(int64(free)))
+	s.Public(NewSymbol("total"), NewInteger(int64(total)))
+	s.Public(NewSymbol("used"), NewInteger(int64(total-free)))
+
+	return NewObject(s)
+}
+
+/* Return an object for each mounted file system. */
+func mounts(t *Task) Cell {
+	ms, err := Mounts()
+	if err != nil {
+		return NewError(t, err)
+	}
+
+	l := []Cell{}
+	for _, m := range ms {
+		options := []Cell{}
+		for _, o := range m.Options {
+			options = append(options, NewString(t, o))
+		}
+
+		s := NewScope(scope0, nil)
+		s.Public(NewSymbol("device"), NewString(t, m.Device))
+		s.Public(NewSymbol("options"), List(options...))
+		s.Public(NewSymbol("path"), NewString(t, m.Path))
+		s.Public(NewSymbol("type"), NewString(t, m.Type))
+
+		l = append(l, NewObject(s))
+	}
+
+	return List(l...)
+}
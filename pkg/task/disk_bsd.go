@@ -0,0 +1,58 @@
+// Released under an MIT-style license. See LICENSE.
+
+// +build darwin dragonfly freebsd
+
+package task
+
+import (
+	"syscall"
+)
+
+/* The getfsstat flag, and file system flag, used from sys/mount.h. */
+const (
+	mntNowait = 2
+	mntRdonly = 1
+)
+
+/* Return the mounted file systems, as read by getfsstat. */
+func Mounts() ([]MountInfo, error) {
+	n, err := syscall.Getfsstat(nil, mntNowait)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := make([]syscall.Statfs_t, n)
+	if n, err = syscall.Getfsstat(buf, mntNowait); err != nil {
+		return nil, err
+	}
+
+	l := []MountInfo{}
+	for _, st := range buf[:n] {
+		options := []string{"rw"}
+		if st.Flags&mntRdonly != 0 {
+			options[0] = "ro"
+		}
+
+		l = append(l, MountInfo{
+			Device:  cstring(st.Mntfromname[:]),
+			Path:    cstring(st.Mntonname[:]),
+			Type:    cstring(st.Fstypename[:]),
+			Options: options,
+		})
+	}
+
+	return l, nil
+}
+
+/* Return the characters in s up to the first zero. */
+func cstring(s []int8) string {
+	b := make([]byte, 0, len(s))
+	for _, c := range s {
+		if c == 0 {
+			break
+		}
+		b = append(b, byte(c))
+	}
+
+	return string(b)
+}
@@ -0,0 +1,57 @@
+// Released under an MIT-style license. See LICENSE.
+
+package task
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+)
+
+/* Return the mounted file systems, as read from /proc/self/mounts. */
+func Mounts() ([]MountInfo, error) {
+	f, err := os.Open("/proc/self/mounts")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	l := []MountInfo{}
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) < 4 {
+			continue
+		}
+
+		l = append(l, MountInfo{
+			Device:  unescapeMount(fields[0]),
+			Path:    unescapeMount(fields[1]),
+			Type:    fields[2],
+			Options: strings.Split(fields[3], ","),
+		})
+	}
+
+	return l, s.Err()
+}
+
+/* Return s with each octal escape, like \040 for a space, replaced. */
+func unescapeMount(s string) string {
+	b := []byte{}
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+4 <= len(s) {
+			if n, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b = append(b, byte(n))
+				i += 3
+
+				continue
+			}
+		}
+
+		b = append(b, s[i])
+	}
+
+	return string(b)
+}
@@ -0,0 +1,17 @@
+// Released under an MIT-style license. See LICENSE.
+
+// +build !linux,!darwin,!dragonfly,!freebsd
+
+package task
+
+import (
+	"errors"
+)
+
+func DiskUsage(path string) (total, free, available uint64, err error) {
+	return 0, 0, 0, errors.New("Not implemented")
+}
+
+func Mounts() ([]MountInfo, error) {
+	return nil, errors.New("Not implemented")
+}
@@ -0,0 +1,22 @@
+// Released under an MIT-style license. See LICENSE.
+
+// +build linux darwin dragonfly freebsd
+
+package task
+
+import (
+	"syscall"
+)
+
+/* Return the total, free and available bytes in the file system at path. */
+func DiskUsage(path string) (total, free, available uint64, err error) {
+	st := syscall.Statfs_t{}
+	if err = syscall.Statfs(path, &st); err != nil {
+		return
+	}
+
+	size := uint64(st.Bsize)
+
+	return uint64(st.Blocks) * size, uint64(st.Bfree) * size,
+		uint64(st.Bavail) * size, nil
+}
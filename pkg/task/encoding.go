@@ -0,0 +1,60 @@
+// Released under an MIT-style license. See LICENSE.
+
+package task
+
+import (
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/unicode"
+	"strings"
+)
+
+/*
+ * Text is converted between UTF-8, which oh uses, and other character
+ * encodings by the string methods encode, which returns a buffer holding
+ * the encoded text, and decode, which treats the bytes of a string, read
+ * from a file produced by another system, for example, as encoded text.
+ * A buffer's to-string method also decodes its bytes.
+ *
+ * UTF-16 is big-endian unless the text begins with a byte order mark.
+ */
+
+var encodings = map[string]encoding.Encoding{
+	"latin-1":    charmap.ISO8859_1,
+	"iso-8859-1": charmap.ISO8859_1,
+	"shift-jis":  japanese.ShiftJIS,
+	"utf-16":     unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM),
+	"utf-16be":   unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM),
+	"utf-16le":   unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM),
+	"utf-8":      unicode.UTF8,
+}
+
+/* Return the bytes b, encoded as name, decoded as UTF-8. */
+func decode(b []byte, name string) string {
+	d, err := lookupEncoding(name).NewDecoder().Bytes(b)
+	if err != nil {
+		panic("error/runtime: cannot decode " + name + ": " + err.Error())
+	}
+
+	return string(d)
+}
+
+/* Return the UTF-8 text s encoded as name. */
+func encode(s, name string) []byte {
+	e, err := lookupEncoding(name).NewEncoder().Bytes([]byte(s))
+	if err != nil {
+		panic("error/runtime: cannot encode " + name + ": " + err.Error())
+	}
+
+	return e
+}
+
+func lookupEncoding(name string) encoding.Encoding {
+	e, ok := encodings[strings.ToLower(name)]
+	if !ok {
+		panic("error/runtime: unknown encoding: " + name)
+	}
+
+	return e
+}
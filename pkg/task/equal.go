@@ -0,0 +1,237 @@
+// Released under an MIT-style license. See LICENSE.
+
+package task
+
+import (
+	. "github.com/michaelmacinnis/oh/pkg/cell"
+	"hash/fnv"
+	"math/big"
+)
+
+/*
+ * Two values are equal? if they have the same structure: lists are equal?
+ * if their elements are, and objects are equal? if they have the same
+ * public members with equal? values. Strings and symbols are equal? if
+ * their text is the same, and numbers, whether written as integers,
+ * floats, rationals or text, if they have the same value. Buffers are
+ * equal? if they hold the same bytes, and records of the same type if
+ * their fields are equal?. Anything else (a method, channel, pipe or
+ * task) is only equal? to itself.
+ *
+ * Values that are equal? have the same hash, so that lists and objects
+ * can be used as keys.
+ */
+
+/* A pair of objects that are being compared, or an object being hashed. */
+type visit struct {
+	a, b Context
+}
+
+/* Are a and b equal? Lists are equal if their elements are. */
+func equal(a, b Cell) bool {
+	return structural(a, b, map[visit]bool{})
+}
+
+/* Are a and b the same value? Only atoms are compared by value. */
+func identical(a, b Cell) bool {
+	if a == b {
+		return true
+	}
+
+	if kind(a) == "" || kind(a) != kind(b) {
+		return false
+	}
+
+	return structural(a, b, nil)
+}
+
+/* Return a hash of c that is the same for values that are equal. */
+func hash(c Cell) uint64 {
+	h := fnv.New64a()
+	digest(h.Write, c, map[visit]bool{})
+
+	return h.Sum64()
+}
+
+func digest(write func([]byte) (int, error), c Cell, seen map[visit]bool) {
+	switch k := kind(c); k {
+	case "":
+	case "number":
+		r, _ := numeric(c)
+		write([]byte(k + ":" + r.RatString() + "\n"))
+		return
+	default:
+		write([]byte(k + ":" + raw(c) + "\n"))
+		return
+	}
+
+	if IsCons(c) {
+		write([]byte("("))
+		for ; IsCons(c) && c != Null; c = Cdr(c) {
+			digest(write, Car(c), seen)
+		}
+		if c != Null {
+			write([]byte("."))
+			digest(write, c, seen)
+		}
+		write([]byte(")"))
+
+		return
+	}
+
+	if b, ok := c.(*Buffer); ok {
+		write([]byte("buffer:"))
+		write(b.v)
+		return
+	}
+
+	if r, ok := c.(*Record); ok {
+		write([]byte("record:" + r.kind.name + "("))
+		for _, v := range r.values {
+			digest(write, v, seen)
+		}
+		write([]byte(")"))
+		return
+	}
+
+	/* Bound methods are equal if their method and receiver are. */
+	if b, ok := c.(*Bound); ok {
+		digest(write, b.Ref(), seen)
+		if s := b.Self(); s != nil {
+			write([]byte(identify("self", s) + "\n"))
+		}
+		return
+	}
+
+	o, ok := c.(*Object)
+	if !ok {
+		write([]byte(c.String() + "\n"))
+		return
+	}
+
+	v := visit{o.Expose(), nil}
+	if seen[v] {
+		write([]byte("{}"))
+		return
+	}
+	seen[v] = true
+
+	f := o.Expose().Faces().Prev()
+	write([]byte("{"))
+	for _, k := range f.Names() {
+		if r, ok := f.get(k); ok {
+			write([]byte(k + "="))
+			digest(write, r.Get(), seen)
+		}
+	}
+	write([]byte("}"))
+}
+
+/*
+ * Return the kind of the atom c: a boolean, number, status or text. If c
+ * is not an atom, the empty string is returned.
+ */
+func kind(c Cell) string {
+	switch c.(type) {
+	case *Boolean:
+		return "boolean"
+	case *Status:
+		return "status"
+	case *String, *Symbol:
+		if _, ok := numeric(c); ok {
+			return "number"
+		}
+		return "text"
+	case Number:
+		return "number"
+	}
+
+	return ""
+}
+
+/* Return the value of c if it is a number or text that is a number. */
+func numeric(c Cell) (*big.Rat, bool) {
+	switch c := c.(type) {
+	case *String, *Symbol:
+		return new(big.Rat).SetString(raw(c))
+	case Number:
+		return c.Rat(), true
+	}
+
+	return nil, false
+}
+
+/*
+ * Are a and b equal? Objects are compared by their members only if seen
+ * is not nil. Pairs of objects in seen are already being compared.
+ */
+func structural(a, b Cell, seen map[visit]bool) bool {
+	if a == b {
+		return true
+	}
+
+	switch k := kind(a); k {
+	case "":
+	case "number":
+		if k != kind(b) {
+			return false
+		}
+		x, _ := numeric(a)
+		y, _ := numeric(b)
+		return x.Cmp(y) == 0
+	default:
+		return k == kind(b) && raw(a) == raw(b)
+	}
+
+	if IsCons(a) && IsCons(b) {
+		if a == Null || b == Null {
+			return false
+		}
+		return structural(Car(a), Car(b), seen) &&
+			structural(Cdr(a), Cdr(b), seen)
+	}
+
+	if r, ok := a.(*Record); ok {
+		o, same := b.(*Record)
+		if !same || r.kind != o.kind {
+			return false
+		}
+
+		for i, v := range r.values {
+			if !structural(v, o.values[i], seen) {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	x, ok := a.(*Object)
+	y, same := b.(*Object)
+	if !ok || !same || seen == nil {
+		return a.Equal(b)
+	}
+
+	v := visit{x.Expose(), y.Expose()}
+	if seen[v] {
+		return true
+	}
+	seen[v] = true
+
+	f, g := x.Expose().Faces().Prev(), y.Expose().Faces().Prev()
+
+	names := f.Names()
+	if len(names) != len(g.Names()) {
+		return false
+	}
+
+	for _, k := range names {
+		r, ok := f.get(k)
+		s, same := g.get(k)
+		if !ok || !same || !structural(r.Get(), s.Get(), seen) {
+			return false
+		}
+	}
+
+	return true
+}
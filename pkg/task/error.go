@@ -0,0 +1,88 @@
+// Released under an MIT-style license. See LICENSE.
+
+package task
+
+import (
+	. "github.com/michaelmacinnis/oh/pkg/cell"
+)
+
+/*
+ * An error is returned, instead of being raised, by builtins, like open,
+ * whose failure a script may want to handle. Like the status of a command
+ * that failed, an error is false, and so can be tested with if, and causes
+ * a task to exit when errexit is set. The message method returns the text
+ * of the error, and the raise method raises it.
+ */
+
+var enve *Env
+
+func errorEnv() *Env {
+	if enve != nil {
+		goto created
+	}
+
+	enve = NewEnv(nil)
+	enve.Method("child", func(t *Task, args Cell) bool {
+		panic("errors cannot be parents")
+	})
+	enve.Method("clone", func(t *Task, args Cell) bool {
+		panic("errors cannot be cloned")
+	})
+	enve.Method("define", func(t *Task, args Cell) bool {
+		panic("private members cannot be added to an error")
+	})
+	enve.Method("message", func(t *Task, args Cell) bool {
+		return t.Return(NewString(t, toError(t.Self()).msg))
+	})
+	enve.Method("raise", func(t *Task, args Cell) bool {
+		panic("error/runtime: " + toError(t.Self()).msg)
+	})
+
+created:
+	return enve
+}
+
+/* Error cell definition. */
+
+type Error struct {
+	*Scope
+	msg string
+}
+
+func IsError(c Cell) bool {
+	switch c.(type) {
+	case *Error:
+		return true
+	}
+	return false
+}
+
+func NewError(t *Task, err error) *Error {
+	return &Error{NewScope(t.Lexical.Expose(), errorEnv()), err.Error()}
+}
+
+func (e *Error) Bool() bool {
+	return false
+}
+
+func (e *Error) Equal(c Cell) bool {
+	return e == c
+}
+
+func (e *Error) Expose() Context {
+	return e
+}
+
+func (e *Error) String() string {
+	return "%error " + e.msg + "%"
+}
+
+/* Error-specific functions. */
+
+func toError(o Context) *Error {
+	if e, ok := o.(*Error); ok {
+		return e
+	}
+
+	panic("not an error")
+}
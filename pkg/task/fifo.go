@@ -0,0 +1,89 @@
+// Released under an MIT-style license. See LICENSE.
+
+package task
+
+import (
+	"errors"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+/*
+ * A named pipe (FIFO), created with mkfifo, lets oh exchange data with
+ * other processes through the file system. Opening a named pipe to read
+ * or to write waits until the other end is opened. So that only the task
+ * opening it waits, and can still be interrupted, a named pipe is opened
+ * in another goroutine. If the task is interrupted first, oh opens the
+ * other end itself, without waiting, to release the goroutine, and closes
+ * both ends.
+ */
+
+/*
+ * How often a task waiting to open a named pipe, or to read from a socket,
+ * checks for interruption.
+ */
+const pollInterval = 50 * time.Millisecond
+
+/* Open the file at path, as os.OpenFile does, unless t is interrupted. */
+func (t *Task) openFile(path string, flags int, perm os.FileMode) (*os.File, error) {
+	info, err := os.Stat(path)
+	if err != nil || info.Mode()&os.ModeNamedPipe == 0 {
+		return os.OpenFile(path, flags, perm)
+	}
+
+	type opened struct {
+		f   *os.File
+		err error
+	}
+
+	c := make(chan opened, 1)
+	go func() {
+		f, err := os.OpenFile(path, flags, perm)
+		c <- opened{f, err}
+	}()
+
+	tick := time.NewTicker(pollInterval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case o := <-c:
+			return o.f, o.err
+		case <-tick.C:
+		}
+
+		if atomic.LoadInt32(&t.interrupted) == 0 {
+			continue
+		}
+
+		other := os.O_RDONLY
+		if flags&(os.O_WRONLY|os.O_RDWR) == 0 {
+			other = os.O_WRONLY
+		}
+
+		f, _ := os.OpenFile(path, other|syscall.O_NONBLOCK, 0)
+		go func() {
+			if o := <-c; o.f != nil {
+				o.f.Close()
+			}
+			if f != nil {
+				f.Close()
+			}
+		}()
+
+		return nil, &os.PathError{
+			Op:   "open",
+			Path: path,
+			Err:  errors.New("interrupted"),
+		}
+	}
+}
+
+/* Create a named pipe at path with the permissions perm. */
+func mkfifo(t *Task, path string, perm uint32) error {
+	demand("write")
+
+	return Mkfifo(resolvePath(t, path), perm)
+}
@@ -0,0 +1,234 @@
+// Released under an MIT-style license. See LICENSE.
+
+package task
+
+import (
+	"strings"
+)
+
+/*
+ * Scripts are formatted one line at a time. Each line is indented four
+ * spaces for each earlier line with a bracket that is still open, and
+ * four more if it continues the line before it. Runs of spaces and tabs
+ * between words are replaced by a single space, trailing whitespace is
+ * removed, runs of blank lines are replaced by a single blank line and
+ * lines longer than formatWidth are broken after a pipe, && or ||.
+ * Comments and the contents of strings are left as they are.
+ */
+
+const formatWidth = 80
+
+/* Scanner states for format. */
+const (
+	fsCode = iota
+	fsComment
+	fsDoubleQuoted
+	fsDoubleQuotedEscape
+	fsSingleQuoted
+)
+
+type formatter struct {
+	b      strings.Builder
+	blank  bool
+	lineno int
+	open   []int
+	state  int
+}
+
+/* Format returns the oh script text in canonical form. */
+func Format(text string) string {
+	f := &formatter{}
+
+	continued := false
+	for _, line := range strings.Split(strings.TrimSpace(text), "\n") {
+		f.lineno++
+		continued = f.line(line, continued)
+	}
+
+	return f.b.String() + "\n"
+}
+
+/* Return the indentation level, one for each line with an open bracket. */
+func (f *formatter) level() int {
+	n := 0
+	for i, l := range f.open {
+		if i == 0 || l != f.open[i-1] {
+			n++
+		}
+	}
+
+	return n
+}
+
+/*
+ * Write line, which continues the previous line if continued is true,
+ * and return true if the line that follows continues this one.
+ */
+func (f *formatter) line(line string, continued bool) bool {
+	if f.state != fsCode {
+		text, _, continued := f.scan(line, 0)
+		f.write(text)
+		return continued
+	}
+
+	line = strings.TrimSpace(line)
+	if line == "" {
+		f.blank = f.b.Len() > 0
+		return false
+	}
+
+	if f.blank {
+		f.write("")
+		f.blank = false
+	}
+
+	/* Brackets closed at the start of the line are closed first. */
+	n := 0
+	for n < len(line) && (line[n] == ')' || line[n] == '}') {
+		if len(f.open) > 0 {
+			f.open = f.open[:len(f.open)-1]
+		}
+		n++
+	}
+
+	prefix := strings.Repeat("    ", f.level())
+	if continued {
+		prefix += "    "
+	}
+
+	text, breaks, next := f.scan(line, n)
+	for len(prefix)+len(text) > formatWidth && len(breaks) > 0 {
+		i := 0
+		for i < len(breaks)-1 && len(prefix)+breaks[i+1] <= formatWidth {
+			i++
+		}
+
+		f.write(prefix + text[:breaks[i]])
+
+		offset := breaks[i] + 1
+		text = text[offset:]
+		breaks = breaks[i+1:]
+		for j := range breaks {
+			breaks[j] -= offset
+		}
+
+		if !continued {
+			continued = true
+			prefix += "    "
+		}
+	}
+
+	f.write(prefix + text)
+
+	return next
+}
+
+/*
+ * Scan line, starting in the formatter's current state, ignoring the
+ * first skip characters as brackets. Return the line with whitespace
+ * normalized, the offsets in the result at which it may be broken, and
+ * whether the next line continues it.
+ */
+func (f *formatter) scan(line string, skip int) (string, []int, bool) {
+	b := &strings.Builder{}
+	breaks := []int{}
+	continued := false
+	depth := 0
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+
+		switch f.state {
+		case fsComment:
+			b.WriteByte(c)
+			continue
+		case fsDoubleQuoted:
+			b.WriteByte(c)
+			if c == '"' {
+				f.state = fsCode
+			} else if c == '\\' {
+				f.state = fsDoubleQuotedEscape
+			}
+			continue
+		case fsDoubleQuotedEscape:
+			b.WriteByte(c)
+			f.state = fsDoubleQuoted
+			continue
+		case fsSingleQuoted:
+			b.WriteByte(c)
+			if c == '\'' {
+				f.state = fsCode
+			}
+			continue
+		}
+
+		if c == ' ' || c == '\t' {
+			for i+1 < len(line) && (line[i+1] == ' ' || line[i+1] == '\t') {
+				i++
+			}
+			b.WriteByte(' ')
+			continue
+		}
+
+		b.WriteByte(c)
+		continued = false
+
+		switch c {
+		case '"':
+			f.state = fsDoubleQuoted
+		case '#':
+			f.state = fsComment
+		case '\'':
+			f.state = fsSingleQuoted
+		case '(', '{':
+			if i >= skip {
+				f.open = append(f.open, f.lineno)
+				depth++
+			}
+		case ')', '}':
+			if i >= skip && len(f.open) > 0 {
+				f.open = f.open[:len(f.open)-1]
+				depth--
+			}
+		case '&', '|':
+			if c == '&' && (i+1 >= len(line) || line[i+1] != '&') {
+				break
+			}
+			if i+1 < len(line) && (line[i+1] == '&' ||
+				line[i+1] == '+' || line[i+1] == '|') {
+				i++
+				b.WriteByte(line[i])
+			}
+			continued = true
+			if depth == 0 && i+1 < len(line) && line[i+1] == ' ' {
+				breaks = append(breaks, b.Len())
+			}
+		case '<', '>':
+			if i+1 < len(line) && line[i+1] == '(' {
+				break
+			}
+			if c == '>' && i+1 < len(line) && line[i+1] == '>' {
+				i++
+				b.WriteByte(line[i])
+			}
+			continued = true
+		case '\\':
+			continued = i == len(line)-1
+		}
+	}
+
+	text := b.String()
+	if f.state == fsCode || f.state == fsComment {
+		text = strings.TrimRight(text, " \t")
+		f.state = fsCode
+	}
+
+	return text, breaks, continued
+}
+
+func (f *formatter) write(line string) {
+	if f.b.Len() > 0 {
+		f.b.WriteByte('\n')
+	}
+	f.b.WriteString(line)
+}
@@ -129,6 +129,10 @@ func bindPredicates(s *Scope) {
 		return t.Return(NewBoolean(IsContinuation(Car(args))))
 	})
 
+	s.DefineMethod("is-error", func(t *Task, args Cell) bool {
+		return t.Return(NewBoolean(IsError(Car(args))))
+	})
+
 	s.DefineMethod("is-float", func(t *Task, args Cell) bool {
 		return t.Return(NewBoolean(IsFloat(Car(args))))
 	})
@@ -161,6 +165,10 @@ func bindPredicates(s *Scope) {
 		return t.Return(NewBoolean(IsRational(Car(args))))
 	})
 
+	s.DefineMethod("is-secret", func(t *Task, args Cell) bool {
+		return t.Return(NewBoolean(IsSecret(Car(args))))
+	})
+
 	s.DefineMethod("is-status", func(t *Task, args Cell) bool {
 		return t.Return(NewBoolean(IsStatus(Car(args))))
 	})
@@ -293,10 +301,18 @@ func bindTheRest(s *Scope) {
 		return t.LexicalVar(psExecDefine)
 	})
 
+	s.DefineSyntax("define-constant", func(t *Task, args Cell) bool {
+		return t.LexicalVar(psExecConstant)
+	})
+
 	s.DefineSyntax("dynamic", func(t *Task, args Cell) bool {
 		return t.DynamicVar(psExecDynamic)
 	})
 
+	s.DefineSyntax("local", func(t *Task, args Cell) bool {
+		return t.LexicalVar(psExecLocal)
+	})
+
 	s.DefineSyntax("method", func(t *Task, args Cell) bool {
 		return t.Closure(NewMethod)
 	})
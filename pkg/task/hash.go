@@ -0,0 +1,151 @@
+// Released under an MIT-style license. See LICENSE.
+
+package task
+
+import (
+	"github.com/michaelmacinnis/adapted"
+	. "github.com/michaelmacinnis/oh/pkg/cell"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+/*
+ * The local runner remembers where it found each command, so that PATH is
+ * searched only when a command is first run. Nothing is looked up until
+ * it is needed. The remembered commands are forgotten when PATH changes,
+ * as it does when $PATH is set with setenv, and a command that is no
+ * longer where it was found is looked up again. The hashed builtin
+ * returns the remembered commands as (name path) pairs, and rehash
+ * forgets them all.
+ *
+ * The names of all the commands in PATH, which are used for completion
+ * and suggestions, are also read only once, and forgotten in the same way.
+ */
+
+var hashed = struct {
+	sync.Mutex
+	path     string
+	commands map[string]string
+	names    []string
+}{commands: map[string]string{}}
+
+/* Return the names of the commands in PATH that begin with prefix. */
+func Executables(prefix string) []string {
+	names := []string{}
+	for _, name := range executables() {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+/* Return the names of the commands in the directories in PATH. */
+func executables() []string {
+	hashed.Lock()
+	defer hashed.Unlock()
+
+	path := watch()
+	if hashed.names != nil {
+		return hashed.names
+	}
+
+	names := []string{}
+	for _, dir := range filepath.SplitList(path) {
+		if dir == "" {
+			dir = "."
+		}
+
+		entries, err := ioutil.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+
+		for _, e := range entries {
+			if !e.IsDir() {
+				names = append(names, e.Name())
+			}
+		}
+	}
+	hashed.names = names
+
+	return names
+}
+
+/* Return a list of the remembered commands and their paths, by name. */
+func hashedCommands() Cell {
+	hashed.Lock()
+	defer hashed.Unlock()
+
+	watch()
+
+	names := make([]string, 0, len(hashed.commands))
+	for k := range hashed.commands {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	l := []Cell{}
+	for _, k := range names {
+		l = append(l, List(NewSymbol(k), NewSymbol(hashed.commands[k])))
+	}
+
+	return List(l...)
+}
+
+/* Return the path of the command name, searching PATH only if needed. */
+func lookPath(name string) (string, error) {
+	if strings.ContainsRune(name, '/') {
+		return adapted.LookPath(name)
+	}
+
+	hashed.Lock()
+	path := watch()
+	arg0, ok := hashed.commands[name]
+	hashed.Unlock()
+
+	if ok {
+		if info, err := os.Stat(arg0); err == nil && !info.IsDir() {
+			return arg0, nil
+		}
+	}
+
+	arg0, err := adapted.LookPath(name)
+
+	hashed.Lock()
+	if err != nil {
+		delete(hashed.commands, name)
+	} else if path == hashed.path {
+		hashed.commands[name] = arg0
+	}
+	hashed.Unlock()
+
+	return arg0, err
+}
+
+/* Forget the remembered commands. */
+func rehash() {
+	hashed.Lock()
+	hashed.commands = map[string]string{}
+	hashed.names = nil
+	hashed.Unlock()
+}
+
+/*
+ * Forget the remembered commands if PATH has changed, and return PATH.
+ * Must be called with hashed locked.
+ */
+func watch() string {
+	if path := os.Getenv("PATH"); path != hashed.path {
+		hashed.path = path
+		hashed.commands = map[string]string{}
+		hashed.names = nil
+	}
+
+	return hashed.path
+}
@@ -0,0 +1,97 @@
+// Released under an MIT-style license. See LICENSE.
+
+package task
+
+import (
+	"bufio"
+	. "github.com/michaelmacinnis/oh/pkg/cell"
+	"os"
+	"strconv"
+	"strings"
+)
+
+/*
+ * The hostname, os-release, cpu-count, memory-info and uptime commands
+ * describe the machine on which oh is running, for scripts that take an
+ * inventory of it or provision it:
+ *
+ *     hostname      the host's name
+ *     os-release    an object with the fields in /etc/os-release, named
+ *                   in lower case with hyphens, like id and version-id
+ *     cpu-count     the number of logical CPUs that can be used
+ *     memory-info   an object with the total, free and available memory,
+ *                   and the total and free swap, in bytes
+ *     uptime        the time since the system booted, in seconds
+ *
+ * Memory and uptime are read from /proc on Linux and by sysctl on BSD and
+ * macOS, where only the total memory is known. Each command returns an
+ * error if what it describes cannot be found.
+ */
+
+/* Where the operating system is described, in the order they are tried. */
+var osReleasePaths = []string{"/etc/os-release", "/usr/lib/os-release"}
+
+/* Return an object with a public member for each value in m. */
+func memoryObject(m map[string]uint64) Cell {
+	s := NewScope(scope0, nil)
+	for k, v := range m {
+		s.Public(NewSymbol(k), NewInteger(int64(v)))
+	}
+
+	return NewObject(s)
+}
+
+/* Return the fields in the os-release file, as an object. */
+func osRelease(t *Task) Cell {
+	var f *os.File
+	var err error
+
+	for _, path := range osReleasePaths {
+		f, err = os.Open(path)
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return NewError(t, err)
+	}
+	defer f.Close()
+
+	s := NewScope(scope0, nil)
+
+	r := bufio.NewScanner(f)
+	for r.Scan() {
+		line := strings.TrimSpace(r.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.SplitN(line, "=", 2)
+		if len(fields) != 2 {
+			continue
+		}
+
+		k := strings.ToLower(strings.ReplaceAll(fields[0], "_", "-"))
+		s.Public(NewSymbol(k), NewString(t, unquoteRelease(fields[1])))
+	}
+	if err = r.Err(); err != nil {
+		return NewError(t, err)
+	}
+
+	return NewObject(s)
+}
+
+/* Return v, an os-release value, without the quotes around it. */
+func unquoteRelease(v string) string {
+	if strings.HasPrefix(v, `"`) {
+		if s, err := strconv.Unquote(v); err == nil {
+			return s
+		}
+	}
+
+	if len(v) > 1 && strings.HasPrefix(v, "'") && strings.HasSuffix(v, "'") {
+		return v[1 : len(v)-1]
+	}
+
+	return strings.Trim(v, `"`)
+}
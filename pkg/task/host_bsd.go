@@ -0,0 +1,64 @@
+// Released under an MIT-style license. See LICENSE.
+
+// +build darwin dragonfly freebsd netbsd openbsd
+
+package task
+
+import (
+	"runtime"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+/* The sysctl that holds the total memory, in bytes, by operating system. */
+var physicalMemory = map[string]string{
+	"darwin":    "hw.memsize",
+	"dragonfly": "hw.physmem",
+	"freebsd":   "hw.physmem",
+	"netbsd":    "hw.physmem64",
+	"openbsd":   "hw.physmem64",
+}
+
+/*
+ * Return the value of the sysctl name, at least n bytes long. The syscall
+ * package trims a trailing zero byte, as if the value were a string, so it
+ * is put back.
+ */
+func sysctlBytes(name string, n int) ([]byte, error) {
+	s, err := syscall.Sysctl(name)
+	if err != nil {
+		return nil, err
+	}
+
+	b := []byte(s)
+	for len(b) < n {
+		b = append(b, 0)
+	}
+
+	return b, nil
+}
+
+/* Return the total memory, in bytes. */
+func MemoryInfo() (map[string]uint64, error) {
+	b, err := sysctlBytes(physicalMemory[runtime.GOOS], 8)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]uint64{"total": *(*uint64)(unsafe.Pointer(&b[0]))}, nil
+}
+
+/* Return the time, in seconds, since the system booted. */
+func Uptime() (float64, error) {
+	tv := syscall.Timeval{}
+
+	b, err := sysctlBytes("kern.boottime", int(unsafe.Sizeof(tv)))
+	if err != nil {
+		return 0, err
+	}
+
+	tv = *(*syscall.Timeval)(unsafe.Pointer(&b[0]))
+
+	return time.Since(time.Unix(tv.Unix())).Seconds(), nil
+}
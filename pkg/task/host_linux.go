@@ -0,0 +1,72 @@
+// Released under an MIT-style license. See LICENSE.
+
+package task
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+)
+
+/* The fields in /proc/meminfo returned by memory-info, by name. */
+var meminfo = map[string]string{
+	"MemTotal":     "total",
+	"MemFree":      "free",
+	"MemAvailable": "available",
+	"SwapTotal":    "swap-total",
+	"SwapFree":     "swap-free",
+}
+
+/* Return the memory, in bytes, as read from /proc/meminfo. */
+func MemoryInfo() (map[string]uint64, error) {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	m := map[string]uint64{}
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) < 2 {
+			continue
+		}
+
+		k, ok := meminfo[strings.TrimSuffix(fields[0], ":")]
+		if !ok {
+			continue
+		}
+
+		n, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(fields) > 2 && fields[2] == "kB" {
+			n *= 1024
+		}
+
+		m[k] = n
+	}
+
+	return m, s.Err()
+}
+
+/* Return the time, in seconds, since the system booted. */
+func Uptime() (float64, error) {
+	b, err := os.ReadFile("/proc/uptime")
+	if err != nil {
+		return 0, err
+	}
+
+	fields := strings.Fields(string(b))
+	if len(fields) == 0 {
+		return 0, errors.New("/proc/uptime: no uptime")
+	}
+
+	return strconv.ParseFloat(fields[0], 64)
+}
@@ -0,0 +1,17 @@
+// Released under an MIT-style license. See LICENSE.
+
+// +build !linux,!darwin,!dragonfly,!freebsd,!netbsd,!openbsd
+
+package task
+
+import (
+	"errors"
+)
+
+func MemoryInfo() (map[string]uint64, error) {
+	return nil, errors.New("Not implemented")
+}
+
+func Uptime() (float64, error) {
+	return 0, errors.New("Not implemented")
+}
@@ -0,0 +1,123 @@
+// Released under an MIT-style license. See LICENSE.
+
+package task
+
+import (
+	"fmt"
+	. "github.com/michaelmacinnis/oh/pkg/cell"
+	"math"
+	"strconv"
+)
+
+/*
+ * The with-priority and with-rlimit commands set, for the external
+ * commands run by a block, their scheduling priority (niceness) and
+ * resource limits. Go cannot change these between starting a process and
+ * running the command, so they are applied to each command as soon as it
+ * has started, and a command that starts another straight away may do so
+ * before they are. If they cannot be applied, the command is killed.
+ *
+ * The dynamic variable $priority holds the priority, and $rlimits holds a
+ * list of (resource limit) pairs, innermost first. Resource limits can
+ * only be applied on Linux. The umask builtin, in contrast, changes the
+ * shell's own file mode creation mask, which every command inherits.
+ */
+
+/* Apply the priority and resource limits set for t to the process p. */
+func (t *Task) limit(p Process) error {
+	if r := Resolve(t.Lexical, t.Dynamic, NewSymbol("$priority")); r != nil {
+		if err := SetPriority(p.Pid(), int(r.Get().(Atom).Int())); err != nil {
+			return err
+		}
+	}
+
+	r := Resolve(t.Lexical, t.Dynamic, NewSymbol("$rlimits"))
+	if r == nil {
+		return nil
+	}
+
+	/* Outer limits are applied first, so that inner limits win. */
+	for _, l := range reverse(elements(r.Get())) {
+		resource, value := raw(Car(l)), raw(Cadr(l))
+		if err := SetRlimit(p.Pid(), resource, rlimit(value)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func reverse(s []Cell) []Cell {
+	for i, j := 0, len(s)-1; i < j; i, j = i+1, j-1 {
+		s[i], s[j] = s[j], s[i]
+	}
+
+	return s
+}
+
+/* Return the resource limit value, which may be unlimited. */
+func rlimit(value string) uint64 {
+	if value == "unlimited" {
+		return math.MaxUint64
+	}
+
+	n, err := strconv.ParseUint(value, 0, 64)
+	if err != nil {
+		panic("error/runtime: invalid resource limit: " + value)
+	}
+
+	return n
+}
+
+/* Return the commands for with-priority: a dynamic $priority, then body. */
+func withPriority(n, body Cell) Cell {
+	return Cons(List(NewSymbol("dynamic"), NewSymbol("$priority"), n), body)
+}
+
+/*
+ * Return the commands for with-rlimit: a dynamic $rlimits with the limit
+ * for resource added, then body.
+ */
+func withRlimit(resource, value, body Cell) Cell {
+	add := NewMethod(func(t *Task, args Cell) bool {
+		name, value := raw(Car(args)), raw(Cadr(args))
+		if !IsRlimit(name) {
+			panic("error/runtime: with-rlimit: unknown resource: " + name)
+		}
+		rlimit(value)
+
+		limits := Null
+		r := Resolve(t.Lexical, t.Dynamic, NewSymbol("$rlimits"))
+		if r != nil {
+			limits = r.Get()
+		}
+
+		l := List(NewSymbol(name), NewSymbol(value))
+
+		return t.Return(Cons(l, limits))
+	}, Null, Null, Null, scope0)
+
+	rlimits := List(NewSymbol("dynamic"), NewSymbol("$rlimits"),
+		List(NewBound(add, scope0), resource, value))
+
+	return Cons(rlimits, body)
+}
+
+/* Return the shell's file mode creation mask, after setting it to mask. */
+func umask(args Cell) Cell {
+	if args == Null {
+		m := Umask(0)
+		Umask(m)
+
+		return NewSymbol(fmt.Sprintf("%04o", m))
+	}
+
+	m, err := strconv.ParseUint(raw(Car(args)), 8, 32)
+	if err != nil || m > 0777 {
+		panic("error/runtime: umask: invalid mask: " + raw(Car(args)))
+	}
+
+	Umask(int(m))
+
+	return NewSymbol(fmt.Sprintf("%04o", m))
+}
@@ -0,0 +1,119 @@
+// Released under an MIT-style license. See LICENSE.
+
+package task
+
+import (
+	"encoding/json"
+	. "github.com/michaelmacinnis/oh/pkg/cell"
+	"strings"
+	"time"
+)
+
+/*
+ * The object log has the methods debug, info, warn and error, each of
+ * which writes its arguments, separated by spaces, as a message at that
+ * level. Logging is controlled by dynamic variables:
+ *
+ *     $log-level   messages below this level are discarded (info)
+ *     $log-format  text, for a timestamp, level and message on a line,
+ *                  or json, for an object with time, level and msg (text)
+ *     $log-sink    the conduit to which messages are written ($stderr),
+ *                  or syslog or journal, for the system log
+ *
+ * Timestamps are in UTC and taken from the same clock as now. The system
+ * log adds its own, so messages sent to it do not have a timestamp. If
+ * the systemd journal is not running, journal is the same as syslog.
+ */
+
+var levels = map[string]int{
+	"debug": 0,
+	"info":  1,
+	"warn":  2,
+	"error": 3,
+}
+
+/* Return the log object. */
+func logger() *Object {
+	s := NewScope(scope0, nil)
+
+	for level := range levels {
+		level := level
+		s.PublicMethod(level, func(t *Task, args Cell) bool {
+			t.log(level, args)
+
+			return t.Return(True)
+		})
+	}
+
+	return NewObject(s)
+}
+
+/* Write the message args at level to $log-sink, if $log-level allows. */
+func (t *Task) log(level string, args Cell) {
+	threshold := raw(t.dynamic("$log-level", NewSymbol("info")))
+	if n, ok := levels[threshold]; !ok {
+		panic("error/runtime: unknown log level: " + threshold)
+	} else if levels[level] < n {
+		return
+	}
+
+	words := []string{}
+	for ; args != Null; args = Cdr(args) {
+		words = append(words, raw(Car(args)))
+	}
+	msg := strings.Join(words, " ")
+
+	sink := t.dynamic("$log-sink", nil)
+	if sink == nil {
+		sink = t.dynamic("$stderr", nil)
+	}
+
+	system := ""
+	if IsAtom(sink) {
+		system = raw(sink)
+		if system != "journal" && system != "syslog" {
+			panic("error/runtime: unknown log sink: " + system)
+		}
+	}
+
+	ts := now().UTC().Format(time.RFC3339)
+
+	line := ""
+	switch f := raw(t.dynamic("$log-format", NewSymbol("text"))); f {
+	case "json":
+		b, err := json.Marshal(struct {
+			Time  string `json:"time"`
+			Level string `json:"level"`
+			Msg   string `json:"msg"`
+		}{ts, level, msg})
+		if err != nil {
+			panic(err)
+		}
+		line = string(b)
+	case "text":
+		line = ts + " " + strings.ToUpper(level) + " " + msg
+		if system != "" {
+			line = msg
+		}
+	default:
+		panic("error/runtime: unknown log format: " + f)
+	}
+
+	if system != "" {
+		if err := SystemLog(system, level, line); err != nil {
+			panic("error/runtime: " + system + ": " + err.Error())
+		}
+		return
+	}
+
+	toConduit(sink.(Context)).Write(NewSymbol(line))
+}
+
+/* Return the value of the dynamic variable name, or v if it is not set. */
+func (t *Task) dynamic(name string, v Cell) Cell {
+	if r := Resolve(t.Lexical, t.Dynamic, NewSymbol(name)); r != nil {
+		return r.Get()
+	}
+
+	return v
+}
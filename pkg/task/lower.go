@@ -0,0 +1,87 @@
+// Released under an MIT-style license. See LICENSE.
+
+package task
+
+import (
+	. "github.com/michaelmacinnis/oh/pkg/cell"
+)
+
+/*
+ * The first time a list is evaluated, as a block or as the head and
+ * arguments of a command, it is lowered into a slice of instructions, one
+ * for each element, cached on the list's pairs. Each instruction records
+ * how its element is evaluated:
+ *
+ *     opConstant   a value other than a symbol, which evaluates to itself
+ *     opNumber     a symbol that reads as a number, which is looked up
+ *                  but is never undefined
+ *     opSymbol     any other symbol, which is looked up
+ *     opNull       the empty list
+ *     opMember     a member access, like a::b
+ *     opCommand    a command, like (f a b)
+ *     opUnchecked  a command whose failure errexit ignores, like (if ...)
+ *
+ * Which command, method or syntax a head names can change between visits,
+ * so only what is known from the shape of the code is recorded.
+ */
+const (
+	opConstant = iota
+	opNumber
+	opSymbol
+	opNull
+	opMember
+	opCommand
+	opUnchecked
+)
+
+/* Return the instruction for the element held in p, lowering p if needed. */
+func instruction(p Cell) int64 {
+	if i := Compiled(p); i != nil {
+		return i.Op
+	}
+
+	return lower(p)
+}
+
+/*
+ * Lower the list starting at p into instructions, caching each on its
+ * pair, and return the instruction for the element held in p.
+ */
+func lower(p Cell) int64 {
+	n := 0
+	for l := p; l != Null && IsCons(l); l = Cdr(l) {
+		n++
+	}
+
+	code := make([]Instruction, n)
+	for i, l := 0, p; i < n; i, l = i+1, Cdr(l) {
+		code[i].Op = opcode(Car(l))
+		SetCompiled(l, &code[i])
+	}
+
+	return code[0].Op
+}
+
+/* Return the instruction for the element c. */
+func opcode(c Cell) int64 {
+	switch {
+	case c == Null:
+		return opNull
+	case IsCons(c) && !errexits(c):
+		return opUnchecked
+	case IsCons(c) && IsAtom(Cdr(c)):
+		return opMember
+	case IsCons(c):
+		return opCommand
+	}
+
+	if sym, ok := c.(*Symbol); ok {
+		if number(raw(sym)) {
+			return opNumber
+		}
+
+		return opSymbol
+	}
+
+	return opConstant
+}
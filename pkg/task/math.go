@@ -0,0 +1,138 @@
+// Released under an MIT-style license. See LICENSE.
+
+package task
+
+import (
+	. "github.com/michaelmacinnis/oh/pkg/cell"
+	"math"
+	"math/big"
+)
+
+/*
+ * The object math holds mathematical functions and constants:
+ *
+ *     abs x            absolute value
+ *     ceil x           smallest integer not less than x
+ *     cos x            cosine, in radians
+ *     e                base of the natural logarithm
+ *     exp x            e to the power x
+ *     floor x          largest integer not greater than x
+ *     log x [base]     logarithm, natural unless a base is given
+ *     pi               ratio of a circle's circumference to its diameter
+ *     pow x y          x to the power y
+ *     round x          nearest integer, rounding half away from zero
+ *     sin x            sine, in radians
+ *     sqrt x           square root
+ *     tan x            tangent, in radians
+ *
+ * The functions abs, ceil, floor and round return an exact result for an
+ * exact argument, and a float for a float. The others return a float.
+ */
+
+/* Return the math object. */
+func mathObject() *Object {
+	s := NewScope(scope0, nil)
+
+	s.Public(NewSymbol("e"), NewFloat(math.E))
+	s.Public(NewSymbol("pi"), NewFloat(math.Pi))
+
+	s.PublicMethod("abs", func(t *Task, args Cell) bool {
+		return t.Return(rounded(Car(args), math.Abs, (*big.Rat).Abs))
+	})
+	s.PublicMethod("ceil", func(t *Task, args Cell) bool {
+		return t.Return(rounded(Car(args), math.Ceil, ceil))
+	})
+	s.PublicMethod("floor", func(t *Task, args Cell) bool {
+		return t.Return(rounded(Car(args), math.Floor, floor))
+	})
+	s.PublicMethod("log", func(t *Task, args Cell) bool {
+		v := math.Log(toFloat(Car(args)))
+		if Cdr(args) != Null {
+			v /= math.Log(toFloat(Cadr(args)))
+		}
+
+		return t.Return(finite("log", v))
+	})
+	s.PublicMethod("pow", func(t *Task, args Cell) bool {
+		v := math.Pow(toFloat(Car(args)), toFloat(Cadr(args)))
+
+		return t.Return(finite("pow", v))
+	})
+	s.PublicMethod("round", func(t *Task, args Cell) bool {
+		return t.Return(rounded(Car(args), math.Round, round))
+	})
+
+	for name, f := range map[string]func(float64) float64{
+		"cos":  math.Cos,
+		"exp":  math.Exp,
+		"sin":  math.Sin,
+		"sqrt": math.Sqrt,
+		"tan":  math.Tan,
+	} {
+		name, f := name, f
+		s.PublicMethod(name, func(t *Task, args Cell) bool {
+			return t.Return(finite(name, f(toFloat(Car(args)))))
+		})
+	}
+
+	return NewObject(s)
+}
+
+func ceil(z, x *big.Rat) *big.Rat {
+	return z.Neg(floor(z, new(big.Rat).Neg(x)))
+}
+
+/* Return v, unless it is infinite or not a number. */
+func finite(name string, v float64) *Float {
+	if math.IsInf(v, 0) || math.IsNaN(v) {
+		panic("error/runtime: " + name + ": result is not a finite number")
+	}
+
+	return NewFloat(v)
+}
+
+func floor(z, x *big.Rat) *big.Rat {
+	n := new(big.Int)
+	n.Div(x.Num(), x.Denom())
+
+	return z.SetInt(n)
+}
+
+func round(z, x *big.Rat) *big.Rat {
+	h := big.NewRat(1, 2)
+	if x.Sign() < 0 {
+		return z.Neg(floor(z, h.Add(h, new(big.Rat).Neg(x))))
+	}
+
+	return floor(z, h.Add(h, x))
+}
+
+/*
+ * Apply inexact to c if it is a float, and exact, otherwise. An integer
+ * result for an integer is an integer, if it fits.
+ */
+func rounded(c Cell, inexact func(float64) float64,
+	exact func(z, x *big.Rat) *big.Rat) Number {
+	switch n := c.(type) {
+	case *Float:
+		return NewFloat(inexact(float64(*n)))
+	case *Integer:
+		r := exact(new(big.Rat), n.Rat())
+		if r.Num().IsInt64() {
+			return NewInteger(r.Num().Int64())
+		}
+		return NewRational(r)
+	}
+
+	return NewRational(exact(new(big.Rat), c.(Atom).Rat()))
+}
+
+/* Return the value of c as a float. */
+func toFloat(c Cell) float64 {
+	if f, ok := c.(*Float); ok {
+		return float64(*f)
+	}
+
+	f, _ := c.(Atom).Rat().Float64()
+	return f
+}
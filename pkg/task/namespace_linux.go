@@ -0,0 +1,30 @@
+// Released under an MIT-style license. See LICENSE.
+
+package task
+
+import (
+	"errors"
+	"syscall"
+)
+
+var namespaces = map[string]uintptr{
+	"ipc":   syscall.CLONE_NEWIPC,
+	"mount": syscall.CLONE_NEWNS,
+	"net":   syscall.CLONE_NEWNET,
+	"pid":   syscall.CLONE_NEWPID,
+	"uts":   syscall.CLONE_NEWUTS,
+}
+
+/* Set sys so that the process is started in the new namespaces names. */
+func Unshare(sys *syscall.SysProcAttr, names []string) error {
+	for _, name := range names {
+		flag, ok := namespaces[name]
+		if !ok {
+			return errors.New("unknown namespace: " + name)
+		}
+
+		sys.Cloneflags |= flag
+	}
+
+	return nil
+}
@@ -0,0 +1,18 @@
+// Released under an MIT-style license. See LICENSE.
+
+// +build !linux
+
+package task
+
+import (
+	"errors"
+	"syscall"
+)
+
+func Unshare(sys *syscall.SysProcAttr, names []string) error {
+	if len(names) == 0 {
+		return nil
+	}
+
+	return errors.New("Not implemented")
+}
@@ -0,0 +1,130 @@
+// Released under an MIT-style license. See LICENSE.
+
+package task
+
+import (
+	. "github.com/michaelmacinnis/oh/pkg/cell"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+/*
+ * The format-number command writes a number as text:
+ *
+ *     format-number n [--base b] [--precision p] [--separator s]
+ *
+ * An integer can be written in any base from 2 to 36. Otherwise the
+ * number is written in decimal, rounded to p digits after the point if a
+ * precision is given, and with the digits before the point grouped in
+ * threes, separated by s, if a separator is given. Text is read as it is
+ * by parse-number.
+ *
+ * The parse-number command reads a number from text, in the given base, or
+ * if no base is given, as an integer (which may begin with 0, 0b, 0o or 0x)
+ * or a decimal or rational number. Rather than failing, parse-number
+ * returns false if the text is not a number.
+ */
+
+var numberParams = List(
+	List(NewSymbol("--base"), Null),
+	List(NewSymbol("--precision"), Null),
+	List(NewSymbol("--separator"), Null),
+)
+
+func formatNumber(args Cell) string {
+	args, values := keywords(numberParams, args)
+
+	n, ok := Car(args).(Atom)
+	if IsString(n) || IsSymbol(n) {
+		n, ok = parseNumber(List(n)).(Number)
+	}
+	if !ok {
+		panic("error/runtime: not a number: " + raw(Car(args)))
+	}
+
+	if b, ok := values["--base"]; ok {
+		base := int(b.(Atom).Int())
+		if base < 2 || base > 36 {
+			panic("error/runtime: invalid base: " + raw(b))
+		}
+
+		r := n.Rat()
+		if !r.IsInt() {
+			panic("error/runtime: not an integer: " + raw(n))
+		}
+
+		return r.Num().Text(base)
+	}
+
+	s := ""
+	if p, ok := values["--precision"]; ok {
+		s = n.Rat().FloatString(int(p.(Atom).Int()))
+	} else if f, ok := n.(*Float); ok {
+		s = strconv.FormatFloat(float64(*f), 'f', -1, 64)
+	} else if r := n.Rat(); r.IsInt() {
+		s = r.Num().String()
+	} else {
+		s = r.RatString()
+	}
+
+	if sep, ok := values["--separator"]; ok {
+		s = group(s, raw(sep))
+	}
+
+	return s
+}
+
+/* Group the digits before the point in s in threes, separated by sep. */
+func group(s, sep string) string {
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+
+	end := strings.IndexAny(s, "./")
+	if end < 0 {
+		end = len(s)
+	}
+
+	digits, rest := s[:end], s[end:]
+
+	groups := []string{}
+	for len(digits) > 3 {
+		groups = append([]string{digits[len(digits)-3:]}, groups...)
+		digits = digits[:len(digits)-3]
+	}
+	groups = append([]string{digits}, groups...)
+
+	return sign + strings.Join(groups, sep) + rest
+}
+
+func parseNumber(args Cell) Cell {
+	args, values := keywords(numberParams, args)
+
+	s := strings.TrimSpace(raw(Car(args)))
+
+	base := 0
+	if b, ok := values["--base"]; ok {
+		base = int(b.(Atom).Int())
+		if base < 2 || base > 36 {
+			panic("error/runtime: invalid base: " + raw(b))
+		}
+	}
+
+	if i, ok := new(big.Int).SetString(s, base); ok {
+		if i.IsInt64() {
+			return NewInteger(i.Int64())
+		}
+
+		return NewRational(new(big.Rat).SetInt(i))
+	}
+
+	if base == 0 {
+		if r, ok := new(big.Rat).SetString(s); ok {
+			return NewRational(r)
+		}
+	}
+
+	return False
+}
@@ -0,0 +1,215 @@
+// Released under an MIT-style license. See LICENSE.
+
+package task
+
+import (
+	. "github.com/michaelmacinnis/oh/pkg/cell"
+	"sync/atomic"
+)
+
+/*
+ * The dynamic variable $options holds an object whose public members
+ * control how strictly commands are evaluated:
+ *
+ *     correct    if true, oh, when interactive, offers to run the closest
+ *                command to one that cannot be found
+ *     errexit    if true, a command in a block, other than the last, that
+ *                fails causes the task to exit with its status
+ *     numbers    if true, a number cannot be used as a variable name
+ *     undefined  what an undefined variable evaluates to: ignore (its
+ *                name) or fail (an error)
+ *     unmatched  what a wildcard that matches nothing expands to: fail
+ *                (an error), literal (the pattern) or empty (nothing)
+ *
+ * The with method returns a child of the options object with the given
+ * options changed, so options can be set for a block by binding $options
+ * with dynamic. The check method applies errexit to a command, and its
+ * result, evaluated other than in a block (by source, for example).
+ *
+ * Neither a conditional command, like if or while, whose result is a
+ * failed test, nor a definition or assignment of a failed status causes
+ * the task to exit.
+ */
+
+/*
+ * Incremented whenever $options is added to, or removed from, any env, so
+ * that a task can tell whether where it last found $options still holds.
+ */
+var optionsGeneration int64
+
+var unchecked = map[string]bool{
+	"and":             true,
+	"case":            true,
+	"cond":            true,
+	"define":          true,
+	"define-constant": true,
+	"define-record":   true,
+	"dynamic":         true,
+	"if":              true,
+	"local":           true,
+	"or":              true,
+	"public":          true,
+	"readonly":        true,
+	"set":             true,
+	"setenv":          true,
+	"unless":          true,
+	"while":           true,
+}
+
+var defaults = map[string]Cell{
+	"correct":   False,
+	"errexit":   False,
+	"numbers":   False,
+	"undefined": NewSymbol("ignore"),
+	"unmatched": NewSymbol("fail"),
+}
+
+/* Return the default options object. */
+func options() *Object {
+	s := NewScope(scope0, nil)
+	for k, v := range defaults {
+		s.Public(NewSymbol(k), v)
+	}
+
+	s.PublicMethod("check", func(t *Task, args Cell) bool {
+		v := Cadr(args)
+		if errexits(Car(args)) && failed(v) && t.Option("errexit").Bool() {
+			t.Scratch = List(v)
+			t.Stop()
+
+			return true
+		}
+
+		return t.Return(True)
+	})
+	s.PublicMethod("with", with("option", defaults))
+
+	return NewObject(s)
+}
+
+/*
+ * Option returns the value of the option name in t's $options, or its
+ * default value if $options is not an options object.
+ */
+func (t *Task) Option(name string) Cell {
+	return memberOf(t.optionsReference(), name, defaults)
+}
+
+/*
+ * Return the value of the public member name of the object held by the
+ * variable v, or its default value if v does not hold such an object.
+ */
+func (t *Task) member(v, name string, defaults map[string]Cell) Cell {
+	return memberOf(Resolve(t.Lexical, t.Dynamic, NewSymbol(v)), name, defaults)
+}
+
+/*
+ * Return the value of the public member name of the object held by the
+ * reference o, or its default value if o does not hold such an object.
+ */
+func memberOf(o Reference, name string, defaults map[string]Cell) (c Cell) {
+	c = defaults[name]
+
+	defer func() {
+		recover()
+	}()
+
+	if o == nil {
+		return c
+	}
+
+	if r := o.Get().(Context).Access(NewSymbol(name)); r != nil {
+		return r.Get()
+	}
+
+	return c
+}
+
+/*
+ * Return the reference for $options. Options are checked for nearly every
+ * command, so where it was found is remembered, and a search that reaches
+ * the dynamic environment from which it was last found stops there,
+ * rather than searching every enclosing environment again. What was
+ * remembered is forgotten if $options has since been added to or removed
+ * from any env, by this task or another.
+ */
+func (t *Task) optionsReference() Reference {
+	k := NewSymbol("$options")
+	if r := t.Lexical.Access(k); r != nil {
+		return r
+	}
+
+	g := atomic.LoadInt64(&optionsGeneration)
+	if g != t.optionsGen {
+		t.optionsFrom = nil
+	}
+
+	for e := t.Dynamic; e != nil; e = e.prev {
+		if r, ok := e.get(k.String()); ok {
+			t.optionsFrom, t.optionsRef = t.Dynamic, r
+			t.optionsGen = g
+			return r
+		}
+
+		if e == t.optionsFrom {
+			t.optionsFrom = t.Dynamic
+			return t.optionsRef
+		}
+	}
+
+	t.optionsFrom, t.optionsRef = t.Dynamic, nil
+	t.optionsGen = g
+
+	return nil
+}
+
+/* Note that $options has changed, if key is $options. */
+func optionsChanged(key Cell) {
+	if raw(key) == "$options" {
+		atomic.AddInt64(&optionsGeneration, 1)
+	}
+}
+
+/* Return true if the option name is set to the symbol value. */
+func (t *Task) optionIs(name, value string) bool {
+	return raw(t.Option(name)) == value
+}
+
+/* Return true if errexit applies to the command c. */
+func errexits(c Cell) bool {
+	return !IsCons(c) || c == Null || !unchecked[raw(Car(c))]
+}
+
+/* Return true if v is the status of a command that failed, or an error. */
+func failed(v Cell) bool {
+	if IsError(v) {
+		return true
+	}
+
+	s, ok := v.(*Status)
+	return ok && !s.Bool()
+}
+
+/*
+ * Return a with method, which returns a child of its object with the
+ * given members, each a kind of setting with a default, changed.
+ */
+func with(kind string, defaults map[string]Cell) func(*Task, Cell) bool {
+	return func(t *Task, args Cell) bool {
+		o := NewScope(t.Self().Expose(), nil)
+		for ; args != Null; args = Cddr(args) {
+			k := raw(Car(args))
+			if _, ok := defaults[k]; !ok {
+				panic("error/runtime: unknown " + kind + ": " + k)
+			}
+
+			if Cdr(args) == Null {
+				panic("error/runtime: no value for " + kind + ": " + k)
+			}
+
+			o.Public(NewSymbol(k), Cadr(args))
+		}
+
+		return t.Return(NewObject(o))
+	}
+}
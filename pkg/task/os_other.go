@@ -5,6 +5,7 @@
 package task
 
 import (
+	"errors"
 	. "github.com/michaelmacinnis/oh/pkg/cell"
 	"os"
 	"syscall"
@@ -17,6 +18,10 @@ func BecomeProcessGroupLeader() int {
 	return 0
 }
 
+func Confine(attr *os.ProcAttr, root string, uid, gid int, namespaces []string) error {
+	return errors.New("Not implemented")
+}
+
 func ContinueProcess(pid int) {}
 
 func GetHistoryFilePath() (string, error) {
@@ -25,6 +30,12 @@ func GetHistoryFilePath() (string, error) {
 
 func InitSignalHandling() {}
 
+func InterruptProcessGroup(group int) {}
+
+func IsTerminal(fd uintptr) bool {
+	return false
+}
+
 func JobControlSupported() bool {
 	return false
 }
@@ -38,14 +49,46 @@ func JoinProcess(proc *os.Process) int {
 	return status.Sys().(syscall.WaitStatus).ExitStatus()
 }
 
+func Mkfifo(path string, mode uint32) error {
+	return errors.New("Not implemented")
+}
+
+func ProcessExists(pid int) bool {
+	return false
+}
+
 func SetForegroundGroup(group int) {}
 
+func SetPriority(pid, n int) error {
+	return errors.New("Not implemented")
+}
+
+func SignalProcess(pid, sig int) error {
+	return errors.New("Not implemented")
+}
+
 func SysProcAttr(group int) *syscall.SysProcAttr {
 	return nil
 }
 
+func SystemLog(name, level, msg string) error {
+	return errors.New("Not implemented")
+}
+
+func TerminalSize() (rows, cols int) {
+	return 0, 0
+}
+
 func TerminateProcess(pid int) {}
 
+func Umask(mask int) int {
+	return 0
+}
+
+func environmentName(name string) string {
+	return name
+}
+
 func evaluate(c Cell) {
 	task0.Eval <- c
 	<-task0.Done
@@ -5,10 +5,15 @@
 package task
 
 import (
+	"encoding/binary"
 	. "github.com/michaelmacinnis/oh/pkg/cell"
+	"log/syslog"
+	"net"
 	"os"
 	"os/signal"
 	"path"
+	"strings"
+	"sync"
 	"syscall"
 	"unsafe"
 )
@@ -31,6 +36,12 @@ var (
 	register chan registration
 )
 
+/* The connection to syslog is opened when first used. */
+var syslogger struct {
+	sync.Mutex
+	w *syslog.Writer
+}
+
 func BecomeProcessGroupLeader() int {
 	pid := syscall.Getpid()
 	pgid := syscall.Getpgrp()
@@ -41,6 +52,35 @@ func BecomeProcessGroupLeader() int {
 	return pid
 }
 
+/*
+ * Set the attributes of the process to be started with attr so that it
+ * runs with the root directory root, as uid and gid, and in the new
+ * namespaces, where each, if it is empty or negative, is left unchanged.
+ */
+func Confine(attr *os.ProcAttr, root string, uid, gid int, namespaces []string) error {
+	if attr.Sys == nil {
+		attr.Sys = &syscall.SysProcAttr{}
+	}
+
+	attr.Sys.Chroot = root
+
+	if uid >= 0 || gid >= 0 {
+		if uid < 0 {
+			uid = os.Getuid()
+		}
+		if gid < 0 {
+			gid = os.Getgid()
+		}
+
+		attr.Sys.Credential = &syscall.Credential{
+			Uid: uint32(uid),
+			Gid: uint32(gid),
+		}
+	}
+
+	return Unshare(attr.Sys, namespaces)
+}
+
 func ContinueProcess(pid int) {
 	syscall.Kill(pid, syscall.SIGCONT)
 }
@@ -52,6 +92,15 @@ func GetHistoryFilePath() (string, error) {
 func InitSignalHandling() {
 	signal.Ignore(syscall.SIGTTOU, syscall.SIGTTIN)
 
+	resized := make(chan os.Signal, 1)
+	signal.Notify(resized, syscall.SIGWINCH)
+
+	go func() {
+		for range resized {
+			resize()
+		}
+	}()
+
 	signals := []os.Signal{syscall.SIGINT, syscall.SIGTSTP}
 	incoming = make(chan os.Signal, len(signals))
 
@@ -60,6 +109,15 @@ func InitSignalHandling() {
 	go broker()
 }
 
+func InterruptProcessGroup(group int) {
+	syscall.Kill(-group, syscall.SIGINT)
+}
+
+func IsTerminal(fd uintptr) bool {
+	_, ok := winsize(fd)
+	return ok
+}
+
 func JobControlSupported() bool {
 	return true
 }
@@ -71,11 +129,32 @@ func JoinProcess(proc *os.Process) int {
 	return (<-response).status.ExitStatus()
 }
 
+func Mkfifo(path string, mode uint32) error {
+	return syscall.Mkfifo(path, mode)
+}
+
+func ProcessExists(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
+
 func SetForegroundGroup(group int) {
 	syscall.Syscall(syscall.SYS_IOCTL, uintptr(syscall.Stdin),
 		syscall.TIOCSPGRP, uintptr(unsafe.Pointer(&group)))
 }
 
+func SetPriority(pid, n int) error {
+	return syscall.Setpriority(syscall.PRIO_PROCESS, pid, n)
+}
+
+func SignalProcess(pid, sig int) error {
+	return syscall.Kill(pid, syscall.Signal(sig))
+}
+
 func SysProcAttr(group int) *syscall.SysProcAttr {
 	sys := &syscall.SysProcAttr{}
 
@@ -90,10 +169,55 @@ func SysProcAttr(group int) *syscall.SysProcAttr {
 	return sys
 }
 
+/*
+ * Write msg, at level, to the systemd journal, if name is journal and the
+ * journal is running, or otherwise, to syslog.
+ */
+func SystemLog(name, level, msg string) error {
+	if name == "journal" && journal(level, msg) == nil {
+		return nil
+	}
+
+	syslogger.Lock()
+	defer syslogger.Unlock()
+
+	if syslogger.w == nil {
+		w, err := syslog.New(syslog.LOG_USER|syslog.LOG_INFO, "oh")
+		if err != nil {
+			return err
+		}
+		syslogger.w = w
+	}
+
+	switch level {
+	case "debug":
+		return syslogger.w.Debug(msg)
+	case "warn":
+		return syslogger.w.Warning(msg)
+	case "error":
+		return syslogger.w.Err(msg)
+	}
+
+	return syslogger.w.Info(msg)
+}
+
+func TerminalSize() (rows, cols int) {
+	ws, ok := winsize(uintptr(syscall.Stdout))
+	if !ok {
+		return 0, 0
+	}
+
+	return int(ws.Row), int(ws.Col)
+}
+
 func TerminateProcess(pid int) {
 	syscall.Kill(pid, syscall.SIGTERM)
 }
 
+func Umask(mask int) int {
+	return syscall.Umask(mask)
+}
+
 func broker() {
 	var c Cell
 	for c == nil && task0.Stack != Null {
@@ -104,12 +228,25 @@ func broker() {
 			}
 		}
 		task0.Eval <- c
+		interrupted := false
 		for c != nil {
 			prev := task0
 			select {
 			case sig := <-incoming:
 				// Handle signals.
 				switch sig {
+				case syscall.SIGINT:
+					// The first interrupt cancels the command
+					// being evaluated. If that doesn't work,
+					// a second abandons the foreground task.
+					if !interrupted {
+						interrupted = true
+						task0.Interrupt()
+						continue
+					}
+
+					task0.Stop()
+
 				case syscall.SIGTSTP:
 					task0.Suspend()
 					last := 0
@@ -121,17 +258,11 @@ func broker() {
 					last++
 
 					jobs[last] = task0
-
-					fallthrough
-				case syscall.SIGINT:
-					if sig == syscall.SIGINT {
-						task0.Stop()
-					}
-
-					LaunchForegroundTask()
-					c = nil
 				}
 
+				LaunchForegroundTask()
+				c = nil
+
 			case c = <-task0.Done:
 				if task0 != prev {
 					c = Null
@@ -144,6 +275,10 @@ func broker() {
 	os.Exit(status(Car(task0.Scratch)))
 }
 
+func environmentName(name string) string {
+	return name
+}
+
 func evaluate(c Cell) {
 	eval0 <- c
 	<-done0
@@ -164,6 +299,37 @@ func init() {
 	go registrar(active, notify)
 }
 
+/*
+ * Send msg, at level, to the systemd journal using its native protocol.
+ * A message with a newline is sent as a length followed by its bytes.
+ */
+func journal(level, msg string) error {
+	c, err := net.Dial("unixgram", "/run/systemd/journal/socket")
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	priority := map[string]string{
+		"debug": "7", "info": "6", "warn": "4", "error": "3",
+	}[level]
+
+	b := []byte("PRIORITY=" + priority + "\nSYSLOG_IDENTIFIER=oh\n")
+	if strings.Contains(msg, "\n") {
+		n := make([]byte, 8)
+		binary.LittleEndian.PutUint64(n, uint64(len(msg)))
+
+		b = append(b, "MESSAGE\n"...)
+		b = append(append(b, n...), msg+"\n"...)
+	} else {
+		b = append(b, "MESSAGE="+msg+"\n"...)
+	}
+
+	_, err = c.Write(b)
+
+	return err
+}
+
 func monitor(active chan bool, notify chan notification) {
 	for {
 		monitoring := <-active
@@ -227,3 +393,10 @@ func registrar(active chan bool, notify chan notification) {
 		}
 	}
 }
+
+func winsize(fd uintptr) (ws struct{ Row, Col, X, Y uint16 }, ok bool) {
+	_, _, err := syscall.Syscall(syscall.SYS_IOCTL, fd,
+		syscall.TIOCGWINSZ, uintptr(unsafe.Pointer(&ws)))
+
+	return ws, err == 0
+}
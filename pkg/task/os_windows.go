@@ -5,25 +5,62 @@
 package task
 
 import (
+	"errors"
 	. "github.com/michaelmacinnis/oh/pkg/cell"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
 	"syscall"
 )
 
+/*
+ * Windows has neither process groups nor job control, so fg, bg and jobs
+ * are unavailable and an interrupt, which the console delivers to every
+ * process attached to it, cancels the command being evaluated rather
+ * than ending the shell. Environment variable names are not case
+ * sensitive and are made uppercase, so that $PATH is defined, rather than
+ * $Path.
+ */
+
 var Platform string = "windows"
 
 func BecomeProcessGroupLeader() int {
-	// TODO: Not sure what to do on non-Unix platforms.
-	return 0
+	return os.Getpid()
+}
+
+func Confine(attr *os.ProcAttr, root string, uid, gid int, namespaces []string) error {
+	return errors.New("Not implemented")
 }
 
 func ContinueProcess(pid int) {}
 
 func GetHistoryFilePath() (string, error) {
-	return "", errors.New("Not implemented")
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, ".oh_history"), nil
 }
 
-func InitSignalHandling() {}
+func InitSignalHandling() {
+	incoming := make(chan os.Signal, 1)
+	signal.Notify(incoming, os.Interrupt)
+
+	go func() {
+		for range incoming {
+			task0.Interrupt()
+		}
+	}()
+}
+
+func InterruptProcessGroup(group int) {}
+
+func IsTerminal(fd uintptr) bool {
+	var mode uint32
+	return syscall.GetConsoleMode(syscall.Handle(fd), &mode) == nil
+}
 
 func JobControlSupported() bool {
 	return false
@@ -35,16 +72,76 @@ func JoinProcess(proc *os.Process) int {
 		return -1
 	}
 
-	return status.Sys().(syscall.WaitStatus).ExitStatus()
+	return status.ExitCode()
+}
+
+func Mkfifo(path string, mode uint32) error {
+	return errors.New("Not implemented")
+}
+
+func ProcessExists(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+
+	p.Release()
+
+	return true
 }
 
 func SetForegroundGroup(group int) {}
 
+func SetPriority(pid, n int) error {
+	return errors.New("Not implemented")
+}
+
+func SignalProcess(pid, sig int) error {
+	/* A process can be ended, but not sent any other signal. */
+	if sig != int(syscall.SIGKILL) && sig != int(syscall.SIGTERM) {
+		return errors.New("Not implemented")
+	}
+
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+
+	return p.Kill()
+}
+
 func SysProcAttr(group int) *syscall.SysProcAttr {
-	return nil
+	sys := &syscall.SysProcAttr{}
+
+	/* A background process should not see the console's interrupts. */
+	if group != 0 {
+		sys.CreationFlags = syscall.CREATE_NEW_PROCESS_GROUP
+	}
+
+	return sys
 }
 
-func TerminateProcess(pid int) {}
+func SystemLog(name, level, msg string) error {
+	return errors.New("Not implemented")
+}
+
+func TerminalSize() (rows, cols int) {
+	return 0, 0
+}
+
+func TerminateProcess(pid int) {
+	if p, err := os.FindProcess(pid); err == nil {
+		p.Kill()
+	}
+}
+
+func Umask(mask int) int {
+	return 0
+}
+
+func environmentName(name string) string {
+	return strings.ToUpper(name)
+}
 
 func evaluate(c Cell) {
 	task0.Eval <- c
@@ -0,0 +1,555 @@
+// Released under an MIT-style license. See LICENSE.
+
+package task
+
+import (
+	. "github.com/michaelmacinnis/oh/pkg/cell"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+)
+
+/*
+ * Values are exchanged with other programs, as JSON by -control, and as
+ * MessagePack or CBOR by msgpack-encode and cbor-encode, which return a
+ * buffer, and msgpack-decode and cbor-decode, which take one. Booleans,
+ * integers, floats and strings map to their counterparts, buffers to
+ * binary data (base64 encoded text in JSON), lists to arrays and objects,
+ * by their public members, to maps with string keys. Numbers are written
+ * as integers, if they are whole and fit in 64 bits, or else as floats.
+ * Other symbols are written as strings, and anything else as its text.
+ * Decoding reverses this: strings are decoded as strings, maps as objects
+ * and null as ().
+ */
+
+/*
+ * An unpacker reads values from the MessagePack or CBOR in b, for the
+ * command name, which it gives when it fails.
+ */
+type unpacker struct {
+	b    []byte
+	i    int
+	name string
+}
+
+/* Return the next n bytes. */
+func (u *unpacker) next(n uint64) []byte {
+	if n > uint64(len(u.b)-u.i) {
+		panic("error/runtime: " + u.name + ": unexpected end of input")
+	}
+
+	b := u.b[u.i : u.i+int(n)]
+	u.i += int(n)
+
+	return b
+}
+
+/* Return the next n byte, big-endian, unsigned integer. */
+func (u *unpacker) uint(n int) uint64 {
+	v := uint64(0)
+	for _, c := range u.next(uint64(n)) {
+		v = v<<8 | uint64(c)
+	}
+
+	return v
+}
+
+/* Panic with msg, and the offset at which decoding failed. */
+func (u *unpacker) fail(msg string) {
+	at := strconv.Itoa(u.i)
+	panic("error/runtime: " + u.name + ": " + msg + " at byte " + at)
+}
+
+/* Return b with the n byte, big-endian, unsigned integer v appended. */
+func appendUint(b []byte, v uint64, n int) []byte {
+	for i := n - 1; i >= 0; i-- {
+		b = append(b, byte(v>>(8*uint(i))))
+	}
+
+	return b
+}
+
+/* Return b with the CBOR encoding of v appended. */
+func cborEncode(b []byte, v interface{}) []byte {
+	head := func(major byte, n uint64) {
+		switch {
+		case n < 24:
+			b = append(b, major<<5|byte(n))
+		case n <= math.MaxUint8:
+			b = append(b, major<<5|24, byte(n))
+		case n <= math.MaxUint16:
+			b = appendUint(append(b, major<<5|25), n, 2)
+		case n <= math.MaxUint32:
+			b = appendUint(append(b, major<<5|26), n, 4)
+		default:
+			b = appendUint(append(b, major<<5|27), n, 8)
+		}
+	}
+
+	switch v := v.(type) {
+	case nil:
+		b = append(b, 0xf6)
+	case bool:
+		if v {
+			b = append(b, 0xf5)
+		} else {
+			b = append(b, 0xf4)
+		}
+	case int64:
+		if v < 0 {
+			head(1, uint64(-(v + 1)))
+		} else {
+			head(0, uint64(v))
+		}
+	case float64:
+		b = appendUint(append(b, 0xfb), math.Float64bits(v), 8)
+	case string:
+		head(3, uint64(len(v)))
+		b = append(b, v...)
+	case []byte:
+		head(2, uint64(len(v)))
+		b = append(b, v...)
+	case []interface{}:
+		head(4, uint64(len(v)))
+		for _, e := range v {
+			b = cborEncode(b, e)
+		}
+	case map[string]interface{}:
+		head(5, uint64(len(v)))
+		for _, k := range sortedKeys(v) {
+			b = cborEncode(b, k)
+			b = cborEncode(b, v[k])
+		}
+	}
+
+	return b
+}
+
+/*
+ * Return the next CBOR value. Tags are skipped, undefined is decoded as
+ * null, and strings, arrays and maps may be of indefinite length.
+ */
+func (u *unpacker) cbor() interface{} {
+	c := u.next(1)[0]
+	major, info := c>>5, c&0x1f
+
+	n := uint64(info)
+	switch {
+	case info == 24:
+		n = u.uint(1)
+	case info == 25:
+		n = u.uint(2)
+	case info == 26:
+		n = u.uint(4)
+	case info == 27:
+		n = u.uint(8)
+	case info == 31 && major >= 2 && major <= 5:
+		return u.cborIndefinite(major)
+	case info > 23:
+		u.fail("invalid header " + strconv.Itoa(int(c)))
+	}
+
+	switch major {
+	case 0:
+		if n > math.MaxInt64 {
+			return float64(n)
+		}
+		return int64(n)
+	case 1:
+		if n > math.MaxInt64 {
+			return -1 - float64(n)
+		}
+		return -1 - int64(n)
+	case 2:
+		return append([]byte{}, u.next(n)...)
+	case 3:
+		return string(u.next(n))
+	case 4:
+		l := []interface{}{}
+		for ; n > 0; n-- {
+			l = append(l, u.cbor())
+		}
+		return l
+	case 5:
+		m := map[string]interface{}{}
+		for ; n > 0; n-- {
+			k := u.key(u.cbor())
+			m[k] = u.cbor()
+		}
+		return m
+	case 6:
+		return u.cbor()
+	}
+
+	switch info {
+	case 20:
+		return false
+	case 21:
+		return true
+	case 22, 23:
+		return nil
+	case 25:
+		return float16(uint16(n))
+	case 26:
+		return float64(math.Float32frombits(uint32(n)))
+	case 27:
+		return math.Float64frombits(n)
+	}
+
+	u.fail("unsupported simple value " + strconv.Itoa(int(n)))
+
+	return nil
+}
+
+/* Return the next CBOR string, array or map of indefinite length. */
+func (u *unpacker) cborIndefinite(major byte) interface{} {
+	end := func() bool {
+		if u.i < len(u.b) && u.b[u.i] == 0xff {
+			u.i++
+			return true
+		}
+		return false
+	}
+
+	switch major {
+	case 2, 3:
+		s := []byte{}
+		for !end() {
+			switch chunk := u.cbor().(type) {
+			case []byte:
+				s = append(s, chunk...)
+			case string:
+				s = append(s, chunk...)
+			default:
+				u.fail("invalid string chunk")
+			}
+		}
+		if major == 3 {
+			return string(s)
+		}
+		return s
+	case 4:
+		l := []interface{}{}
+		for !end() {
+			l = append(l, u.cbor())
+		}
+		return l
+	}
+
+	m := map[string]interface{}{}
+	for !end() {
+		k := u.key(u.cbor())
+		m[k] = u.cbor()
+	}
+
+	return m
+}
+
+/* Return the value of the IEEE 754 half-precision float h. */
+func float16(h uint16) float64 {
+	sign := 1.0
+	if h&0x8000 != 0 {
+		sign = -1.0
+	}
+
+	exp, frac := int(h>>10&0x1f), float64(h&0x3ff)
+	switch exp {
+	case 0:
+		return sign * math.Ldexp(frac, -24)
+	case 0x1f:
+		if frac != 0 {
+			return math.NaN()
+		}
+		return math.Inf(int(sign))
+	}
+
+	return sign * math.Ldexp(frac+1024, exp-25)
+}
+
+/* Return the cell for v, a value decoded from JSON, MessagePack or CBOR. */
+func jsonCell(t *Task, v interface{}) Cell {
+	switch v := v.(type) {
+	case bool:
+		return NewBoolean(v)
+	case int64:
+		return NewInteger(v)
+	case float64:
+		return NewFloat(v)
+	case string:
+		return NewString(t, v)
+	case []byte:
+		return NewBuffer(t, v)
+	case []interface{}:
+		l := make([]Cell, len(v))
+		for i, e := range v {
+			l[i] = jsonCell(t, e)
+		}
+		return List(l...)
+	case map[string]interface{}:
+		s := NewScope(scope0, nil)
+		for k, e := range v {
+			s.Public(NewSymbol(k), jsonCell(t, e))
+		}
+		return NewObject(s)
+	}
+
+	return Null
+}
+
+/* Return c as a value that can be converted to JSON. */
+func jsonValue(c Cell, seen map[Cell]bool) interface{} {
+	if seen[c] {
+		return c.String()
+	}
+
+	switch v := c.(type) {
+	case *Boolean:
+		return v.Bool()
+	case *Buffer:
+		return v.v
+	case *Float:
+		return v.Float()
+	case *Integer, *Status:
+		return v.(Atom).Int()
+	case Rational:
+		return ratValue(v.Rat())
+	case *Object:
+		seen[c] = true
+		defer delete(seen, c)
+
+		m := map[string]interface{}{}
+		for _, p := range members(v) {
+			m[raw(Car(p))] = jsonValue(Cdr(p), seen)
+		}
+
+		return m
+	case *String:
+		return v.Raw()
+	case *Symbol:
+		if i, err := strconv.ParseInt(raw(v), 10, 64); err == nil {
+			return i
+		}
+
+		if r, ok := new(big.Rat).SetString(raw(v)); ok {
+			f, _ := r.Float64()
+			return f
+		}
+
+		return v.String()
+	}
+
+	if !isList(c) {
+		return c.String()
+	}
+
+	seen[c] = true
+	defer delete(seen, c)
+
+	l := []interface{}{}
+	for _, e := range elements(c) {
+		l = append(l, jsonValue(e, seen))
+	}
+
+	return l
+}
+
+/* Return the map key k as a string. */
+func (u *unpacker) key(k interface{}) string {
+	switch k := k.(type) {
+	case string:
+		return k
+	case int64:
+		return strconv.FormatInt(k, 10)
+	}
+
+	u.fail("unsupported map key")
+
+	return ""
+}
+
+/* Return b with the MessagePack encoding of v appended. */
+func msgpackEncode(b []byte, v interface{}) []byte {
+	head := func(fix byte, limit int, codes [3]byte, n int) {
+		switch {
+		case n < limit:
+			b = append(b, fix|byte(n))
+		case codes[0] != 0 && n <= math.MaxUint8:
+			b = append(b, codes[0], byte(n))
+		case n <= math.MaxUint16:
+			b = appendUint(append(b, codes[1]), uint64(n), 2)
+		default:
+			b = appendUint(append(b, codes[2]), uint64(n), 4)
+		}
+	}
+
+	switch v := v.(type) {
+	case nil:
+		b = append(b, 0xc0)
+	case bool:
+		if v {
+			b = append(b, 0xc3)
+		} else {
+			b = append(b, 0xc2)
+		}
+	case int64:
+		switch {
+		case v >= 0 && v <= math.MaxInt8, v < 0 && v >= -32:
+			b = append(b, byte(v))
+		case v >= 0 && v <= math.MaxUint8:
+			b = append(b, 0xcc, byte(v))
+		case v >= 0 && v <= math.MaxUint16:
+			b = appendUint(append(b, 0xcd), uint64(v), 2)
+		case v >= 0 && v <= math.MaxUint32:
+			b = appendUint(append(b, 0xce), uint64(v), 4)
+		case v >= 0:
+			b = appendUint(append(b, 0xcf), uint64(v), 8)
+		case v >= math.MinInt8:
+			b = append(b, 0xd0, byte(v))
+		case v >= math.MinInt16:
+			b = appendUint(append(b, 0xd1), uint64(v), 2)
+		case v >= math.MinInt32:
+			b = appendUint(append(b, 0xd2), uint64(v), 4)
+		default:
+			b = appendUint(append(b, 0xd3), uint64(v), 8)
+		}
+	case float64:
+		b = appendUint(append(b, 0xcb), math.Float64bits(v), 8)
+	case string:
+		head(0xa0, 32, [3]byte{0xd9, 0xda, 0xdb}, len(v))
+		b = append(b, v...)
+	case []byte:
+		head(0, 0, [3]byte{0xc4, 0xc5, 0xc6}, len(v))
+		b = append(b, v...)
+	case []interface{}:
+		head(0x90, 16, [3]byte{0, 0xdc, 0xdd}, len(v))
+		for _, e := range v {
+			b = msgpackEncode(b, e)
+		}
+	case map[string]interface{}:
+		head(0x80, 16, [3]byte{0, 0xde, 0xdf}, len(v))
+		for _, k := range sortedKeys(v) {
+			b = msgpackEncode(b, k)
+			b = msgpackEncode(b, v[k])
+		}
+	}
+
+	return b
+}
+
+/* Return the next MessagePack value. */
+func (u *unpacker) msgpack() interface{} {
+	c := u.next(1)[0]
+
+	switch {
+	case c <= 0x7f:
+		return int64(c)
+	case c >= 0xe0:
+		return int64(int8(c))
+	case c&0xf0 == 0x80:
+		return u.msgpackMap(uint64(c & 0x0f))
+	case c&0xf0 == 0x90:
+		return u.msgpackArray(uint64(c & 0x0f))
+	case c&0xe0 == 0xa0:
+		return string(u.next(uint64(c & 0x1f)))
+	}
+
+	switch c {
+	case 0xc0:
+		return nil
+	case 0xc2:
+		return false
+	case 0xc3:
+		return true
+	case 0xc4, 0xc5, 0xc6:
+		n := u.uint(1 << (c - 0xc4))
+		return append([]byte{}, u.next(n)...)
+	case 0xca:
+		return float64(math.Float32frombits(uint32(u.uint(4))))
+	case 0xcb:
+		return math.Float64frombits(u.uint(8))
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		n := u.uint(1 << (c - 0xcc))
+		if n > math.MaxInt64 {
+			return float64(n)
+		}
+		return int64(n)
+	case 0xd0:
+		return int64(int8(u.uint(1)))
+	case 0xd1:
+		return int64(int16(u.uint(2)))
+	case 0xd2:
+		return int64(int32(u.uint(4)))
+	case 0xd3:
+		return int64(u.uint(8))
+	case 0xd9, 0xda, 0xdb:
+		n := u.uint(1 << (c - 0xd9))
+		return string(u.next(n))
+	case 0xdc, 0xdd:
+		return u.msgpackArray(u.uint(2 << (c - 0xdc)))
+	case 0xde, 0xdf:
+		return u.msgpackMap(u.uint(2 << (c - 0xde)))
+	}
+
+	u.fail("unsupported type " + strconv.Itoa(int(c)))
+
+	return nil
+}
+
+func (u *unpacker) msgpackArray(n uint64) interface{} {
+	l := []interface{}{}
+	for ; n > 0; n-- {
+		l = append(l, u.msgpack())
+	}
+
+	return l
+}
+
+func (u *unpacker) msgpackMap(n uint64) interface{} {
+	m := map[string]interface{}{}
+	for ; n > 0; n-- {
+		k := u.key(u.msgpack())
+		m[k] = u.msgpack()
+	}
+
+	return m
+}
+
+/*
+ * Return r as an int64, if it is a whole number that fits, or else as a
+ * float64.
+ */
+func ratValue(r *big.Rat) interface{} {
+	if r.IsInt() && r.Num().IsInt64() {
+		return r.Num().Int64()
+	}
+
+	f, _ := r.Float64()
+	return f
+}
+
+/* Return the keys of m in order. */
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+/*
+ * Return the value encoded, by format, in b, which must hold exactly one
+ * value.
+ */
+func unpack(b []byte, name string, format func(*unpacker) interface{}) interface{} {
+	u := &unpacker{b: b, name: name}
+
+	v := format(u)
+	if u.i != len(b) {
+		u.fail("unexpected data")
+	}
+
+	return v
+}
@@ -0,0 +1,253 @@
+// Released under an MIT-style license. See LICENSE.
+
+package task
+
+import (
+	. "github.com/michaelmacinnis/oh/pkg/cell"
+	"sync"
+)
+
+/*
+ * Call m with each element of l, in up to n child tasks at a time, and
+ * return the results in the order of the elements. If a call fails, the
+ * remaining calls are cancelled and the failure is raised. When more than
+ * one call fails, the failure for the earliest element is raised.
+ */
+func pmap(t *Task, n int64, m Cell, l Cell) Cell {
+	if n < 1 {
+		panic("error/runtime: pmap expects a positive number of tasks")
+	}
+
+	children := []*Task{}
+	for ; l != Null; l = Cdr(l) {
+		v := List(NewSymbol("quote"), Car(l))
+		child := NewTask(List(List(m, v)), NewEnv(t.Dynamic),
+			NewScope(t.Lexical, nil), t)
+		child.capture = true
+
+		children = append(children, child)
+	}
+
+	workers := make(chan bool, n)
+	go func() {
+		for _, child := range children {
+			workers <- true
+			go func(child *Task) {
+				child.Launch()
+				<-workers
+			}(child)
+		}
+	}()
+
+	results := []Cell{}
+	for _, child := range children {
+		<-child.Done
+		delete(t.children, child)
+
+		if child.failure != nil {
+			for _, c := range children {
+				c.Cancel()
+			}
+			panic(child.failure)
+		}
+
+		results = append(results, Car(child.Scratch))
+	}
+
+	return List(results...)
+}
+
+/*
+ * Mutexes, semaphores and wait groups synchronize tasks that share state.
+ * Each has its own methods: lock and unlock for a mutex, acquire and
+ * release for a semaphore, and add, done and wait for a wait group.
+ */
+
+var (
+	envm *Env
+	envp *Env
+	envw *Env
+)
+
+/* Return a new env with the members common to synchronization cells. */
+func newSyncEnv(kind, plural string) *Env {
+	e := NewEnv(nil)
+	e.Method("child", func(t *Task, args Cell) bool {
+		panic(plural + " cannot be parents")
+	})
+	e.Method("clone", func(t *Task, args Cell) bool {
+		panic(plural + " cannot be cloned")
+	})
+	e.Method("define", func(t *Task, args Cell) bool {
+		panic("private members cannot be added to a " + kind)
+	})
+
+	return e
+}
+
+func mutexEnv() *Env {
+	if envm != nil {
+		goto created
+	}
+
+	envm = newSyncEnv("mutex", "mutexes")
+	envm.Method("lock", func(t *Task, args Cell) bool {
+		t.Self().(*Mutex).v <- true
+		return t.Return(True)
+	})
+	envm.Method("unlock", func(t *Task, args Cell) bool {
+		select {
+		case <-t.Self().(*Mutex).v:
+		default:
+			panic("error/runtime: unlock of unlocked mutex")
+		}
+		return t.Return(True)
+	})
+
+created:
+	return envm
+}
+
+func semaphoreEnv() *Env {
+	if envp != nil {
+		goto created
+	}
+
+	envp = newSyncEnv("semaphore", "semaphores")
+	envp.Method("acquire", func(t *Task, args Cell) bool {
+		t.Self().(*Semaphore).v <- true
+		return t.Return(True)
+	})
+	envp.Method("release", func(t *Task, args Cell) bool {
+		select {
+		case <-t.Self().(*Semaphore).v:
+		default:
+			panic("error/runtime: release of unacquired semaphore")
+		}
+		return t.Return(True)
+	})
+
+created:
+	return envp
+}
+
+func waitGroupEnv() *Env {
+	if envw != nil {
+		goto created
+	}
+
+	envw = newSyncEnv("wait-group", "wait groups")
+	envw.Method("add", func(t *Task, args Cell) bool {
+		n := int64(1)
+		if args != Null {
+			n = Car(args).(Atom).Int()
+		}
+
+		t.Self().(*WaitGroup).add(int(n))
+		return t.Return(True)
+	})
+	envw.Method("done", func(t *Task, args Cell) bool {
+		t.Self().(*WaitGroup).add(-1)
+		return t.Return(True)
+	})
+	envw.Method("wait", func(t *Task, args Cell) bool {
+		t.Self().(*WaitGroup).Wait()
+		return t.Return(True)
+	})
+
+created:
+	return envw
+}
+
+/* Mutex cell definition. */
+
+type Mutex struct {
+	*Scope
+	v chan bool
+}
+
+func NewMutex(t *Task) *Mutex {
+	return &Mutex{
+		NewScope(t.Lexical.Expose(), mutexEnv()),
+		make(chan bool, 1),
+	}
+}
+
+func (m *Mutex) Equal(c Cell) bool {
+	return m == c
+}
+
+func (m *Mutex) Expose() Context {
+	return m
+}
+
+func (m *Mutex) String() string {
+	return identify("mutex", m)
+}
+
+/* Semaphore cell definition. */
+
+type Semaphore struct {
+	*Scope
+	v chan bool
+}
+
+func NewSemaphore(t *Task, n int) *Semaphore {
+	return &Semaphore{
+		NewScope(t.Lexical.Expose(), semaphoreEnv()),
+		make(chan bool, n),
+	}
+}
+
+func (s *Semaphore) Equal(c Cell) bool {
+	return s == c
+}
+
+func (s *Semaphore) Expose() Context {
+	return s
+}
+
+func (s *Semaphore) String() string {
+	return identify("semaphore", s)
+}
+
+/* WaitGroup cell definition. */
+
+type WaitGroup struct {
+	*Scope
+	sync.Mutex
+	sync.WaitGroup
+	n int
+}
+
+func NewWaitGroup(t *Task) *WaitGroup {
+	return &WaitGroup{
+		Scope: NewScope(t.Lexical.Expose(), waitGroupEnv()),
+	}
+}
+
+func (w *WaitGroup) Equal(c Cell) bool {
+	return w == c
+}
+
+func (w *WaitGroup) Expose() Context {
+	return w
+}
+
+func (w *WaitGroup) String() string {
+	return identify("wait-group", w)
+}
+
+/* WaitGroup-specific functions. */
+
+func (w *WaitGroup) add(n int) {
+	w.Lock()
+	defer w.Unlock()
+
+	if w.n+n < 0 {
+		panic("error/runtime: wait-group counter cannot be negative")
+	}
+
+	w.n += n
+	w.Add(n)
+}
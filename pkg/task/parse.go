@@ -0,0 +1,226 @@
+// Released under an MIT-style license. See LICENSE.
+
+package task
+
+import (
+	"bufio"
+	. "github.com/michaelmacinnis/oh/pkg/cell"
+	"strings"
+)
+
+/*
+ * The parse-string method parses oh source text into the lists that would
+ * otherwise be evaluated, one for each command, and unparse writes such
+ * lists back out as source text. Operators are written infix, as they
+ * were typed, and nested lists are written in parentheses, which the
+ * parser reads back as the same list, so that the text produced by
+ * unparse parses to the commands that it was given.
+ */
+
+/* Operators, by the name the parser gives them. */
+var operators = map[string]string{
+	"and":               "&&",
+	"append-stderr":     "!>>",
+	"append-stdout":     ">>",
+	"channel-stderr":    "!|+",
+	"channel-stdout":    "|+",
+	"or":                "||",
+	"pipe-stderr":       "!|",
+	"pipe-stdout":       "|",
+	"redirect-stderr":   "!>",
+	"redirect-stdin":    "<",
+	"redirect-stdout":   ">",
+	"spawn":             "&",
+	"substitute-stdin":  ">(",
+	"substitute-stdout": "<(",
+}
+
+/* Operator precedence, from loosest to tightest, as in the grammar. */
+const (
+	background = iota + 1
+	disjunction
+	conjunction
+	pipeline
+	redirection
+	statement
+)
+
+/* Return the precedence of the operator named name. */
+func precedence(name string) int {
+	switch name {
+	case "spawn":
+		return background
+	case "or":
+		return disjunction
+	case "and":
+		return conjunction
+	case "channel-stderr", "channel-stdout", "pipe-stderr", "pipe-stdout":
+		return pipeline
+	case "append-stderr", "append-stdout",
+		"redirect-stderr", "redirect-stdin", "redirect-stdout":
+		return redirection
+	}
+
+	return statement
+}
+
+/* A lines reader counts, and keeps, the lines that the parser reads. */
+type lines struct {
+	*bufio.Reader
+	read []string
+}
+
+func (l *lines) ReadString(delim byte) (string, error) {
+	s, err := l.Reader.ReadString(delim)
+	if len(s) > 0 {
+		l.read = append(l.read, s)
+	}
+
+	return s, err
+}
+
+/*
+ * Parse text and return a list of its commands or, if locations is true,
+ * a list of (line command) pairs, where line is the line, counting from
+ * one, on which the command starts.
+ */
+func parseString(t *Task, text string, locations bool) Cell {
+	l := &lines{Reader: bufio.NewReader(strings.NewReader(text + "\n"))}
+
+	commands := []Cell{}
+	next := 0
+	ok := parse(t, l, deref, func(c Cell) {
+		if !locations {
+			commands = append(commands, c)
+			return
+		}
+
+		for next < len(l.read)-1 && skipped(l.read[next]) {
+			next++
+		}
+
+		line := NewInteger(int64(next + 1))
+		commands = append(commands, List(line, c))
+
+		next = len(l.read)
+	})
+	if !ok {
+		panic("error/syntax: parse-string: invalid syntax")
+	}
+
+	return List(commands...)
+}
+
+/* Is the line s blank or a comment? */
+func skipped(s string) bool {
+	s = strings.TrimSpace(s)
+
+	return s == "" || s[0] == '#'
+}
+
+/* Return the commands in the list l as source text, one per line. */
+func unparse(l Cell) string {
+	return join(l, "\n", func(c Cell) string {
+		return unparseCommand(c, 0)
+	})
+}
+
+/*
+ * Return the command c as source text. An operator is written infix only
+ * if it binds at least as tightly as prec. Otherwise, and for anything
+ * that is not an operator, the command is written as a list of words.
+ */
+func unparseCommand(c Cell, prec int) string {
+	if !isList(c) || c == Null {
+		return unparseExpression(c)
+	}
+
+	name := ""
+	if s, ok := Car(c).(*Symbol); ok {
+		name = s.String()
+	}
+
+	n := Length(c)
+	switch p := precedence(name); {
+	case name == "block" && n > 2:
+		return join(Cdr(c), "; ", func(c Cell) string {
+			return unparseCommand(c, statement)
+		})
+	case name == "process-substitution":
+		return join(Cdr(c), " ", unparseExpression)
+	case p < prec:
+	case name == "spawn" && n == 2:
+		return unparseCommand(Cadr(c), p) + " " + operators[name]
+	case p == redirection && n == 3:
+		return unparseCommand(Caddr(c), p) + " " + operators[name] +
+			" " + unparseExpression(Cadr(c))
+	case p != statement && n == 3:
+		return unparseCommand(Cadr(c), p) + " " + operators[name] +
+			" " + unparseCommand(Caddr(c), p+1)
+	}
+
+	return join(c, " ", unparseExpression)
+}
+
+func unparseExpression(c Cell) string {
+	if c == Null {
+		return "()"
+	}
+
+	if !IsCons(c) {
+		return c.String()
+	}
+
+	if !isList(c) {
+		return unparseExpression(Car(c)) + "::" + unparseExpression(Cdr(c))
+	}
+
+	name := ""
+	if s, ok := Car(c).(*Symbol); ok {
+		name = s.String()
+	}
+
+	n := Length(c)
+	switch {
+	case name == "backtick" && n == 2:
+		return "`" + unparseExpression(Cadr(c))
+	case name == "splice" && n == 2:
+		return "@" + unparseExpression(Cadr(c))
+	case strings.HasPrefix(name, "substitute-") && n > 1:
+		return operators[name] + unparseCommand(Cdr(c), 0) + ")"
+	case isJoin(Car(c)) && n == 3:
+		return unparseExpression(Cadr(c)) + "^" + unparseExpression(Caddr(c))
+	}
+
+	return "(" + unparseCommand(c, 0) + ")"
+}
+
+/* Is c the head of a list written a^b? */
+func isJoin(c Cell) bool {
+	if !IsCons(c) || c == Null || isList(c) {
+		return false
+	}
+
+	s, ok := Car(c).(*String)
+
+	return ok && s.Raw() == "" && raw(Cdr(c)) == "join"
+}
+
+/* Return the elements of l, each written with f, separated by sep. */
+func join(l Cell, sep string, f func(Cell) string) string {
+	s := []string{}
+	for ; l != Null; l = Cdr(l) {
+		s = append(s, f(Car(l)))
+	}
+
+	return strings.Join(s, sep)
+}
+
+/* Is c a proper list? */
+func isList(c Cell) bool {
+	for IsCons(c) && c != Null {
+		c = Cdr(c)
+	}
+
+	return c == Null
+}
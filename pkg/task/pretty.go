@@ -0,0 +1,290 @@
+// Released under an MIT-style license. See LICENSE.
+
+package task
+
+import (
+	. "github.com/michaelmacinnis/oh/pkg/cell"
+	"os"
+	"regexp"
+	"strings"
+)
+
+/*
+ * A list or object that fits in the remaining width is written on one
+ * line. Otherwise its first element follows the opening parenthesis and
+ * each remaining element is written on its own line, indented to line up
+ * with the first. A list or object that contains itself is written as
+ * "..." where it recurs. If color is true, strings, numbers and statuses
+ * are highlighted using ANSI escape sequences.
+ */
+
+const defaultWidth = 80
+
+const (
+	ansiCyan    = "\x1b[36m"
+	ansiGreen   = "\x1b[32m"
+	ansiRed     = "\x1b[31m"
+	ansiReset   = "\x1b[0m"
+	ansiReverse = "\x1b[7m"
+	ansiYellow  = "\x1b[33m"
+)
+
+/* ANSI escape sequences, as matched by strip-ansi. */
+var escapes = regexp.MustCompile("\x1b\\[[0-9;]*[A-Za-z]")
+
+/* SGR parameters for the attributes accepted by style. */
+var styles = map[string]string{
+	"reset":     "0",
+	"bold":      "1",
+	"dim":       "2",
+	"italic":    "3",
+	"underline": "4",
+	"reverse":   "7",
+	"black":     "30",
+	"red":       "31",
+	"green":     "32",
+	"yellow":    "33",
+	"blue":      "34",
+	"magenta":   "35",
+	"cyan":      "36",
+	"white":     "37",
+}
+
+type printer struct {
+	b      strings.Builder
+	active map[Cell]bool
+	color  bool
+	width  int
+}
+
+func pretty(c Cell, width int, color bool) string {
+	p := &printer{active: map[Cell]bool{}, color: color, width: width}
+
+	p.format(c, 0)
+
+	return p.b.String()
+}
+
+/* Return c written on a single line, highlighted if color is true. */
+func (p *printer) flat(c Cell, color bool) string {
+	if p.active[c] {
+		return "..."
+	}
+
+	elements, open := p.open(c)
+	if elements == nil {
+		return p.paint(c, color)
+	}
+
+	p.active[c] = true
+	defer delete(p.active, c)
+
+	s := []string{}
+	for _, e := range elements {
+		s = append(s, p.flat(e, color))
+	}
+
+	return open + strings.Join(s, " ") + ")"
+}
+
+func (p *printer) format(c Cell, col int) {
+	s := p.flat(c, false)
+
+	elements, open := p.open(c)
+	if elements == nil || p.active[c] || col+len(s) <= p.width {
+		p.b.WriteString(p.flat(c, p.color))
+		return
+	}
+
+	p.active[c] = true
+	defer delete(p.active, c)
+
+	p.b.WriteString(open)
+
+	col += len(open)
+	pad := "\n" + strings.Repeat(" ", col)
+	for i, e := range elements {
+		if i > 0 {
+			p.b.WriteString(pad)
+		}
+		p.format(e, col)
+	}
+
+	p.b.WriteString(")")
+}
+
+/*
+ * Return the elements of a list or object, and how it opens, or nil if c
+ * is neither. The tail of a dotted list is preceded by the symbol ".".
+ * A tail that leads back into the list is written as "...".
+ */
+func (p *printer) open(c Cell) ([]Cell, string) {
+	if o, ok := c.(*Object); ok {
+		l := []Cell{}
+		for _, m := range members(o) {
+			l = append(l, List(Car(m), Cdr(m)))
+		}
+		return l, "#object("
+	}
+
+	if !IsCons(c) || c == Null {
+		return nil, ""
+	}
+
+	l := []Cell{}
+	seen := map[Cell]bool{}
+	for ; IsCons(c) && c != Null; c = Cdr(c) {
+		if len(l) > 0 && (seen[c] || p.active[c]) {
+			return append(l, NewSymbol("."), NewSymbol("...")), "("
+		}
+		seen[c] = true
+
+		l = append(l, Car(c))
+	}
+
+	if c != Null {
+		l = append(l, NewSymbol("."), c)
+	}
+
+	return l, "("
+}
+
+/* Return the atom c written, if color is true, in a color for its type. */
+func (p *printer) paint(c Cell, color bool) string {
+	s := c.String()
+	if !color {
+		return s
+	}
+
+	switch c.(type) {
+	case *Float, *Integer, Rational:
+		return ansiCyan + s + ansiReset
+	case *Boolean:
+		return ansiYellow + s + ansiReset
+	case *Status:
+		if status(c) != 0 {
+			return ansiRed + s + ansiReset
+		}
+		return ansiYellow + s + ansiReset
+	case *String:
+		return ansiGreen + s + ansiReset
+	}
+
+	return s
+}
+
+/*
+ * Return the escape sequence that sets the named attributes or, if out is
+ * not a terminal, an empty string.
+ */
+func style(out Cell, names Cell) string {
+	codes := []string{}
+	for ; names != Null; names = Cdr(names) {
+		code, ok := styles[raw(Car(names))]
+		if !ok {
+			panic("error/runtime: unknown style: " + raw(Car(names)))
+		}
+		codes = append(codes, code)
+	}
+
+	if len(codes) == 0 || !terminal(out) {
+		return ""
+	}
+
+	return "\x1b[" + strings.Join(codes, ";") + "m"
+}
+
+/* Return true if c is a pipe whose write end is a terminal. */
+func terminal(c Cell) bool {
+	p, ok := c.(Context)
+	if !ok {
+		return false
+	}
+
+	w, ok := asConduit(p).(*Pipe)
+
+	return ok && w.WriteFd() != nil && IsTerminal(w.WriteFd().Fd())
+}
+
+/*
+ * Write s to $stdout. If s has more lines than the terminal, it is written
+ * through $PAGER or, if $PAGER is not set or cannot be run, a screen at a
+ * time, waiting for enter (or q to quit) on $stdin between screens.
+ */
+func (t *Task) page(s string) {
+	rows, _ := TerminalSize()
+	if rows < 2 || strings.Count(s, "\n") < rows {
+		t.Fprintf("$stdout", "%s", s)
+		return
+	}
+
+	args := strings.Fields(os.Getenv("PAGER"))
+	if len(args) > 0 && allowed("exec") && t.pager(args, s) {
+		return
+	}
+
+	if jobControlEnabled() {
+		SetForegroundGroup(pgid)
+	}
+
+	in := Resolve(t.Lexical, t.Dynamic, NewSymbol("$stdin")).Get()
+	lines := strings.SplitAfter(s, "\n")
+	for {
+		n := rows - 1
+		if n > len(lines) {
+			n = len(lines)
+		}
+
+		t.Fprintf("$stdout", "%s", strings.Join(lines[:n], ""))
+
+		lines = lines[n:]
+		if len(lines) == 0 {
+			return
+		}
+
+		t.Fprintf("$stdout", "--More--")
+
+		reply := toConduit(in.(Context)).ReadLine(t)
+		if reply == Null || strings.HasPrefix(raw(reply), "q") {
+			return
+		}
+	}
+}
+
+/*
+ * Run the pager args, as an external command, with s on its standard
+ * input. Return true if the pager ran and succeeded.
+ */
+func (t *Task) pager(args []string, s string) bool {
+	if mocked(t, args[0]) == nil {
+		if _, err := t.runner().LookPath(args[0]); err != nil {
+			return false
+		}
+	}
+
+	p := NewPipe(t.Lexical, nil, nil)
+	w := toConduit(p)
+
+	go func() {
+		if f := w.(*Pipe).WriteFd(); f != nil {
+			_, _ = f.WriteString(s)
+		}
+		w.WriterClose()
+	}()
+
+	cmd := []Cell{}
+	for _, a := range args {
+		cmd = append(cmd, NewString(t, a))
+	}
+
+	saved := t.Dynamic
+	t.Dynamic = NewEnv(saved)
+	t.Dynamic.Add(NewSymbol("$stdin"), p)
+
+	ok := t.execute(List(cmd...)) && t.result.Bool()
+
+	t.Dynamic = saved
+	w.ReaderClose()
+
+	return ok
+}
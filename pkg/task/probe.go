@@ -0,0 +1,137 @@
+// Released under an MIT-style license. See LICENSE.
+
+package task
+
+import (
+	"errors"
+	"net"
+	"os"
+	"syscall"
+	"time"
+)
+
+/*
+ * The tcp-check command connects to a port on a host and returns the time,
+ * in seconds, that the connection took, or an error if it could not be
+ * made within the timeout. The reachable? command sends an ICMP echo
+ * request (a ping) to a host and returns the time, in seconds, until the
+ * reply, or false if there is no reply within the timeout. Sending an
+ * ICMP echo request usually needs privileges that oh does not have; when
+ * it cannot, reachable? instead connects to port 80 on the host, which is
+ * reachable if the connection is accepted or refused. The timeout, by
+ * default five seconds, is a number of seconds or a duration like 500ms.
+ */
+
+/* How long tcp-check and reachable? wait, unless told otherwise. */
+const probeTimeout = 5 * time.Second
+
+/* The port to which reachable? connects when it cannot ping. */
+const probePort = "80"
+
+/* Return the internet checksum of b. */
+func checksum(b []byte) uint16 {
+	sum := 0
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += int(b[i])<<8 | int(b[i+1])
+	}
+	if len(b)%2 == 1 {
+		sum += int(b[len(b)-1]) << 8
+	}
+
+	for sum > 0xffff {
+		sum = sum>>16 + sum&0xffff
+	}
+
+	return ^uint16(sum)
+}
+
+/*
+ * Return the time taken for host to answer an ICMP echo request. Returns
+ * ok as false if the request could not be sent.
+ */
+func ping(host string, timeout time.Duration) (d time.Duration, ok bool, err error) {
+	a, err := net.ResolveIPAddr("ip4", host)
+	if err != nil {
+		return 0, false, err
+	}
+
+	c, err := net.ListenPacket("ip4:icmp", "0.0.0.0")
+	if err != nil {
+		return 0, false, err
+	}
+	defer c.Close()
+
+	id := os.Getpid() & 0xffff
+	seq := int(time.Now().UnixNano() & 0xffff)
+
+	request := []byte{8, 0, 0, 0, byte(id >> 8), byte(id), byte(seq >> 8), byte(seq)}
+	request = append(request, "oh"...)
+
+	sum := checksum(request)
+	request[2], request[3] = byte(sum>>8), byte(sum)
+
+	start := time.Now()
+	c.SetDeadline(start.Add(timeout))
+
+	if _, err = c.WriteTo(request, a); err != nil {
+		return 0, false, err
+	}
+
+	reply := make([]byte, 1500)
+	for {
+		n, _, err := c.ReadFrom(reply)
+		if err != nil {
+			return 0, true, err
+		}
+
+		/* Skip anything but an echo reply to this request. */
+		if n < 8 || reply[0] != 0 || reply[1] != 0 {
+			continue
+		}
+		if int(reply[4])<<8|int(reply[5]) != id {
+			continue
+		}
+		if int(reply[6])<<8|int(reply[7]) != seq {
+			continue
+		}
+
+		return time.Since(start), true, nil
+	}
+}
+
+/* Return the time taken for host to reply, and whether it did. */
+func reachable(host string, timeout time.Duration) (time.Duration, bool) {
+	demand("net")
+
+	d, sent, err := ping(host, timeout)
+	if sent {
+		return d, err == nil
+	}
+
+	start := time.Now()
+
+	address := net.JoinHostPort(host, probePort)
+	c, err := net.DialTimeout("tcp", address, timeout)
+	if err == nil {
+		c.Close()
+	} else if !errors.Is(err, syscall.ECONNREFUSED) {
+		return 0, false
+	}
+
+	return time.Since(start), true
+}
+
+/* Return the time taken to connect to port on host. */
+func tcpCheck(host, port string, timeout time.Duration) (time.Duration, error) {
+	demand("net")
+
+	start := time.Now()
+
+	c, err := net.DialTimeout("tcp", net.JoinHostPort(host, port), timeout)
+	if err != nil {
+		return 0, err
+	}
+	c.Close()
+
+	return time.Since(start), nil
+}
@@ -0,0 +1,141 @@
+// Released under an MIT-style license. See LICENSE.
+
+package task
+
+import (
+	. "github.com/michaelmacinnis/oh/pkg/cell"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+/*
+ * The process-list command returns an object for each process running on
+ * the system, with the members:
+ *
+ *     pid      the process ID
+ *     ppid     the ID of its parent
+ *     name     the name of the program it is running
+ *     command  its command line or, if that cannot be read, its name
+ *     rss      its resident set size, the memory it is using, in bytes
+ *
+ * The pidof command returns the IDs of the processes running a program,
+ * matched by name or by the base name of the first word of the command
+ * line, skipping those that have ended but not yet been waited for. The
+ * process-exists? command returns true if there is a process with an ID.
+ * Processes are read from /proc on Linux and by sysctl on macOS, on amd64
+ * and arm64, where rss is 0 for another user's processes. Elsewhere,
+ * including on the BSDs, the process table cannot yet be read, and
+ * process-list and pidof are errors.
+ *
+ * The kill command sends a signal, SIGTERM by default, to processes:
+ *
+ *     kill [-signal | --signal signal] process...
+ *
+ * The signal is a number or a name, like TERM, in $signals. Each process
+ * is an ID, an object with a pid member, like those returned by
+ * process-list, or a list of these, like the list returned by pidof.
+ */
+
+/* A ProcessInfo describes a process running on the system. */
+type ProcessInfo struct {
+	Pid, Ppid     int
+	Name, Command string
+	RSS           uint64
+	Zombie        bool
+}
+
+var killParams = List(List(NewSymbol("--signal"), Null))
+
+/* Send a signal to each process in args, and return true, or an error. */
+func kill(t *Task, args Cell) Cell {
+	args, values := keywords(killParams, args)
+
+	sig := int(syscall.SIGTERM)
+	if s, ok := values["--signal"]; ok {
+		sig = signalNumber(s)
+	} else if a := Car(args); IsAtom(a) && strings.HasPrefix(raw(a), "-") {
+		sig = signalNumber(NewSymbol(raw(a)[1:]))
+		args = Cdr(args)
+	}
+
+	for _, p := range flatten(args, -1, nil) {
+		if err := SignalProcess(processID(p), sig); err != nil {
+			return NewError(t, err)
+		}
+	}
+
+	return True
+}
+
+/* Return the IDs of the processes running the program name. */
+func pidof(t *Task, name string) Cell {
+	ps, err := Processes()
+	if err != nil {
+		return NewError(t, err)
+	}
+
+	l := []Cell{}
+	for _, p := range ps {
+		if p.Zombie {
+			continue
+		}
+
+		if p.Name == name || program(p.Command) == name {
+			l = append(l, NewInteger(int64(p.Pid)))
+		}
+	}
+
+	return List(l...)
+}
+
+/* Return an object for each process running on the system. */
+func processList(t *Task) Cell {
+	ps, err := Processes()
+	if err != nil {
+		return NewError(t, err)
+	}
+
+	l := []Cell{}
+	for _, p := range ps {
+		s := NewScope(scope0, nil)
+		s.Public(NewSymbol("command"), NewString(t, p.Command))
+		s.Public(NewSymbol("name"), NewString(t, p.Name))
+		s.Public(NewSymbol("pid"), NewInteger(int64(p.Pid)))
+		s.Public(NewSymbol("ppid"), NewInteger(int64(p.Ppid)))
+		s.Public(NewSymbol("rss"), NewInteger(int64(p.RSS)))
+
+		l = append(l, NewObject(s))
+	}
+
+	return List(l...)
+}
+
+/* Return the process ID c, or the pid member of the object c. */
+func processID(c Cell) int {
+	if o, ok := c.(*Object); ok {
+		r := o.Access(NewSymbol("pid"))
+		if r == nil {
+			panic("error/runtime: object has no pid")
+		}
+
+		c = r.Get()
+	}
+
+	a, ok := c.(Atom)
+	if !ok {
+		panic("error/runtime: not a process: " + c.String())
+	}
+
+	return int(a.Int())
+}
+
+/* Return the base name of the first word in command. */
+func program(command string) string {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return ""
+	}
+
+	return filepath.Base(fields[0])
+}
@@ -0,0 +1,160 @@
+// Released under an MIT-style license. See LICENSE.
+
+// +build amd64 arm64
+
+package task
+
+import (
+	"bytes"
+	"encoding/binary"
+	"syscall"
+	"unsafe"
+)
+
+/* The sysctl names, as numbers, for the process table and arguments. */
+var (
+	kernProcAll   = []int32{1, 14, 0} /* CTL_KERN, KERN_PROC, KERN_PROC_ALL */
+	kernProcArgs2 = []int32{1, 49}    /* CTL_KERN, KERN_PROCARGS2 */
+)
+
+/* The state of a process that has ended but not been waited for. */
+const szomb = 5
+
+/*
+ * The size of a struct kinfo_proc, and the offsets of its fields, which
+ * are the same on amd64 and arm64 but not on other architectures.
+ */
+const (
+	kinfoProcSize = 648
+	kinfoStat     = 36
+	kinfoPid      = 40
+	kinfoComm     = 243
+	kinfoCommSize = 17
+	kinfoPpid     = 560
+)
+
+/*
+ * The proc_info call and flavor that read a struct proc_taskinfo, its
+ * size, and the offset of its resident size.
+ */
+const (
+	procInfoCallPidinfo = 2
+	procPidTaskinfo     = 4
+	procTaskinfoSize    = 96
+	ptiResidentSize     = 8
+)
+
+/* Return the processes running on the system, as read by sysctl. */
+func Processes() ([]ProcessInfo, error) {
+	b, err := sysctlMib(kernProcAll)
+	if err != nil {
+		return nil, err
+	}
+
+	l := []ProcessInfo{}
+	for ; len(b) >= kinfoProcSize; b = b[kinfoProcSize:] {
+		p := ProcessInfo{
+			Pid:  int(*(*int32)(unsafe.Pointer(&b[kinfoPid]))),
+			Ppid: int(*(*int32)(unsafe.Pointer(&b[kinfoPpid]))),
+
+			Zombie: b[kinfoStat] == szomb,
+		}
+		p.RSS = procRSS(p.Pid)
+
+		comm := b[kinfoComm : kinfoComm+kinfoCommSize]
+		if n := bytes.IndexByte(comm, 0); n >= 0 {
+			comm = comm[:n]
+		}
+		p.Name = string(comm)
+
+		p.Command = p.Name
+		if argv := procArgs(p.Pid); len(argv) > 0 {
+			p.Command = string(bytes.Join(argv, []byte{' '}))
+		}
+
+		l = append(l, p)
+	}
+
+	return l, nil
+}
+
+/*
+ * Return the arguments of the process pid, or nil if they cannot be read,
+ * as they cannot for another user's processes. They follow the number of
+ * arguments and the path of the executable, each ended by zero bytes.
+ */
+func procArgs(pid int) [][]byte {
+	b, err := sysctlMib(append(kernProcArgs2, int32(pid)))
+	if err != nil || len(b) < 4 {
+		return nil
+	}
+
+	argc := int(binary.LittleEndian.Uint32(b))
+
+	b = b[4:]
+	if n := bytes.IndexByte(b, 0); n >= 0 {
+		b = bytes.TrimLeft(b[n:], "\x00")
+	}
+
+	argv := [][]byte{}
+	for len(argv) < argc && len(b) > 0 {
+		n := bytes.IndexByte(b, 0)
+		if n < 0 {
+			n = len(b)
+		}
+
+		argv = append(argv, b[:n])
+		b = b[n:]
+		if len(b) > 0 {
+			b = b[1:]
+		}
+	}
+
+	return argv
+}
+
+/*
+ * Return the resident set size of the process pid, in bytes, or 0 if it
+ * cannot be read, as it cannot for another user's processes.
+ */
+func procRSS(pid int) uint64 {
+	b := make([]byte, procTaskinfoSize)
+
+	n, _, errno := syscall.Syscall6(syscall.SYS_PROC_INFO,
+		procInfoCallPidinfo, uintptr(pid), procPidTaskinfo, 0,
+		uintptr(unsafe.Pointer(&b[0])), uintptr(len(b)))
+	if errno != 0 || n < procTaskinfoSize {
+		return 0
+	}
+
+	return binary.LittleEndian.Uint64(b[ptiResidentSize:])
+}
+
+/* Return the value of the sysctl mib, which can grow between calls. */
+func sysctlMib(mib []int32) ([]byte, error) {
+	for {
+		n := uintptr(0)
+
+		_, _, errno := syscall.Syscall6(syscall.SYS___SYSCTL,
+			uintptr(unsafe.Pointer(&mib[0])), uintptr(len(mib)),
+			0, uintptr(unsafe.Pointer(&n)), 0, 0)
+		if errno != 0 {
+			return nil, errno
+		}
+
+		n += n / 8
+		b := make([]byte, n+1)
+
+		_, _, errno = syscall.Syscall6(syscall.SYS___SYSCTL,
+			uintptr(unsafe.Pointer(&mib[0])), uintptr(len(mib)),
+			uintptr(unsafe.Pointer(&b[0])), uintptr(unsafe.Pointer(&n)),
+			0, 0)
+		if errno == syscall.ENOMEM {
+			continue
+		} else if errno != 0 {
+			return nil, errno
+		}
+
+		return b[:n], nil
+	}
+}
@@ -0,0 +1,75 @@
+// Released under an MIT-style license. See LICENSE.
+
+package task
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+)
+
+/* Return the processes running on the system, as read from /proc. */
+func Processes() ([]ProcessInfo, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+
+	l := []ProcessInfo{}
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+
+		/* A process can end while the list is being read. */
+		p, err := procStat(pid)
+		if err != nil {
+			continue
+		}
+
+		l = append(l, p)
+	}
+
+	return l, nil
+}
+
+/* Return the process pid, as described by /proc/pid/stat and cmdline. */
+func procStat(pid int) (ProcessInfo, error) {
+	dir := "/proc/" + strconv.Itoa(pid)
+
+	b, err := os.ReadFile(dir + "/stat")
+	if err != nil {
+		return ProcessInfo{}, err
+	}
+
+	/* The name is in parentheses, and can contain them. */
+	s := string(b)
+	start, end := strings.IndexByte(s, '('), strings.LastIndexByte(s, ')')
+	if start < 0 || end < start {
+		return ProcessInfo{}, errors.New(dir + "/stat: invalid")
+	}
+
+	/* The fields after the name start with state, ppid, ... rss (22nd). */
+	fields := strings.Fields(s[end+1:])
+	if len(fields) < 22 {
+		return ProcessInfo{}, errors.New(dir + "/stat: invalid")
+	}
+
+	p := ProcessInfo{Pid: pid, Name: s[start+1 : end], Zombie: fields[0] == "Z"}
+
+	p.Ppid, _ = strconv.Atoi(fields[1])
+
+	pages, _ := strconv.ParseUint(fields[21], 10, 64)
+	p.RSS = pages * uint64(os.Getpagesize())
+
+	p.Command = p.Name
+	if b, err = os.ReadFile(dir + "/cmdline"); err == nil && len(b) > 0 {
+		b = bytes.TrimRight(b, "\x00")
+		p.Command = string(bytes.ReplaceAll(b, []byte{0}, []byte{' '}))
+	}
+
+	return p, nil
+}
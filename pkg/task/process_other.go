@@ -0,0 +1,14 @@
+// Released under an MIT-style license. See LICENSE.
+
+// +build !linux
+// +build !darwin !amd64,!arm64
+
+package task
+
+import (
+	"errors"
+)
+
+func Processes() ([]ProcessInfo, error) {
+	return nil, errors.New("Not implemented")
+}
@@ -0,0 +1,55 @@
+// Released under an MIT-style license. See LICENSE.
+
+package task
+
+import (
+	. "github.com/michaelmacinnis/oh/pkg/cell"
+	"github.com/rivo/uniseg"
+)
+
+/*
+ * When oh is interactive, its prompt is the value of $PROMPT, if it is
+ * set, and the value of $RPROMPT, if it is set, is drawn at the right
+ * edge of the terminal. Either can be a method, which is called, without
+ * arguments, before each prompt. The right-hand prompt is transient: it
+ * disappears as soon as the line is edited, so it is never left beside a
+ * command or its output. Prompts can use $?, the status of the last
+ * command, $last-duration, the time that it took in seconds, and
+ * $job-count, the number of stopped jobs.
+ */
+
+/* Return the width of s on a terminal, ignoring escape sequences. */
+func DisplayWidth(s string) int {
+	return uniseg.StringWidth(escapes.ReplaceAllString(s, ""))
+}
+
+/*
+ * Return the primary prompt, or primary if $PROMPT is not set, and the
+ * right-hand prompt, if any.
+ */
+func Prompts(primary string) (string, string) {
+	env0.Add(NewSymbol("$job-count"), NewInteger(int64(len(jobs))))
+
+	return prompt("$PROMPT", primary), prompt("$RPROMPT", "")
+}
+
+/* Return the text of the prompt held by the variable name, or otherwise. */
+func prompt(name, otherwise string) (s string) {
+	defer func() {
+		if recover() != nil {
+			s = otherwise
+		}
+	}()
+
+	r := Resolve(task0.Lexical, task0.Dynamic, NewSymbol(name))
+	if r == nil {
+		return otherwise
+	}
+
+	v := r.Get()
+	if b, ok := v.(Binding); ok {
+		v = task0.Caller()(b)
+	}
+
+	return raw(v)
+}
@@ -0,0 +1,108 @@
+// Released under an MIT-style license. See LICENSE.
+
+package task
+
+import (
+	. "github.com/michaelmacinnis/oh/pkg/cell"
+	"strings"
+)
+
+/*
+ * A record holds a fixed set of named fields. The command,
+ *
+ *     define-record point (x y)
+ *
+ * defines a constructor, point, that takes a value for each field, the
+ * predicate is-point, and an accessor for each field, point-x and point-y.
+ * A record's fields are stored in a slice, rather than an environment, so
+ * records are cheaper to create than objects. Records cannot be changed.
+ */
+
+/* The name and fields shared by records defined by define-record. */
+type recordType struct {
+	fields []string
+	name   string
+}
+
+/* Record cell definition. */
+
+type Record struct {
+	kind   *recordType
+	values []Cell
+}
+
+func IsRecord(c Cell) bool {
+	switch c.(type) {
+	case *Record:
+		return true
+	}
+	return false
+}
+
+func NewRecord(kind *recordType, values []Cell) *Record {
+	return &Record{kind, values}
+}
+
+func (r *Record) Bool() bool {
+	return true
+}
+
+func (r *Record) Equal(c Cell) bool {
+	o, ok := c.(*Record)
+	if !ok || r.kind != o.kind {
+		return false
+	}
+
+	for i, v := range r.values {
+		if !v.Equal(o.values[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (r *Record) String() string {
+	s := make([]string, len(r.values)+1)
+	s[0] = r.kind.name
+	for i, v := range r.values {
+		s[i+1] = v.String()
+	}
+
+	return "%" + strings.Join(s, " ") + "%"
+}
+
+/* Define the constructor, predicate and accessors for a record type. */
+func defineRecord(s Context, name string, fields Cell) {
+	kind := &recordType{name: name}
+	for ; fields != Null; fields = Cdr(fields) {
+		kind.fields = append(kind.fields, raw(Car(fields)))
+	}
+
+	s.DefineMethod(name, func(t *Task, args Cell) bool {
+		values := elements(args)
+		if len(values) != len(kind.fields) {
+			panic("error/runtime: " + name + " expects " +
+				strings.Join(kind.fields, ", "))
+		}
+
+		return t.Return(NewRecord(kind, values))
+	})
+	s.DefineMethod("is-"+name, func(t *Task, args Cell) bool {
+		r, ok := Car(args).(*Record)
+
+		return t.Return(NewBoolean(ok && r.kind == kind))
+	})
+
+	for i, field := range kind.fields {
+		i := i
+		s.DefineMethod(name+"-"+field, func(t *Task, args Cell) bool {
+			r, ok := Car(args).(*Record)
+			if !ok || r.kind != kind {
+				panic("error/runtime: not a " + name)
+			}
+
+			return t.Return(r.values[i])
+		})
+	}
+}
@@ -0,0 +1,72 @@
+// Released under an MIT-style license. See LICENSE.
+
+package task
+
+import (
+	. "github.com/michaelmacinnis/oh/pkg/cell"
+	"sort"
+	"sync/atomic"
+)
+
+/*
+ * The restrict command removes capabilities from the running shell, so
+ * that a script can drop those it no longer needs once it has finished
+ * setting up:
+ *
+ *     exec   external commands cannot be run
+ *     net    network connections cannot be made
+ *     write  files cannot be created or opened for writing
+ *
+ * A capability, once removed, cannot be restored, and is removed for every
+ * task. Restrictions are enforced by oh's builtins, not the operating
+ * system, and external commands that are already running are unaffected.
+ * Capabilities are named as they are, without being evaluated. Without
+ * arguments, restrict returns the capabilities removed so far.
+ */
+
+var restrictions = map[string]*int32{
+	"exec":  new(int32),
+	"net":   new(int32),
+	"write": new(int32),
+}
+
+/* Return true if the capability has not been removed. */
+func allowed(capability string) bool {
+	return atomic.LoadInt32(restrictions[capability]) == 0
+}
+
+/* Panic if the capability has been removed. */
+func demand(capability string) {
+	if !allowed(capability) {
+		panic("error/runtime: restricted: " + capability)
+	}
+}
+
+/* Remove the capabilities args and return those that have been removed. */
+func restrict(args Cell) Cell {
+	for ; args != Null; args = Cdr(args) {
+		name := raw(Car(args))
+
+		p, ok := restrictions[name]
+		if !ok {
+			panic("error/runtime: unknown capability: " + name)
+		}
+
+		atomic.StoreInt32(p, 1)
+	}
+
+	removed := []string{}
+	for name := range restrictions {
+		if !allowed(name) {
+			removed = append(removed, name)
+		}
+	}
+	sort.Strings(removed)
+
+	l := Null
+	for i := len(removed) - 1; i >= 0; i-- {
+		l = Cons(NewSymbol(removed[i]), l)
+	}
+
+	return l
+}
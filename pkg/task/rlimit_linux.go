@@ -0,0 +1,37 @@
+// Released under an MIT-style license. See LICENSE.
+
+package task
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+var rlimits = map[string]int{
+	"as":     syscall.RLIMIT_AS,
+	"core":   syscall.RLIMIT_CORE,
+	"cpu":    syscall.RLIMIT_CPU,
+	"data":   syscall.RLIMIT_DATA,
+	"fsize":  syscall.RLIMIT_FSIZE,
+	"nofile": syscall.RLIMIT_NOFILE,
+	"stack":  syscall.RLIMIT_STACK,
+}
+
+func IsRlimit(resource string) bool {
+	_, ok := rlimits[resource]
+	return ok
+}
+
+/* Set both the soft and hard limit for resource of the process pid. */
+func SetRlimit(pid int, resource string, value uint64) error {
+	l := syscall.Rlimit{Cur: value, Max: value}
+
+	_, _, errno := syscall.RawSyscall6(syscall.SYS_PRLIMIT64,
+		uintptr(pid), uintptr(rlimits[resource]),
+		uintptr(unsafe.Pointer(&l)), 0, 0, 0)
+	if errno != 0 {
+		return errno
+	}
+
+	return nil
+}
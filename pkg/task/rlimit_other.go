@@ -0,0 +1,17 @@
+// Released under an MIT-style license. See LICENSE.
+
+// +build !linux
+
+package task
+
+import (
+	"errors"
+)
+
+func IsRlimit(resource string) bool {
+	return false
+}
+
+func SetRlimit(pid int, resource string, value uint64) error {
+	return errors.New("Not implemented")
+}
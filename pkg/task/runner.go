@@ -0,0 +1,129 @@
+// Released under an MIT-style license. See LICENSE.
+
+package task
+
+import (
+	"github.com/michaelmacinnis/adapted"
+	. "github.com/michaelmacinnis/oh/pkg/cell"
+	"os"
+	"strings"
+	"syscall"
+)
+
+/*
+ * External commands are found, started, waited for and signalled by a
+ * Runner. By default commands are run on the local machine, but a program
+ * that embeds oh can call SetRunner, before Start, to run them some other
+ * way: in a container, on another machine, or by recording and replaying
+ * them. Job control applies only to local processes.
+ *
+ * Within with-host, which sets $remote, commands are instead run on the
+ * remote host with ssh. Only external commands are run remotely. Builtins
+ * and methods are still evaluated locally.
+ */
+
+/* A Process is an external command started by a Runner. */
+type Process interface {
+	Pid() int
+}
+
+/* A Runner runs external commands. */
+type Runner interface {
+	LookPath(name string) (string, error)
+	Signal(p Process, sig os.Signal) error
+	Start(path string, argv []string, attr *os.ProcAttr) (Process, error)
+	Wait(p Process) (int, error)
+}
+
+var defaultRunner Runner = local{}
+
+/* SetRunner sets the runner used for external commands. */
+func SetRunner(r Runner) {
+	defaultRunner = r
+}
+
+/* Return the runner for external commands run by t. */
+func (t *Task) runner() Runner {
+	if r := t.Dynamic.Access(NewSymbol("$remote")); r != nil {
+		if host := raw(r.Get()); host != "" {
+			return remote{host}
+		}
+	}
+
+	return defaultRunner
+}
+
+/* The local runner runs commands as child processes of oh. */
+type local struct{}
+
+type localProcess struct {
+	p *os.Process
+}
+
+func (l local) LookPath(name string) (string, error) {
+	return lookPath(name)
+}
+
+/* A SIGTERM is sent as the platform's way of terminating a process. */
+func (l local) Signal(p Process, sig os.Signal) error {
+	if sig == syscall.SIGTERM {
+		TerminateProcess(p.Pid())
+		return nil
+	}
+
+	return p.(*localProcess).p.Signal(sig)
+}
+
+func (l local) Start(path string, argv []string, attr *os.ProcAttr) (Process, error) {
+	p, err := os.StartProcess(path, argv, attr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &localProcess{p}, nil
+}
+
+func (l local) Wait(p Process) (int, error) {
+	return JoinProcess(p.(*localProcess).p), nil
+}
+
+func (lp *localProcess) Pid() int {
+	return lp.p.Pid
+}
+
+/*
+ * The remote runner runs commands on host by running them with ssh. The
+ * remote host's shell finds each command and a command's status is the
+ * status with which ssh exits.
+ */
+type remote struct {
+	host string
+}
+
+func (r remote) LookPath(name string) (string, error) {
+	return name, nil
+}
+
+func (r remote) Signal(p Process, sig os.Signal) error {
+	return local{}.Signal(p, sig)
+}
+
+func (r remote) Start(path string, argv []string, attr *os.ProcAttr) (Process, error) {
+	ssh, err := adapted.LookPath("ssh")
+	if err != nil {
+		return nil, err
+	}
+
+	words := make([]string, len(argv))
+	for i, s := range argv {
+		words[i] = "'" + strings.Replace(s, "'", "'\\''", -1) + "'"
+	}
+	words[0] = "exec " + words[0]
+
+	cmd := strings.Join(words, " ")
+	return local{}.Start(ssh, []string{"ssh", "--", r.host, cmd}, attr)
+}
+
+func (r remote) Wait(p Process) (int, error) {
+	return local{}.Wait(p)
+}
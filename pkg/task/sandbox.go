@@ -0,0 +1,120 @@
+// Released under an MIT-style license. See LICENSE.
+
+package task
+
+import (
+	. "github.com/michaelmacinnis/oh/pkg/cell"
+	"os"
+	"os/user"
+	"strconv"
+)
+
+/*
+ * The dynamic variable $sandbox holds an object whose public members
+ * confine the external commands that oh starts:
+ *
+ *     chroot      if not false, the directory, relative to $cwd, that
+ *                 becomes the command's root directory
+ *     group       if not false, the group, by name or ID, to run as
+ *     namespaces  the new namespaces, from ipc, mount, net, pid and uts,
+ *                 in which to run the command (Linux only)
+ *     user        if not false, the user, by name or ID, to run as
+ *
+ * A user without a group runs with their primary group, if they have one
+ * (a user given by an unknown ID does not). Changing user or group also
+ * drops supplementary groups. A command is found, as always, before it is
+ * started, so within a new root it must be at the same path. It starts in
+ * the new root directory.
+ *
+ * As with $options, the with method returns a child of the sandbox object
+ * with the given settings changed. Commands run with with-host are not
+ * confined.
+ */
+
+var confinement = map[string]Cell{
+	"chroot":     False,
+	"group":      False,
+	"namespaces": Null,
+	"user":       False,
+}
+
+/* Return the default sandbox object. */
+func sandbox() *Object {
+	s := NewScope(scope0, nil)
+	for k, v := range confinement {
+		s.Public(NewSymbol(k), v)
+	}
+
+	s.PublicMethod("with", with("sandbox setting", confinement))
+
+	return NewObject(s)
+}
+
+/* Confine the command to be started with attr as $sandbox specifies. */
+func (t *Task) confine(attr *os.ProcAttr) error {
+	root := ""
+	if c := t.member("$sandbox", "chroot", confinement); c != False {
+		root = resolvePath(t, raw(c))
+		attr.Dir = "/"
+	}
+
+	uid, gid := -1, -1
+	if c := t.member("$sandbox", "user", confinement); c != False {
+		var err error
+		if uid, gid, err = lookupUser(raw(c)); err != nil {
+			return err
+		}
+	}
+
+	if c := t.member("$sandbox", "group", confinement); c != False {
+		var err error
+		if gid, err = lookupGroup(raw(c)); err != nil {
+			return err
+		}
+	}
+
+	namespaces := []string{}
+	for _, c := range elements(t.member("$sandbox", "namespaces", confinement)) {
+		namespaces = append(namespaces, raw(c))
+	}
+
+	if root == "" && uid < 0 && gid < 0 && len(namespaces) == 0 {
+		return nil
+	}
+
+	return Confine(attr, root, uid, gid, namespaces)
+}
+
+/* Return the ID of the group name, which may already be an ID. */
+func lookupGroup(name string) (int, error) {
+	if id, err := strconv.Atoi(name); err == nil {
+		return id, nil
+	}
+
+	g, err := user.LookupGroup(name)
+	if err != nil {
+		return -1, err
+	}
+
+	return strconv.Atoi(g.Gid)
+}
+
+/*
+ * Return the user ID, and primary group ID, if known, of the user name,
+ * which may already be an ID.
+ */
+func lookupUser(name string) (uid, gid int, err error) {
+	var u *user.User
+	if uid, err = strconv.Atoi(name); err == nil {
+		if u, err = user.LookupId(name); err != nil {
+			return uid, -1, nil
+		}
+	} else if u, err = user.Lookup(name); err != nil {
+		return -1, -1, err
+	}
+
+	uid, _ = strconv.Atoi(u.Uid)
+	gid, _ = strconv.Atoi(u.Gid)
+
+	return uid, gid, nil
+}
@@ -0,0 +1,200 @@
+// Released under an MIT-style license. See LICENSE.
+
+package task
+
+import (
+	"fmt"
+	. "github.com/michaelmacinnis/oh/pkg/cell"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+)
+
+/*
+ * A secret holds text, like a password or token, that should not be seen.
+ * It is written, by write, pp and when tracing, as <redacted>, and cannot
+ * be serialized. The reveal method returns its text as a string, so that
+ * it is only used, by an external command or otherwise, where a script
+ * asks for it explicitly. The secret command makes a secret from text.
+ *
+ * The read-secret command writes a prompt to the terminal and reads a
+ * line, a password or token, without echoing it, and returns it as a
+ * secret. The line is not kept in the shell's history. If $stdin is not a
+ * terminal, read-secret reads the line from $stdin, without a prompt.
+ *
+ * While the line is read, the terminal's mode is kept as the job's mode,
+ * so that if the job is stopped, and continued, echoing is turned off
+ * again. When the line has been read, or reading is interrupted, the
+ * terminal is restored, even if the interrupt ends the shell.
+ */
+
+var (
+	envx     *Env
+	envxOnce sync.Once
+)
+
+/*
+ * Return the env of methods shared by secrets, created on first use. A
+ * secret can be made by any task, so it is created only once.
+ */
+func secretEnv() *Env {
+	envxOnce.Do(func() {
+		envx = NewEnv(nil)
+		envx.Method("child", func(t *Task, args Cell) bool {
+			panic("secrets cannot be parents")
+		})
+		envx.Method("clone", func(t *Task, args Cell) bool {
+			panic("secrets cannot be cloned")
+		})
+		envx.Method("define", func(t *Task, args Cell) bool {
+			panic("private members cannot be added to a secret")
+		})
+		envx.Method("reveal", func(t *Task, args Cell) bool {
+			return t.Return(NewString(t, toSecret(t.Self()).v))
+		})
+	})
+
+	return envx
+}
+
+/* Secret cell definition. */
+
+type Secret struct {
+	*Scope
+	v string
+}
+
+func IsSecret(c Cell) bool {
+	switch c.(type) {
+	case *Secret:
+		return true
+	}
+	return false
+}
+
+func NewSecret(t *Task, v string) *Secret {
+	return &Secret{NewScope(t.Lexical.Expose(), secretEnv()), v}
+}
+
+func (s *Secret) Bool() bool {
+	return true
+}
+
+func (s *Secret) Equal(c Cell) bool {
+	return s == c
+}
+
+func (s *Secret) Expose() Context {
+	return s
+}
+
+func (s *Secret) String() string {
+	return "<redacted>"
+}
+
+/* Secret-specific functions. */
+
+/* A terminalSetting applies a terminal mode by calling itself. */
+type terminalSetting func() error
+
+func (f terminalSetting) ApplyMode() error {
+	return f()
+}
+
+/*
+ * Return the file descriptor of f. Unlike f.Fd, this leaves f
+ * non-blocking, so that reads from it can still time out.
+ */
+func descriptor(f *os.File) uintptr {
+	fd := ^uintptr(0)
+	if c, err := f.SyscallConn(); err == nil {
+		c.Control(func(d uintptr) {
+			fd = d
+		})
+	}
+
+	return fd
+}
+
+/* Return the line read, without echoing it, after writing prompt. */
+func readSecret(t *Task, prompt string) Cell {
+	in := t.dynamic("$stdin", nil)
+	p, ok := asConduit(in.(Context)).(*Pipe)
+	if !ok || p.ReadFd() == nil || !IsTerminal(p.ReadFd().Fd()) {
+		line := asConduit(in.(Context)).ReadLine(t)
+		if s, ok := line.(*String); ok {
+			return NewSecret(t, raw(s))
+		}
+
+		return line
+	}
+
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return NewError(t, err)
+	}
+	defer tty.Close()
+
+	fmt.Fprint(tty, prompt)
+
+	fd := descriptor(tty)
+
+	restore, err := QuietTerminal(fd)
+	if err != nil {
+		return NewError(t, err)
+	}
+	defer restore()
+
+	/*
+	 * Without job control, an interrupt ends the shell, so the terminal
+	 * is restored before it is passed on.
+	 */
+	if !interactive {
+		interrupts := make(chan os.Signal, 1)
+		signal.Notify(interrupts, os.Interrupt)
+
+		done := make(chan bool)
+		defer close(done)
+
+		go func() {
+			select {
+			case <-interrupts:
+				restore()
+				signal.Stop(interrupts)
+
+				if p, err := os.FindProcess(os.Getpid()); err == nil {
+					p.Signal(os.Interrupt)
+				}
+			case <-done:
+				signal.Stop(interrupts)
+			}
+		}()
+	}
+
+	saved := t.Job.mode
+	t.Job.mode = terminalSetting(func() error {
+		_, err := QuietTerminal(fd)
+		return err
+	})
+	defer func() {
+		t.Job.mode = saved
+	}()
+
+	line, err := readTerminalLine(t, tty, time.Time{})
+	fmt.Fprintln(tty)
+
+	if err != nil {
+		return NewError(t, err)
+	}
+
+	return NewSecret(t, line)
+}
+
+func toSecret(o Context) *Secret {
+	if s, ok := o.(*Secret); ok {
+		return s
+	}
+
+	panic("not a secret")
+}
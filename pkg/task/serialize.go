@@ -0,0 +1,370 @@
+// Released under an MIT-style license. See LICENSE.
+
+package task
+
+import (
+	. "github.com/michaelmacinnis/oh/pkg/cell"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+/*
+ * Cells are serialized to a textual form that can be read back with
+ * unserialize. Lists are written in parentheses, strings are double
+ * quoted and objects are written as #object((name value) ...) with their
+ * public members. Numbers and other words are written as they are and,
+ * as with the parser, read back as symbols. Symbols that contain
+ * whitespace, parentheses or double quotes are written #"name". A list
+ * or object that is reachable more than once is labeled #n= where it
+ * first appears and written #n# thereafter, so shared structure and
+ * cycles survive the round trip.
+ */
+
+type serializer struct {
+	b      strings.Builder
+	count  map[Cell]int
+	labels map[Cell]int
+}
+
+func serialize(c Cell) string {
+	s := &serializer{count: map[Cell]int{}, labels: map[Cell]int{}}
+
+	s.visit(c)
+	s.write(c)
+
+	return s.b.String()
+}
+
+/* Count the references to each list and object reachable from c. */
+func (s *serializer) visit(c Cell) {
+	for IsCons(c) && c != Null {
+		if s.count[c]++; s.count[c] > 1 {
+			return
+		}
+		s.visit(Car(c))
+		c = Cdr(c)
+	}
+
+	if o, ok := c.(*Object); ok {
+		if s.count[c]++; s.count[c] > 1 {
+			return
+		}
+		for _, m := range members(o) {
+			s.visit(Cdr(m))
+		}
+	}
+}
+
+/* Write a reference to c if it has a label or, if shared, label it. */
+func (s *serializer) label(c Cell) bool {
+	if n, ok := s.labels[c]; ok {
+		s.b.WriteString("#" + strconv.Itoa(n) + "#")
+		return true
+	}
+
+	if s.count[c] > 1 {
+		n := len(s.labels) + 1
+		s.labels[c] = n
+		s.b.WriteString("#" + strconv.Itoa(n) + "=")
+	}
+
+	return false
+}
+
+func (s *serializer) write(c Cell) {
+	switch v := c.(type) {
+	case *Boolean, *Float, *Integer, Rational, *Status:
+		s.b.WriteString(v.String())
+
+	case *Object:
+		if s.label(c) {
+			return
+		}
+
+		s.b.WriteString("#object(")
+		for i, m := range members(v) {
+			if i > 0 {
+				s.b.WriteString(" ")
+			}
+			s.write(List(Car(m), Cdr(m)))
+		}
+		s.b.WriteString(")")
+
+	case *String:
+		s.b.WriteString(strconv.Quote(v.Raw()))
+
+	case *Symbol:
+		name := v.String()
+		if plain(name) {
+			s.b.WriteString(name)
+		} else {
+			s.b.WriteString("#" + strconv.Quote(name))
+		}
+
+	default:
+		if !IsCons(c) {
+			panic("error/runtime: cannot serialize " + c.String())
+		}
+
+		if c == Null {
+			s.b.WriteString("()")
+			return
+		}
+
+		if s.label(c) {
+			return
+		}
+
+		s.b.WriteString("(")
+		for {
+			s.write(Car(c))
+
+			c = Cdr(c)
+			if c == Null {
+				break
+			}
+
+			_, shared := s.labels[c]
+			if !IsCons(c) || shared || s.count[c] > 1 {
+				s.b.WriteString(" . ")
+				s.write(c)
+				break
+			}
+
+			s.b.WriteString(" ")
+		}
+		s.b.WriteString(")")
+	}
+}
+
+/* Return the public members of o as (name . value) pairs. */
+func members(o *Object) []Cell {
+	public := o.Expose().Faces().Prev()
+
+	l := []Cell{}
+	for _, name := range public.Names() {
+		k := NewSymbol(name)
+		l = append(l, Cons(k, public.Access(k).Get()))
+	}
+
+	return l
+}
+
+/* Can name be written without quoting? */
+func plain(name string) bool {
+	if name == "" || name[0] == '#' || name == "." {
+		return false
+	}
+
+	return strings.IndexFunc(name, delimiter) == -1
+}
+
+func delimiter(r rune) bool {
+	return unicode.IsSpace(r) || strings.ContainsRune(`()"`, r)
+}
+
+/* Convert an unquoted word to a boolean or, like the parser, a symbol. */
+func atom(s string) Cell {
+	switch s {
+	case "true":
+		return True
+	case "false":
+		return False
+	}
+
+	return NewSymbol(s)
+}
+
+type unserializer struct {
+	in     []rune
+	labels map[int]Cell
+	pos    int
+	t      *Task
+}
+
+func unserialize(t *Task, s string) Cell {
+	u := &unserializer{in: []rune(s), labels: map[int]Cell{}, t: t}
+
+	c := u.read()
+
+	if u.skip(); u.pos < len(u.in) {
+		u.fail("unexpected " + string(u.in[u.pos:]))
+	}
+
+	return c
+}
+
+func (u *unserializer) fail(msg string) {
+	panic("error/runtime: read-from-string: " + msg)
+}
+
+func (u *unserializer) peek() rune {
+	if u.skip(); u.pos >= len(u.in) {
+		u.fail("unexpected end of input")
+	}
+
+	return u.in[u.pos]
+}
+
+func (u *unserializer) read() Cell {
+	switch r := u.peek(); r {
+	case '(':
+		u.pos++
+		return u.list(Cons(Null, Null))
+
+	case ')':
+		u.fail("unexpected )")
+
+	case '"':
+		return NewString(u.t, u.quoted())
+
+	case '#':
+		u.pos++
+		return u.hash()
+	}
+
+	return atom(u.word())
+}
+
+/* Read a label, a reference to a label, a quoted symbol or an object. */
+func (u *unserializer) hash() Cell {
+	if u.pos < len(u.in) && u.in[u.pos] == '"' {
+		return NewSymbol(u.quoted())
+	}
+
+	if strings.HasPrefix(string(u.in[u.pos:]), "object(") {
+		u.pos += len("object(")
+		return u.object(NewObject(NewScope(scope0, nil)))
+	}
+
+	start := u.pos
+	for u.pos < len(u.in) && unicode.IsDigit(u.in[u.pos]) {
+		u.pos++
+	}
+
+	n, err := strconv.Atoi(string(u.in[start:u.pos]))
+	if err != nil || u.pos >= len(u.in) {
+		u.fail("bad label")
+	}
+
+	u.pos++
+	switch u.in[u.pos-1] {
+	case '#':
+		c, ok := u.labels[n]
+		if !ok {
+			u.fail("undefined label #" + strconv.Itoa(n) + "#")
+		}
+		return c
+
+	case '=':
+		/* Lists and objects are registered before their contents. */
+		switch {
+		case u.peek() == '(':
+			u.pos++
+			c := Cons(Null, Null)
+			u.labels[n] = c
+			return u.list(c)
+
+		case strings.HasPrefix(string(u.in[u.pos:]), "#object("):
+			u.pos += len("#object(")
+			o := NewObject(NewScope(scope0, nil))
+			u.labels[n] = o
+			return u.object(o)
+		}
+
+		c := u.read()
+		u.labels[n] = c
+		return c
+	}
+
+	u.fail("bad label")
+
+	return nil
+}
+
+/* Read the elements of a list into head, which is its first pair. */
+func (u *unserializer) list(head Cell) Cell {
+	if u.peek() == ')' {
+		u.pos++
+		return Null
+	}
+
+	p := head
+	SetCar(p, u.read())
+
+	for {
+		switch u.peek() {
+		case ')':
+			u.pos++
+			return head
+
+		case '.':
+			if u.pos+1 < len(u.in) && delimiter(u.in[u.pos+1]) {
+				u.pos++
+				SetCdr(p, u.read())
+				if u.peek() != ')' {
+					u.fail("expected )")
+				}
+				u.pos++
+				return head
+			}
+		}
+
+		SetCdr(p, Cons(u.read(), Null))
+		p = Cdr(p)
+	}
+}
+
+func (u *unserializer) object(o *Object) Cell {
+	for u.peek() != ')' {
+		m := u.read()
+		if !IsCons(m) || m == Null {
+			u.fail("expected (name value)")
+		}
+		o.Public(Car(m), Cadr(m))
+	}
+	u.pos++
+
+	return o
+}
+
+func (u *unserializer) quoted() string {
+	start := u.pos
+	for u.pos++; u.pos < len(u.in) && u.in[u.pos] != '"'; u.pos++ {
+		if u.in[u.pos] == '\\' {
+			u.pos++
+		}
+	}
+	u.pos++
+
+	if u.pos > len(u.in) {
+		u.fail("unterminated string")
+	}
+
+	s, err := strconv.Unquote(string(u.in[start:u.pos]))
+	if err != nil {
+		u.fail(err.Error())
+	}
+
+	return s
+}
+
+func (u *unserializer) skip() {
+	for u.pos < len(u.in) && unicode.IsSpace(u.in[u.pos]) {
+		u.pos++
+	}
+}
+
+func (u *unserializer) word() string {
+	start := u.pos
+	for u.pos < len(u.in) && !delimiter(u.in[u.pos]) {
+		u.pos++
+	}
+
+	if start == u.pos {
+		u.fail("unexpected " + string(u.in[u.pos]))
+	}
+
+	return string(u.in[start:u.pos])
+}
@@ -0,0 +1,40 @@
+// Released under an MIT-style license. See LICENSE.
+
+package task
+
+import (
+	. "github.com/michaelmacinnis/oh/pkg/cell"
+	"strings"
+)
+
+/*
+ * The $signals object maps the name of each signal, like HUP or TERM, to
+ * its number, on the platform on which oh is running, as numbers differ
+ * between platforms. Where a signal is expected, as it is by kill, it can
+ * be given as a number or a name, in upper or lower case, with or without
+ * the SIG prefix, so that 9, KILL, kill and SIGKILL are the same signal.
+ */
+
+/* Return the $signals object. */
+func signals() *Object {
+	s := NewScope(scope0, nil)
+	for k, v := range signalNumbers {
+		s.Public(NewSymbol(k), NewInteger(int64(v)))
+	}
+
+	return NewObject(s)
+}
+
+/* Return the number of the signal c, a number or a name. */
+func signalNumber(c Cell) int {
+	if a, ok := c.(Atom); ok && kind(a) != "text" {
+		return int(a.Int())
+	}
+
+	name := strings.TrimPrefix(strings.ToUpper(raw(c)), "SIG")
+	if n, ok := signalNumbers[name]; ok {
+		return n
+	}
+
+	panic("error/runtime: unknown signal: " + raw(c))
+}
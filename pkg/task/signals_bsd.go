@@ -0,0 +1,15 @@
+// Released under an MIT-style license. See LICENSE.
+
+// +build darwin dragonfly freebsd netbsd openbsd
+
+package task
+
+import (
+	"syscall"
+)
+
+/* The signals BSD and macOS have, but Linux does not, by name. */
+var extraSignals = map[string]int{
+	"EMT":  int(syscall.SIGEMT),
+	"INFO": int(syscall.SIGINFO),
+}
@@ -0,0 +1,13 @@
+// Released under an MIT-style license. See LICENSE.
+
+package task
+
+import (
+	"syscall"
+)
+
+/* The signals only Linux has, by name. */
+var extraSignals = map[string]int{
+	"PWR":    int(syscall.SIGPWR),
+	"STKFLT": int(syscall.SIGSTKFLT),
+}
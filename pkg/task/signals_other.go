@@ -0,0 +1,7 @@
+// Released under an MIT-style license. See LICENSE.
+
+// +build !linux,!darwin,!dragonfly,!freebsd,!netbsd,!openbsd,!windows
+
+package task
+
+var signalNumbers = map[string]int{}
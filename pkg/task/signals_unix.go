@@ -0,0 +1,49 @@
+// Released under an MIT-style license. See LICENSE.
+
+// +build linux darwin dragonfly freebsd netbsd openbsd
+
+package task
+
+import (
+	"syscall"
+)
+
+/* The signals Unix-like systems have in common, and their own, by name. */
+var signalNumbers = func() map[string]int {
+	m := map[string]int{
+		"ABRT":   int(syscall.SIGABRT),
+		"ALRM":   int(syscall.SIGALRM),
+		"BUS":    int(syscall.SIGBUS),
+		"CHLD":   int(syscall.SIGCHLD),
+		"CONT":   int(syscall.SIGCONT),
+		"FPE":    int(syscall.SIGFPE),
+		"HUP":    int(syscall.SIGHUP),
+		"ILL":    int(syscall.SIGILL),
+		"INT":    int(syscall.SIGINT),
+		"IO":     int(syscall.SIGIO),
+		"KILL":   int(syscall.SIGKILL),
+		"PIPE":   int(syscall.SIGPIPE),
+		"PROF":   int(syscall.SIGPROF),
+		"QUIT":   int(syscall.SIGQUIT),
+		"SEGV":   int(syscall.SIGSEGV),
+		"STOP":   int(syscall.SIGSTOP),
+		"SYS":    int(syscall.SIGSYS),
+		"TERM":   int(syscall.SIGTERM),
+		"TRAP":   int(syscall.SIGTRAP),
+		"TSTP":   int(syscall.SIGTSTP),
+		"TTIN":   int(syscall.SIGTTIN),
+		"TTOU":   int(syscall.SIGTTOU),
+		"URG":    int(syscall.SIGURG),
+		"USR1":   int(syscall.SIGUSR1),
+		"USR2":   int(syscall.SIGUSR2),
+		"VTALRM": int(syscall.SIGVTALRM),
+		"WINCH":  int(syscall.SIGWINCH),
+		"XCPU":   int(syscall.SIGXCPU),
+		"XFSZ":   int(syscall.SIGXFSZ),
+	}
+	for k, v := range extraSignals {
+		m[k] = v
+	}
+
+	return m
+}()
@@ -0,0 +1,24 @@
+// Released under an MIT-style license. See LICENSE.
+
+package task
+
+import (
+	"syscall"
+)
+
+/* The signals Go defines on Windows, by name. Only KILL and TERM can be sent. */
+var signalNumbers = map[string]int{
+	"ABRT": int(syscall.SIGABRT),
+	"ALRM": int(syscall.SIGALRM),
+	"BUS":  int(syscall.SIGBUS),
+	"FPE":  int(syscall.SIGFPE),
+	"HUP":  int(syscall.SIGHUP),
+	"ILL":  int(syscall.SIGILL),
+	"INT":  int(syscall.SIGINT),
+	"KILL": int(syscall.SIGKILL),
+	"PIPE": int(syscall.SIGPIPE),
+	"QUIT": int(syscall.SIGQUIT),
+	"SEGV": int(syscall.SIGSEGV),
+	"TERM": int(syscall.SIGTERM),
+	"TRAP": int(syscall.SIGTRAP),
+}
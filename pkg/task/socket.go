@@ -0,0 +1,234 @@
+// Released under an MIT-style license. See LICENSE.
+
+package task
+
+import (
+	. "github.com/michaelmacinnis/oh/pkg/cell"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+ * A socket is a conduit that moves whole datagrams. The dial command
+ * returns a socket that exchanges datagrams with a single address, and
+ * the listen command returns a socket, bound to an address, that receives
+ * datagrams from any sender. The network is one of udp, udp4, udp6 or
+ * unixgram.
+ *
+ * Each write sends its arguments, combined as the buffer builtin combines
+ * them, as one datagram. The read method returns the next datagram as a
+ * buffer, and readline returns it as a string, without a trailing newline.
+ * A socket returned by listen writes to the sender of the last datagram
+ * that it read. The address method returns the socket's own address, and
+ * the peer method the address to which it writes. A socket is closed with
+ * close, after which read returns ().
+ */
+
+/* The size of the largest datagram that can be read. */
+const maxDatagram = 65535
+
+var envk *Env
+
+func socketEnv() *Env {
+	if envk != nil {
+		goto created
+	}
+
+	envk = NewEnv(conduitEnv())
+	envk.Method("address", func(t *Task, args Cell) bool {
+		a := toSocket(t.Self()).c.LocalAddr()
+
+		return t.Return(NewSymbol(a.String()))
+	})
+	envk.Method("peer", func(t *Task, args Cell) bool {
+		a := toSocket(t.Self()).remote()
+		if a == nil {
+			return t.Return(False)
+		}
+
+		return t.Return(NewSymbol(a.String()))
+	})
+
+created:
+	return envk
+}
+
+/* Socket cell definition. */
+
+type Socket struct {
+	*Scope
+	sync.Mutex
+	c      net.PacketConn
+	dialed bool
+	peer   net.Addr
+}
+
+func IsSocket(c Cell) bool {
+	context, ok := c.(Context)
+	if !ok {
+		return false
+	}
+
+	switch asConduit(context).(type) {
+	case *Socket:
+		return true
+	}
+	return false
+}
+
+func NewSocket(t *Task, c net.PacketConn, dialed bool) *Socket {
+	return &Socket{Scope: NewScope(t.Lexical.Expose(), socketEnv()),
+		c: c, dialed: dialed}
+}
+
+func (s *Socket) String() string {
+	return identify("socket", s)
+}
+
+func (s *Socket) Equal(c Cell) bool {
+	return s == c
+}
+
+func (s *Socket) Close() {
+	s.c.Close()
+}
+
+func (s *Socket) Expose() Context {
+	return s
+}
+
+func (s *Socket) ReaderClose() {
+	return
+}
+
+func (s *Socket) Read(t *Task) Cell {
+	b, ok := s.receive(t)
+	if !ok {
+		return Null
+	}
+
+	return NewBuffer(t, b)
+}
+
+func (s *Socket) ReadLine(t *Task) Cell {
+	b, ok := s.receive(t)
+	if !ok {
+		return False
+	}
+
+	return NewString(t, strings.TrimSuffix(string(b), "\n"))
+}
+
+func (s *Socket) WriterClose() {
+	return
+}
+
+func (s *Socket) Write(c Cell) {
+	if _, ok := c.(*Pair); !ok && c != Null {
+		c = List(c)
+	}
+
+	var err error
+	if s.dialed {
+		_, err = s.c.(net.Conn).Write(octets(c))
+	} else if a := s.remote(); a != nil {
+		_, err = s.c.WriteTo(octets(c), a)
+	} else {
+		panic("error/runtime: socket has no peer to write to")
+	}
+
+	if err != nil {
+		panic("error/runtime: " + err.Error())
+	}
+}
+
+/* Socket-specific functions. */
+
+/*
+ * Return the next datagram, or false if the socket is closed or t is
+ * interrupted. The read times out regularly so that t can be interrupted.
+ */
+func (s *Socket) receive(t *Task) ([]byte, bool) {
+	b := make([]byte, maxDatagram)
+	for {
+		s.c.SetReadDeadline(time.Now().Add(pollInterval))
+
+		n, a, err := s.c.ReadFrom(b)
+		if err == nil {
+			if !s.dialed {
+				s.Lock()
+				s.peer = a
+				s.Unlock()
+			}
+
+			return b[:n], true
+		}
+
+		if e, ok := err.(net.Error); !ok || !e.Timeout() {
+			return nil, false
+		}
+
+		if atomic.LoadInt32(&t.interrupted) != 0 {
+			return nil, false
+		}
+	}
+}
+
+/* Return the address to which s writes, if it has one. */
+func (s *Socket) remote() net.Addr {
+	if s.dialed {
+		return s.c.(net.Conn).RemoteAddr()
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	return s.peer
+}
+
+/* Return a socket that exchanges datagrams with address. */
+func dial(t *Task, network, address string) (*Socket, error) {
+	datagrams(network)
+
+	c, err := net.Dial(network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewSocket(t, c.(net.PacketConn), true), nil
+}
+
+/* Panic unless network is a datagram network that oh can use. */
+func datagrams(network string) {
+	demand("net")
+
+	switch network {
+	case "udp", "udp4", "udp6", "unixgram":
+		return
+	}
+
+	panic("error/runtime: unsupported network: " + network)
+}
+
+/* Return a socket, bound to address, that receives datagrams. */
+func listen(t *Task, network, address string) (*Socket, error) {
+	datagrams(network)
+
+	c, err := net.ListenPacket(network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewSocket(t, c, false), nil
+}
+
+func toSocket(o Context) *Socket {
+	if s, ok := o.(*Socket); ok {
+		return s
+	}
+
+	panic("not a socket")
+}
@@ -0,0 +1,197 @@
+// Released under an MIT-style license. See LICENSE.
+
+// +build darwin freebsd linux netbsd openbsd windows
+
+package task
+
+import (
+	"context"
+	"database/sql"
+	. "github.com/michaelmacinnis/oh/pkg/cell"
+	_ "modernc.org/sqlite"
+	"sync/atomic"
+	"time"
+)
+
+/*
+ * The sqlite-open command opens, or creates, the SQLite database at a path
+ * and returns an object with the methods:
+ *
+ *     close        close the database
+ *     exec         run a statement, returning the number of rows changed
+ *     query        run a query, returning its rows as objects, with a
+ *                  public member for each column
+ *     query-lists  run a query, returning its rows as lists of values, in
+ *                  the order of the columns
+ *
+ * Each method but close takes the SQL to run, and values for any ?
+ * placeholders in it. Values are converted as they are for MessagePack and
+ * CBOR. A NULL is returned as (), text as a string and a blob as a buffer.
+ * Like open, sqlite-open, exec and the query methods return an error if
+ * they fail. Once the write capability has been removed, databases are
+ * opened read-only, and exec cannot be used. A statement can be
+ * interrupted.
+ */
+
+/* Return the values in args, for placeholders. */
+func bindings(args Cell) []interface{} {
+	l := []interface{}{}
+	for _, c := range elements(args) {
+		l = append(l, jsonValue(c, map[Cell]bool{}))
+	}
+
+	return l
+}
+
+/*
+ * Return a context that is cancelled when t is interrupted, and a function
+ * that must be called once it is no longer needed.
+ */
+func (t *Task) interruptible() (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan bool)
+	go func() {
+		tick := time.NewTicker(pollInterval)
+		defer tick.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-tick.C:
+			}
+
+			if atomic.LoadInt32(&t.interrupted) != 0 {
+				cancel()
+				return
+			}
+		}
+	}()
+
+	return ctx, func() {
+		close(done)
+		cancel()
+	}
+}
+
+/*
+ * Open the SQLite database at path, read-only if the write capability has
+ * been removed. A statement waits for other connections to finish writing.
+ */
+func openDatabase(t *Task, path string) (*sql.DB, error) {
+	dsn := "file:" + resolvePath(t, path) + "?_pragma=busy_timeout(5000)"
+	if !allowed("write") {
+		dsn += "&mode=ro"
+	}
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+/* Return the rows returned by query, each made by row from its columns. */
+func rows(t *Task, db *sql.DB, args Cell, row func([]string, []Cell) Cell) Cell {
+	ctx, stop := t.interruptible()
+	defer stop()
+
+	r, err := db.QueryContext(ctx, raw(Car(args)), bindings(Cdr(args))...)
+	if err != nil {
+		return NewError(t, err)
+	}
+	defer r.Close()
+
+	columns, err := r.Columns()
+	if err != nil {
+		return NewError(t, err)
+	}
+
+	l := []Cell{}
+	for r.Next() {
+		v := make([]interface{}, len(columns))
+		p := make([]interface{}, len(columns))
+		for i := range v {
+			p[i] = &v[i]
+		}
+
+		if err = r.Scan(p...); err != nil {
+			return NewError(t, err)
+		}
+
+		values := make([]Cell, len(columns))
+		for i, c := range v {
+			if tm, ok := c.(time.Time); ok {
+				c = tm.Format(time.RFC3339Nano)
+			}
+			values[i] = jsonCell(t, c)
+		}
+
+		l = append(l, row(columns, values))
+	}
+
+	if err = r.Err(); err != nil {
+		return NewError(t, err)
+	}
+
+	return List(l...)
+}
+
+/* Return an object for the SQLite database at path. */
+func sqliteOpen(t *Task, path string) Cell {
+	db, err := openDatabase(t, path)
+	if err != nil {
+		return NewError(t, err)
+	}
+
+	s := NewScope(scope0, nil)
+	s.PublicMethod("close", func(t *Task, args Cell) bool {
+		if err := db.Close(); err != nil {
+			return t.Return(NewError(t, err))
+		}
+
+		return t.Return(True)
+	})
+	s.PublicMethod("exec", func(t *Task, args Cell) bool {
+		demand("write")
+
+		ctx, stop := t.interruptible()
+		defer stop()
+
+		r, err := db.ExecContext(ctx, raw(Car(args)), bindings(Cdr(args))...)
+		if err != nil {
+			return t.Return(NewError(t, err))
+		}
+
+		n, err := r.RowsAffected()
+		if err != nil {
+			return t.Return(NewError(t, err))
+		}
+
+		return t.Return(NewInteger(n))
+	})
+	s.PublicMethod("query", func(t *Task, args Cell) bool {
+		return t.Return(rows(t, db, args, func(columns []string, values []Cell) Cell {
+			o := NewScope(scope0, nil)
+			for i, c := range columns {
+				o.Public(NewSymbol(c), values[i])
+			}
+
+			return NewObject(o)
+		}))
+	})
+	s.PublicMethod("query-lists", func(t *Task, args Cell) bool {
+		return t.Return(rows(t, db, args, func(columns []string, values []Cell) Cell {
+			return List(values...)
+		}))
+	})
+
+	return NewObject(s)
+}
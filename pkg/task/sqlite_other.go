@@ -0,0 +1,22 @@
+// Released under an MIT-style license. See LICENSE.
+
+// +build !darwin,!freebsd,!linux,!netbsd,!openbsd,!windows
+
+package task
+
+import (
+	"database/sql"
+	"errors"
+	. "github.com/michaelmacinnis/oh/pkg/cell"
+)
+
+/* SQLite, and so sqlite-open and store-open, cannot be used here. */
+var errNoSQLite = errors.New("sqlite: not supported on this platform")
+
+func openDatabase(t *Task, path string) (*sql.DB, error) {
+	return nil, errNoSQLite
+}
+
+func sqliteOpen(t *Task, path string) Cell {
+	return NewError(t, errNoSQLite)
+}
@@ -0,0 +1,128 @@
+// Released under an MIT-style license. See LICENSE.
+
+package task
+
+import (
+	"database/sql"
+	. "github.com/michaelmacinnis/oh/pkg/cell"
+)
+
+/*
+ * The store-open command opens, or creates, a store, a file in which a
+ * script can keep values between runs, and returns an object with the
+ * methods:
+ *
+ *     close              close the store
+ *     delete key         remove key, returning true if it was present
+ *     get key [default]  return the value of key or, if it is not present,
+ *                        default, or false
+ *     list [prefix]      return the keys, in order, that begin with prefix
+ *     put key value      set the value of key
+ *
+ * Values are kept as write-to-string writes them, so anything that it can
+ * write can be stored. A store is an SQLite database, so each change is
+ * written atomically, and several scripts can use a store at once. Once
+ * the write capability has been removed, put and delete cannot be used.
+ */
+
+/* Return an object for the store at path. */
+func storeOpen(t *Task, path string) Cell {
+	db, err := openDatabase(t, path)
+	if err != nil {
+		return NewError(t, err)
+	}
+
+	if allowed("write") {
+		_, err = db.Exec("create table if not exists store " +
+			"(key text primary key, value text not null)")
+		if err != nil {
+			db.Close()
+			return NewError(t, err)
+		}
+	}
+
+	s := NewScope(scope0, nil)
+	s.PublicMethod("close", func(t *Task, args Cell) bool {
+		if err := db.Close(); err != nil {
+			return t.Return(NewError(t, err))
+		}
+
+		return t.Return(True)
+	})
+	s.PublicMethod("delete", func(t *Task, args Cell) bool {
+		demand("write")
+
+		r, err := db.Exec("delete from store where key = ?", raw(Car(args)))
+		if err != nil {
+			return t.Return(NewError(t, err))
+		}
+
+		n, err := r.RowsAffected()
+		if err != nil {
+			return t.Return(NewError(t, err))
+		}
+
+		return t.Return(NewBoolean(n > 0))
+	})
+	s.PublicMethod("get", func(t *Task, args Cell) bool {
+		v := ""
+
+		q := "select value from store where key = ?"
+		err := db.QueryRow(q, raw(Car(args))).Scan(&v)
+		if err == sql.ErrNoRows {
+			if Cdr(args) == Null {
+				return t.Return(False)
+			}
+
+			return t.Return(Cadr(args))
+		} else if err != nil {
+			return t.Return(NewError(t, err))
+		}
+
+		return t.Return(unserialize(t, v))
+	})
+	s.PublicMethod("list", func(t *Task, args Cell) bool {
+		prefix := ""
+		if args != Null {
+			prefix = raw(Car(args))
+		}
+
+		q := "select key from store " +
+			"where substr(key, 1, length(?1)) = ?1 order by key"
+		r, err := db.Query(q, prefix)
+		if err != nil {
+			return t.Return(NewError(t, err))
+		}
+		defer r.Close()
+
+		l := []Cell{}
+		for r.Next() {
+			k := ""
+			if err = r.Scan(&k); err != nil {
+				return t.Return(NewError(t, err))
+			}
+
+			l = append(l, NewString(t, k))
+		}
+
+		if err = r.Err(); err != nil {
+			return t.Return(NewError(t, err))
+		}
+
+		return t.Return(List(l...))
+	})
+	s.PublicMethod("put", func(t *Task, args Cell) bool {
+		demand("write")
+
+		q := "insert into store values (?, ?) " +
+			"on conflict (key) do update set value = excluded.value"
+		_, err := db.Exec(q, raw(Car(args)), serialize(Cadr(args)))
+		if err != nil {
+			return t.Return(NewError(t, err))
+		}
+
+		return t.Return(True)
+	})
+
+	return NewObject(s)
+}
@@ -9,24 +9,23 @@ import (
 	"github.com/michaelmacinnis/oh/pkg/boot"
 	. "github.com/michaelmacinnis/oh/pkg/cell"
 	"github.com/michaelmacinnis/oh/pkg/common"
-	"github.com/peterh/liner"
+	"io/ioutil"
+	"math/big"
 	"os"
 	"path"
 	"path/filepath"
 	"regexp"
+	"runtime"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
 )
 
-type ui interface {
-	Close() error
-	Exists() bool
-	ReadString(delim byte) (line string, err error)
-}
-
 type reader func(*Task, common.ReadStringer,
-	func(string, uintptr) Cell, func(Cell))
+	func(string, uintptr) Cell, func(Cell)) bool
 
 const (
 	SaveCarCode = 1 << iota
@@ -34,6 +33,7 @@ const (
 	SaveDynamic
 	SaveLexical
 	SaveScratch
+	SaveProtect
 	SaveMax
 )
 
@@ -48,17 +48,33 @@ const (
 	psEvalElementBuiltin
 	psEvalMember
 
+	psExecAnd
 	psExecBuiltin
+	psExecCase
 	psExecCommand
+	psExecCond
+	psExecConstant
+	psExecDefault
 	psExecDefine
 	psExecDynamic
+	psExecErrexit
+	psExecForIn
+	psExecForNext
 	psExecIf
+	psExecIterate
+	psExecLet
+	psExecLetrec
+	psExecLocal
 	psExecMethod
+	psExecOr
+	psExecProtect
 	psExecPublic
 	psExecSet
 	psExecSetenv
 	psExecSplice
 	psExecSyntax
+	psExecUnless
+	psExecUnwind
 	psExecWhileBody
 	psExecWhileTest
 	psReturn
@@ -68,22 +84,47 @@ const (
 )
 
 var (
-	env0        *Env
-	external    Cell
-	interactive bool
-	jobs        = map[int]*Task{}
-	parse       reader
-	pgid        int
-	pid         int
-	runnable    chan bool
-	scope0      *Scope
-	task0       *Task
+	each          Binding
+	editor        common.LineEditor
+	env0          *Env
+	external      Cell
+	interactive   bool
+	interpolation = regexp.MustCompile("(?:\\$\\$)|(?:\\${.+?})")
+	jobs          = map[int]*Task{}
+	parse         reader
+	pgid          int
+	pid           int
+	runnable      chan bool
+	scope0        *Scope
+	task0         *Task
+)
+
+/* Startup options, set from the command line before Start is called. */
+var (
+	BundleOutput  string
+	CommandString string
+	Control       string
+	FormatOnly    bool
+	Login         bool
+	NoProfile     bool
+	NoRC          bool
+	ParseOnly     bool
 )
 
+/* Files sourced to define commands, by path. */
+var autoloaded = struct {
+	sync.Mutex
+	paths map[string]bool
+}{paths: map[string]bool{}}
+
+/* Shifts are limited, in bits, so that a mistake cannot exhaust memory. */
+const maxShift = 1 << 24
+
 var next = map[int64][]int64{
 	psEvalArguments:        {SaveCdrCode, psEvalElement},
 	psEvalArgumentsBuiltin: {SaveCdrCode, psEvalElementBuiltin},
 	psExecIf:               {psEvalBlock},
+	psExecUnless:           {psEvalBlock},
 	psExecWhileBody:        {psExecWhileTest, SaveCode, psEvalBlock},
 }
 
@@ -96,6 +137,110 @@ func asConduit(o Context) Conduit {
 	return nil
 }
 
+/* Combine the integers in args, for the command name, with f. */
+func bitwise(name string, args Cell, f func(z, x, y *big.Int) *big.Int) Cell {
+	if args == Null {
+		panic("error/runtime: " + name + " expects integers")
+	}
+
+	acc := integer(name, Car(args))
+	for args = Cdr(args); args != Null; args = Cdr(args) {
+		acc = f(acc, acc, integer(name, Car(args)))
+	}
+
+	return integerCell(acc)
+}
+
+/*
+ * Return the body of the first clause with a pattern matching v and the
+ * bindings made by the match, or a nil body if no clause matches.
+ */
+func choose(t *Task, v, clauses Cell) (Cell, Cell) {
+	for ; clauses != Null; clauses = Cdr(clauses) {
+		p := Caar(clauses)
+		if IsAtom(p) && raw(p) == "else" {
+			return Cdar(clauses), Null
+		}
+
+		if b, ok := pattern(t, p, v, Null, true); ok {
+			return Cdar(clauses), b
+		}
+	}
+
+	return nil, Null
+}
+
+/*
+ * Parse, without evaluating, the command string, the script named by the
+ * first argument or the standard input. Returns the exit status.
+ */
+func check() int {
+	if _, ok := checked(); !ok {
+		return 1
+	}
+
+	return 0
+}
+
+/* Return the text of the script, as for check, and whether it parses. */
+func checked() (string, bool) {
+	text, err := script()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "oh: %v\n", err)
+		return "", false
+	}
+
+	r := bufio.NewReader(strings.NewReader(text + "\n"))
+
+	return text, parse(nil, r, deref, func(Cell) {})
+}
+
+/* Return the test of the cond clause c. An else clause always matches. */
+func condition(c Cell) Cell {
+	if p := Car(c); !IsAtom(p) || raw(p) != "else" {
+		return p
+	}
+
+	return True
+}
+
+/* Return the number of elements in the range that the integer c stands for. */
+func count(c Cell) (int64, bool) {
+	switch c.(type) {
+	case *Integer:
+		return c.(Atom).Int(), true
+	case *Symbol:
+		if n, err := strconv.ParseInt(raw(c), 0, 64); err == nil {
+			return n, true
+		}
+	}
+
+	return 0, false
+}
+
+/*
+ * Match the value v against the list pattern p, as for case, and return
+ * the bindings. A (splice name) element, written @name, binds the
+ * remaining elements.
+ */
+func destructure(t *Task, p, v Cell) Cell {
+	b, ok := pattern(t, p, v, Null, true)
+	if !ok {
+		panic("error/runtime: value does not match pattern")
+	}
+
+	return b
+}
+
+func elements(l Cell) []Cell {
+	s := []Cell{}
+	for ; l != Null; l = Cdr(l) {
+		s = append(s, Car(l))
+	}
+
+	return s
+}
+
 func expand(t *Task, args Cell) Cell {
 	list := Null
 
@@ -117,11 +262,27 @@ func expand(t *Task, args Cell) Cell {
 			continue
 		}
 
-		m, err := filepath.Glob(s)
+		m, err := filepath.Glob(resolvePath(t, s))
+		if err == nil && len(m) == 0 {
+			switch raw(t.Option("unmatched")) {
+			case "empty":
+				continue
+			case "literal":
+				list = AppendTo(list, NewSymbol(s))
+				continue
+			}
+		}
 		if err != nil || len(m) == 0 {
 			panic("no matches found: " + s)
 		}
 
+		/* Matches are relative to $cwd if the pattern is. */
+		if dir := relativeTo(t); dir != "" && !filepath.IsAbs(s) {
+			for i, v := range m {
+				m[i], _ = filepath.Rel(dir, v)
+			}
+		}
+
 		for _, v := range m {
 			if v[0] != '.' || s[0] == '.' {
 				e := NewString(t, v)
@@ -145,9 +306,44 @@ func init() {
 	/* Root Scope. */
 	scope0 = NewScope(nil, nil)
 
+	/* The method applied by the 'for list method' form of for. */
+	each = NewBound(NewMethod(func(t *Task, args Cell) bool {
+		return iterate(t, "for", Cadr(args), Car(args), false, Null,
+			func(it *Iterator, item, v Cell) {
+				it.Append(v)
+			})
+	}, Null, Null, Null, scope0), scope0)
+
 	/* Arithmetic. */
 	bindArithmetic(scope0)
 
+	/* Bitwise. */
+	scope0.DefineMethod("band", func(t *Task, args Cell) bool {
+		return t.Return(bitwise("band", args, (*big.Int).And))
+	})
+	scope0.DefineMethod("bnot", func(t *Task, args Cell) bool {
+		if args == Null || Cdr(args) != Null {
+			panic("error/runtime: bnot expects an integer")
+		}
+
+		i := integer("bnot", Car(args))
+		return t.Return(integerCell(i.Not(i)))
+	})
+	scope0.DefineMethod("bor", func(t *Task, args Cell) bool {
+		return t.Return(bitwise("bor", args, (*big.Int).Or))
+	})
+	scope0.DefineMethod("bxor", func(t *Task, args Cell) bool {
+		return t.Return(bitwise("bxor", args, (*big.Int).Xor))
+	})
+	scope0.DefineMethod("shl", func(t *Task, args Cell) bool {
+		i, n := shift("shl", args)
+		return t.Return(integerCell(i.Lsh(i, n)))
+	})
+	scope0.DefineMethod("shr", func(t *Task, args Cell) bool {
+		i, n := shift("shr", args)
+		return t.Return(integerCell(i.Rsh(i, n)))
+	})
+
 	/* Builtins. */
 	scope0.DefineBuiltin("cd", func(t *Task, args Cell) bool {
 		err := os.Chdir(raw(Car(args)))
@@ -171,7 +367,7 @@ func init() {
 		count := 0
 		for ; args != Null; args = Cdr(args) {
 			count++
-			if _, err := os.Stat(raw(Car(args))); err != nil {
+			if _, err := os.Stat(resolvePath(t, raw(Car(args)))); err != nil {
 				return t.Return(False)
 			}
 		}
@@ -221,11 +417,11 @@ func init() {
 		sort.Ints(i)
 		for k, v := range i {
 			if k != len(jobs)-1 {
-				fmt.Printf("[%d] \t%d\t%s\n", v,
+				t.Fprintf("$stdout", "[%d] \t%d\t%s\n", v,
 					jobs[v].Job.Group,
 					jobs[v].Job.Command)
 			} else {
-				fmt.Printf("[%d]+\t%d\t%s\n", v,
+				t.Fprintf("$stdout", "[%d]+\t%d\t%s\n", v,
 					jobs[v].Job.Group,
 					jobs[v].Job.Command)
 			}
@@ -280,6 +476,24 @@ func init() {
 	/* Relational. */
 	bindRelational(scope0)
 
+	scope0.DefineMethod("eq?", func(t *Task, args Cell) bool {
+		for l := args; Cdr(l) != Null; l = Cdr(l) {
+			if !identical(Car(l), Cadr(l)) {
+				return t.Return(False)
+			}
+		}
+
+		return t.Return(True)
+	})
+	scope0.DefineMethod("equal?", func(t *Task, args Cell) bool {
+		for l := args; Cdr(l) != Null; l = Cdr(l) {
+			if !equal(Car(l), Cadr(l)) {
+				return t.Return(False)
+			}
+		}
+
+		return t.Return(True)
+	})
 	scope0.DefineMethod("match", func(t *Task, args Cell) bool {
 		pattern := raw(Car(args))
 		text := raw(Cadr(args))
@@ -324,377 +538,1912 @@ func init() {
 
 		return t.Return(s)
 	})
-	scope0.DefineMethod("exit", func(t *Task, args Cell) bool {
-		t.Scratch = List(Car(args))
+	scope0.DefineMethod("apply", func(t *Task, args Cell) bool {
+		f := Car(args)
 
-		t.Stop()
+		SetCar(t.Scratch, f)
+
+		state := int64(psExecMethod)
+		if _, ok := f.(Binding); !ok {
+			t.Scratch = Cons(external, t.Scratch)
+			state = psExecBuiltin
+		}
+
+		t.Scratch = Cons(nil, t.Scratch)
+
+		for args = Cdr(args); args != Null; args = Cdr(args) {
+			if Cdr(args) != Null {
+				t.Scratch = Cons(Car(args), t.Scratch)
+				continue
+			}
+
+			l := Car(args)
+			if !IsCons(l) {
+				panic("error/runtime: apply expects a list")
+			}
+			for ; l != Null; l = Cdr(l) {
+				t.Scratch = Cons(Car(l), t.Scratch)
+			}
+		}
+
+		t.ReplaceStates(state)
 
 		return true
 	})
-	scope0.DefineMethod("length", func(t *Task, args Cell) bool {
-		var l int64
+	scope0.DefineMethod("argparse", func(t *Task, args Cell) bool {
+		out := Resolve(t.Lexical, t.Dynamic, NewSymbol("$stdout")).Get()
 
-		switch c := Car(args); c.(type) {
-		case *String, *Symbol:
-			l = int64(len(raw(c)))
-		default:
-			l = Length(c)
+		r := argparse(t, Car(args), Cadr(args), toConduit(out.(Context)))
+		if r == nil {
+			t.Scratch = List(NewStatus(0))
+
+			t.Stop()
+
+			return true
 		}
 
-		return t.Return(NewInteger(l))
+		return t.Return(r)
 	})
-	scope0.DefineMethod("list-to-string", func(t *Task, args Cell) bool {
-		s := ""
-		for l := Car(args); l != Null; l = Cdr(l) {
-			s = fmt.Sprintf("%s%c", s, int(Car(l).(Atom).Int()))
+	scope0.DefineMethod("assert-equal", func(t *Task, args Cell) bool {
+		expected, actual := Car(args), Cadr(args)
+		if !equal(expected, actual) {
+			msg := fmt.Sprintf("expected %s, got %s",
+				pretty(expected, defaultWidth, false),
+				pretty(actual, defaultWidth, false))
+			panic("error/assertion: " + msg)
 		}
 
-		return t.Return(NewString(t, s))
+		return t.Return(True)
 	})
-	scope0.DefineMethod("list-to-symbol", func(t *Task, args Cell) bool {
-		s := ""
-		for l := Car(args); l != Null; l = Cdr(l) {
-			s = fmt.Sprintf("%s%c", s, int(Car(l).(Atom).Int()))
+	scope0.DefineMethod("assert-status", func(t *Task, args Cell) bool {
+		expected, actual := status(Car(args)), status(Cadr(args))
+		if expected != actual {
+			msg := fmt.Sprintf("expected status %d, got %d",
+				expected, actual)
+			panic("error/assertion: " + msg)
 		}
 
-		return t.Return(NewSymbol(s))
+		return t.Return(True)
 	})
-	scope0.DefineMethod("open", func(t *Task, args Cell) bool {
-		mode := raw(Car(args))
-		path := raw(Cadr(args))
-		flags := 0
+	scope0.DefineMethod("autoload", func(t *Task, args Cell) bool {
+		k := NewSymbol("$autoload")
 
-		if strings.IndexAny(mode, "-") == -1 {
-			flags = os.O_CREATE
+		dirs := Null
+		if r := env0.Access(k); r != nil {
+			dirs = r.Get()
 		}
-
-		read := false
-		if strings.IndexAny(mode, "r") != -1 {
-			read = true
+		for ; args != Null; args = Cdr(args) {
+			dirs = AppendTo(dirs, NewSymbol(raw(Car(args))))
 		}
+		env0.Add(k, dirs)
 
-		write := false
-		if strings.IndexAny(mode, "w") != -1 {
-			write = true
-			if strings.IndexAny(mode, "a") == -1 {
-				flags |= os.O_TRUNC
-			}
+		return t.Return(dirs)
+	})
+	scope0.DefineMethod("buffer", func(t *Task, args Cell) bool {
+		return t.Return(NewBuffer(t, octets(args)))
+	})
+	scope0.DefineMethod("call/cc", func(t *Task, args Cell) bool {
+		f, ok := Car(args).(Binding)
+		if !ok {
+			panic("error/runtime: call/cc expects a method")
 		}
 
-		if strings.IndexAny(mode, "a") != -1 {
-			write = true
-			flags |= os.O_APPEND
-		}
+		cc := t.Capture(Cdr(t.Scratch))
 
-		if read == write {
-			read = true
-			write = true
-			flags |= os.O_RDWR
-		} else if write {
-			flags |= os.O_WRONLY
-		}
+		SetCar(t.Scratch, f)
+		t.Scratch = Cons(cc, Cons(nil, t.Scratch))
 
-		f, err := os.OpenFile(path, flags, 0666)
-		if err != nil {
-			panic(err)
-		}
+		t.ReplaceStates(psExecMethod)
+
+		return true
+	})
+	scope0.DefineMethod("cbor-decode", func(t *Task, args Cell) bool {
+		v := unpack(octets(args), "cbor-decode", (*unpacker).cbor)
 
-		r := f
-		if !read {
-			r = nil
+		return t.Return(jsonCell(t, v))
+	})
+	scope0.DefineMethod("cbor-encode", func(t *Task, args Cell) bool {
+		b := cborEncode(nil, jsonValue(Car(args), map[Cell]bool{}))
+
+		return t.Return(NewBuffer(t, b))
+	})
+	scope0.DefineMethod("checksum-file", func(t *Task, args Cell) bool {
+		algorithm := "sha256"
+		if Cdr(args) != Null {
+			algorithm = raw(Cadr(args))
 		}
 
-		w := f
-		if !write {
-			w = nil
+		sum, err := checksumFile(t, raw(Car(args)), algorithm)
+		if err != nil {
+			return t.Return(NewError(t, err))
 		}
 
-		return t.Return(NewPipe(t.Lexical, r, w))
+		return t.Return(NewString(t, sum))
 	})
-	scope0.DefineMethod("set-car", func(t *Task, args Cell) bool {
-		SetCar(Car(args), Cadr(args))
+	scope0.DefineMethod("choose", func(t *Task, args Cell) bool {
+		chosen := chooseItems(t, args, false)
+		if chosen == nil {
+			return t.Return(False)
+		}
 
-		return t.Return(Cadr(args))
+		return t.Return(chosen[0])
 	})
-	scope0.DefineMethod("set-cdr", func(t *Task, args Cell) bool {
-		SetCdr(Car(args), Cadr(args))
+	scope0.DefineMethod("choose-many", func(t *Task, args Cell) bool {
+		chosen := chooseItems(t, args, true)
+		if chosen == nil {
+			return t.Return(False)
+		}
 
-		return t.Return(Cadr(args))
+		return t.Return(List(chosen...))
 	})
-	scope0.DefineMethod("temp-fifo", func(t *Task, args Cell) bool {
-		name, err := adapted.TempFifo("fifo-")
-		if err != nil {
-			panic(err)
+	scope0.DefineMethod("chunk", func(t *Task, args Cell) bool {
+		n := Car(args).(Atom).Int()
+		if n < 1 {
+			panic("error/runtime: chunk expects a positive size")
 		}
 
-		return t.Return(NewSymbol(name))
-	})
-	scope0.DefineMethod("wait", func(t *Task, args Cell) bool {
-		if args == Null {
-			t.Wait()
+		chunks := []Cell{}
+		chunk := []Cell{}
+		for l := Cadr(args); l != Null; l = Cdr(l) {
+			chunk = append(chunk, Car(l))
+			if int64(len(chunk)) == n {
+				chunks = append(chunks, List(chunk...))
+				chunk = []Cell{}
+			}
 		}
-		list := args
-		for ; args != Null; args = Cdr(args) {
-			child := Car(args).(*Task)
-			<-child.Done
-			SetCar(args, Car(child.Scratch))
+		if len(chunk) > 0 {
+			chunks = append(chunks, List(chunk...))
 		}
-		return t.Return(list)
-	})
 
-	/* Standard Methods. */
-	scope0.PublicMethod("child", func(t *Task, args Cell) bool {
-		return t.Return(NewObject(NewScope(t.Self().Expose(), nil)))
+		return t.Return(List(chunks...))
 	})
-	scope0.PublicMethod("clone", func(t *Task, args Cell) bool {
-		return t.Return(NewObject(t.Self().Expose().Copy()))
+	scope0.DefineMethod("confirm", func(t *Task, args Cell) bool {
+		return t.Return(confirm(t, args))
 	})
-	scope0.PublicMethod("context", func(t *Task, args Cell) bool {
-		self := t.Self()
-		bare := self.Expose()
-		if self == bare {
-			self = NewObject(bare)
+	scope0.DefineMethod("conforms?", func(t *Task, args Cell) bool {
+		return t.Return(NewBoolean(respondsTo(Car(args), Cadr(args))))
+	})
+	scope0.DefineMethod("cpu-count", func(t *Task, args Cell) bool {
+		return t.Return(NewInteger(int64(runtime.NumCPU())))
+	})
+	scope0.DefineMethod("diff-cells", func(t *Task, args Cell) bool {
+		return t.Return(diffCells(t, Car(args), Cadr(args)))
+	})
+	scope0.DefineMethod("diff-lines", func(t *Task, args Cell) bool {
+		return t.Return(diffLines(t, Car(args), Cadr(args)))
+	})
+	scope0.DefineMethod("dial", func(t *Task, args Cell) bool {
+		c, err := dial(t, raw(Car(args)), raw(Cadr(args)))
+		if err != nil {
+			return t.Return(NewError(t, err))
 		}
-		return t.Return(self)
+
+		return t.Return(c)
 	})
-	scope0.PublicMethod("eval", func(t *Task, args Cell) bool {
-		scope := t.Self().Expose()
-		t.RemoveState()
-		if t.Lexical != scope {
-			t.NewStates(SaveLexical)
-			t.Lexical = scope
+	scope0.DefineMethod("disk-usage", func(t *Task, args Cell) bool {
+		path := "."
+		if args != Null {
+			path = raw(Car(args))
 		}
-		t.NewStates(psEvalElement)
-		t.Code = Car(args)
-		t.Scratch = Cdr(t.Scratch)
 
-		return true
+		return t.Return(diskUsage(t, path))
 	})
-	scope0.PublicMethod("get-slot", func(t *Task, args Cell) bool {
-		s := raw(Car(args))
-		k := NewSymbol(s)
+	scope0.DefineMethod("drop", func(t *Task, args Cell) bool {
+		n := Car(args).(Atom).Int()
+		s := Cadr(args)
 
-		c := Resolve(t.Self(), nil, k)
-		if c == nil {
-			panic("error/runtime: '" + s + "' undefined")
-		} else if a, ok := c.Get().(Binding); ok {
-			return t.Return(a.Bind(t.Lexical))
-		} else {
-			return t.Return(c.Get())
+		if IsCons(s) {
+			for ; n > 0 && s != Null; n-- {
+				s = Cdr(s)
+			}
+
+			return t.Return(s)
+		}
+
+		next := sequence(t, "drop", s)
+		for ; n > 0 && next() != nil; n-- {
 		}
+
+		return t.Return(s)
 	})
-	scope0.PublicMethod("has", func(t *Task, args Cell) bool {
-		c := Resolve(t.Self(), t.Dynamic, NewSymbol(raw(Car(args))))
+	scope0.DefineMethod("exit", func(t *Task, args Cell) bool {
+		t.Scratch = List(Car(args))
 
-		return t.Return(NewBoolean(c != nil))
+		t.Stop()
+
+		return true
 	})
-	scope0.PublicMethod("interpolate", func(t *Task, args Cell) bool {
-		original := raw(Car(args))
+	scope0.DefineMethod("filter", func(t *Task, args Cell) bool {
+		return iterate(t, "filter", Car(args), Cadr(args), false, Null,
+			func(it *Iterator, item, v Cell) {
+				if v.Bool() {
+					it.Append(item)
+				}
+			})
+	})
+	scope0.DefineMethod("flatten", func(t *Task, args Cell) bool {
+		depth := int64(-1)
+		if Cdr(args) != Null {
+			depth = Cadr(args).(Atom).Int()
+		}
 
-		l := t.Self()
-		if t.Lexical == l.Expose() {
-			l = t.Lexical
+		return t.Return(List(flatten(Car(args), depth, nil)...))
+	})
+	scope0.DefineMethod("for-each", func(t *Task, args Cell) bool {
+		return iterate(t, "for-each", Car(args), Cadr(args), false, Null,
+			func(it *Iterator, item, v Cell) {})
+	})
+	scope0.DefineMethod("format-bytes", func(t *Task, args Cell) bool {
+		return t.Return(NewString(t, formatBytes(args)))
+	})
+	scope0.DefineMethod("format-duration", func(t *Task, args Cell) bool {
+		return t.Return(NewString(t, formatDuration(args)))
+	})
+	scope0.DefineMethod("format-number", func(t *Task, args Cell) bool {
+		return t.Return(NewString(t, formatNumber(args)))
+	})
+	scope0.DefineMethod("format-source", func(t *Task, args Cell) bool {
+		return t.Return(NewString(t, Format(raw(Car(args)))))
+	})
+	scope0.DefineMethod("group-by", func(t *Task, args Cell) bool {
+		key, ok := Car(args).(Binding)
+		if !ok {
+			panic("error/runtime: group-by expects a method")
 		}
 
-		f := func(ref string) string {
-			if ref == "$$" {
-				return "$"
-			}
+		call := t.Caller()
 
-			name := ref[2 : len(ref)-1]
-			sym := NewSymbol(name)
+		groups := []Cell{}
+		index := map[string]Cell{}
+		for l := Cadr(args); l != Null; l = Cdr(l) {
+			k := call(key, Car(l))
 
-			c := Resolve(l, t.Dynamic, sym)
-			if c == nil {
-				sym := NewSymbol("$" + name)
-				c = Resolve(l, t.Dynamic, sym)
-			}
-			if c == nil {
-				return "${" + name + "}"
+			g, ok := index[k.String()]
+			if !ok {
+				g = List(k)
+				index[k.String()] = g
+				groups = append(groups, g)
 			}
-
-			return raw(c.Get())
+			AppendTo(g, Car(l))
 		}
 
-		r := regexp.MustCompile("(?:\\$\\$)|(?:\\${.+?})")
-		modified := r.ReplaceAllStringFunc(original, f)
-
-		return t.Return(NewString(t, modified))
+		return t.Return(List(groups...))
 	})
-	scope0.PublicMethod("set-slot", func(t *Task, args Cell) bool {
-		s := raw(Car(args))
-		v := Cadr(args)
-
-		k := NewSymbol(s)
-
-		t.Self().Public(k, v)
-		return t.Return(v)
+	scope0.DefineMethod("hash", func(t *Task, args Cell) bool {
+		return t.Return(NewInteger(int64(hash(Car(args)))))
 	})
-	scope0.PublicMethod("unset", func(t *Task, args Cell) bool {
-		r := t.Self().Remove(NewSymbol(raw(Car(args))))
+	scope0.DefineMethod("hashed", func(t *Task, args Cell) bool {
+		return t.Return(hashedCommands())
+	})
+	scope0.DefineMethod("hostname", func(t *Task, args Cell) bool {
+		name, err := os.Hostname()
+		if err != nil {
+			return t.Return(NewError(t, err))
+		}
 
-		return t.Return(NewBoolean(r))
+		return t.Return(NewString(t, name))
 	})
+	scope0.DefineMethod("isatty", func(t *Task, args Cell) bool {
+		if a, ok := Car(args).(Atom); ok {
+			return t.Return(NewBoolean(IsTerminal(uintptr(a.Int()))))
+		}
 
-	/* Syntax. */
-	scope0.DefineSyntax("block", func(t *Task, args Cell) bool {
-		t.ReplaceStates(SaveDynamic|SaveLexical, psEvalBlock)
+		p, ok := toConduit(Car(args).(Context)).(*Pipe)
+		if !ok {
+			return t.Return(False)
+		}
+
+		f := p.WriteFd()
+		if f == nil {
+			f = p.ReadFd()
+		}
+
+		return t.Return(NewBoolean(f != nil && IsTerminal(f.Fd())))
+	})
+	scope0.DefineMethod("kill", func(t *Task, args Cell) bool {
+		return t.Return(kill(t, args))
+	})
+	scope0.DefineMethod("length", func(t *Task, args Cell) bool {
+		var l int64
+
+		switch c := Car(args); c.(type) {
+		case *String, *Symbol:
+			l = int64(len(raw(c)))
+		default:
+			l = Length(c)
+		}
+
+		return t.Return(NewInteger(l))
+	})
+	scope0.DefineMethod("list-to-string", func(t *Task, args Cell) bool {
+		s := ""
+		for l := Car(args); l != Null; l = Cdr(l) {
+			s = fmt.Sprintf("%s%c", s, int(Car(l).(Atom).Int()))
+		}
+
+		return t.Return(NewString(t, s))
+	})
+	scope0.DefineMethod("list-to-symbol", func(t *Task, args Cell) bool {
+		s := ""
+		for l := Car(args); l != Null; l = Cdr(l) {
+			s = fmt.Sprintf("%s%c", s, int(Car(l).(Atom).Int()))
+		}
+
+		return t.Return(NewSymbol(s))
+	})
+	scope0.DefineMethod("listen", func(t *Task, args Cell) bool {
+		c, err := listen(t, raw(Car(args)), raw(Cadr(args)))
+		if err != nil {
+			return t.Return(NewError(t, err))
+		}
+
+		return t.Return(c)
+	})
+	scope0.DefineMethod("map", func(t *Task, args Cell) bool {
+		return iterate(t, "map", Car(args), Cadr(args), false, Null,
+			func(it *Iterator, item, v Cell) {
+				it.Append(v)
+			})
+	})
+	scope0.DefineMethod("memory-info", func(t *Task, args Cell) bool {
+		m, err := MemoryInfo()
+		if err != nil {
+			return t.Return(NewError(t, err))
+		}
+
+		return t.Return(memoryObject(m))
+	})
+	scope0.DefineMethod("mixin", func(t *Task, args Cell) bool {
+		s := NewScope(t.Lexical.Expose(), nil)
+		for ; args != Null; args = Cdr(args) {
+			o, ok := Car(args).(Context)
+			if !ok {
+				panic("error/runtime: mixin expects objects")
+			}
+
+			f := o.Expose().Faces().Prev()
+			for _, k := range f.Names() {
+				if r, ok := f.get(k); ok {
+					s.Public(NewSymbol(k), r.Get())
+				}
+			}
+		}
+
+		return t.Return(NewObject(s))
+	})
+	scope0.DefineMethod("mkfifo", func(t *Task, args Cell) bool {
+		perm := uint64(0666)
+		if Cdr(args) != Null {
+			var err error
+
+			perm, err = strconv.ParseUint(raw(Cadr(args)), 8, 32)
+			if err != nil || perm > 0777 {
+				panic("error/runtime: invalid permissions: " + raw(Cadr(args)))
+			}
+		}
+
+		if err := mkfifo(t, raw(Car(args)), uint32(perm)); err != nil {
+			return t.Return(NewError(t, err))
+		}
+
+		return t.Return(True)
+	})
+	scope0.DefineMethod("mock-command", func(t *Task, args Cell) bool {
+		m := NewObject(NewScope(scope0, nil))
+		m.Public(NewSymbol("name"), Car(args))
+		m.Public(NewSymbol("method"), Cadr(args))
+		m.Public(NewSymbol("calls"), Null)
+
+		mocks := Null
+		if r := Resolve(t.Lexical, t.Dynamic, NewSymbol("$mocks")); r != nil {
+			mocks = r.Get()
+		}
+		t.Dynamic.Add(NewSymbol("$mocks"), Cons(m, mocks))
+
+		return t.Return(m)
+	})
+	scope0.DefineMethod("mounts", func(t *Task, args Cell) bool {
+		return t.Return(mounts(t))
+	})
+	scope0.DefineMethod("msgpack-decode", func(t *Task, args Cell) bool {
+		v := unpack(octets(args), "msgpack-decode", (*unpacker).msgpack)
+
+		return t.Return(jsonCell(t, v))
+	})
+	scope0.DefineMethod("msgpack-encode", func(t *Task, args Cell) bool {
+		b := msgpackEncode(nil, jsonValue(Car(args), map[Cell]bool{}))
+
+		return t.Return(NewBuffer(t, b))
+	})
+	scope0.DefineMethod("mutex", func(t *Task, args Cell) bool {
+		return t.Return(NewMutex(t))
+	})
+	scope0.DefineMethod("now", func(t *Task, args Cell) bool {
+		return t.Return(NewFloat(float64(now().UnixNano()) / 1e9))
+	})
+	scope0.DefineMethod("open", func(t *Task, args Cell) bool {
+		f, err := open(t, args)
+		if err != nil {
+			return t.Return(NewError(t, err))
+		}
+
+		return t.Return(f)
+	})
+	scope0.DefineMethod("os-release", func(t *Task, args Cell) bool {
+		return t.Return(osRelease(t))
+	})
+	scope0.DefineMethod("parse-bytes", func(t *Task, args Cell) bool {
+		return t.Return(parseBytes(raw(Car(args))))
+	})
+	scope0.DefineMethod("parse-duration", func(t *Task, args Cell) bool {
+		return t.Return(parseDuration(raw(Car(args))))
+	})
+	scope0.DefineMethod("parse-number", func(t *Task, args Cell) bool {
+		return t.Return(parseNumber(args))
+	})
+	scope0.DefineMethod("parse-string", func(t *Task, args Cell) bool {
+		locations := Cdr(args) != Null && Cadr(args).(Atom).Bool()
+
+		return t.Return(parseString(t, raw(Car(args)), locations))
+	})
+	scope0.DefineMethod("partition", func(t *Task, args Cell) bool {
+		pred, ok := Car(args).(Binding)
+		if !ok {
+			panic("error/runtime: partition expects a method")
+		}
+
+		call := t.Caller()
+
+		yes := []Cell{}
+		no := []Cell{}
+		for l := Cadr(args); l != Null; l = Cdr(l) {
+			if call(pred, Car(l)).Bool() {
+				yes = append(yes, Car(l))
+			} else {
+				no = append(no, Car(l))
+			}
+		}
+
+		return t.Return(List(List(yes...), List(no...)))
+	})
+	scope0.DefineMethod("pidof", func(t *Task, args Cell) bool {
+		return t.Return(pidof(t, raw(Car(args))))
+	})
+	scope0.DefineMethod("pmap", func(t *Task, args Cell) bool {
+		n := Car(args).(Atom).Int()
+
+		return t.Return(pmap(t, n, Cadr(args), Caddr(args)))
+	})
+	scope0.DefineMethod("pretty", func(t *Task, args Cell) bool {
+		width := defaultWidth
+		if Cdr(args) != Null {
+			width = int(Cadr(args).(Atom).Int())
+		}
+
+		return t.Return(NewString(t, pretty(Car(args), width, false)))
+	})
+	scope0.DefineMethod("process-exists?", func(t *Task, args Cell) bool {
+		return t.Return(NewBoolean(ProcessExists(processID(Car(args)))))
+	})
+	scope0.DefineMethod("process-list", func(t *Task, args Cell) bool {
+		return t.Return(processList(t))
+	})
+	scope0.DefineMethod("random", func(t *Task, args Cell) bool {
+		if args == Null {
+			return t.Return(NewFloat(randomFloat()))
+		}
+
+		n := Car(args).(Atom).Int()
+		if n <= 0 {
+			panic("error/runtime: random expects a positive integer")
+		}
+
+		return t.Return(NewInteger(randomInteger(n)))
+	})
+	scope0.DefineMethod("range", func(t *Task, args Cell) bool {
+		start, step := int64(0), int64(1)
+
+		end := Car(args).(Atom).Int()
+		if Cdr(args) != Null {
+			start, end = end, Cadr(args).(Atom).Int()
+		}
+		if c := Caddr(args); c != Null {
+			step = c.(Atom).Int()
+		}
+
+		if step == 0 {
+			panic("error/runtime: range expects a non-zero step")
+		}
+
+		l := []Cell{}
+		for i := start; (step > 0 && i < end) ||
+			(step < 0 && i > end); i += step {
+			l = append(l, NewInteger(i))
+		}
+
+		return t.Return(List(l...))
+	})
+	scope0.DefineMethod("reachable?", func(t *Task, args Cell) bool {
+		timeout := probeTimeout
+		if Cdr(args) != Null {
+			timeout = duration(Cadr(args))
+		}
+
+		d, ok := reachable(raw(Car(args)), timeout)
+		if !ok {
+			return t.Return(False)
+		}
+
+		return t.Return(NewFloat(d.Seconds()))
+	})
+	scope0.DefineMethod("read-commands", func(t *Task, args Cell) bool {
+		return t.Return(readCommands(t, raw(Car(args))))
+	})
+	scope0.DefineMethod("read-from-string", func(t *Task, args Cell) bool {
+		return t.Return(unserialize(t, raw(Car(args))))
+	})
+	scope0.DefineMethod("read-secret", func(t *Task, args Cell) bool {
+		prompt := ""
+		if args != Null {
+			prompt = raw(Car(args))
+		}
+
+		return t.Return(readSecret(t, prompt))
+	})
+	scope0.DefineMethod("reduce", func(t *Task, args Cell) bool {
+		return iterate(t, "reduce", Car(args), Caddr(args), true,
+			Cadr(args), func(it *Iterator, item, v Cell) {
+				it.Acc = v
+			})
+	})
+	scope0.DefineMethod("rehash", func(t *Task, args Cell) bool {
+		rehash()
+
+		return t.Return(True)
+	})
+	scope0.DefineMethod("responds-to?", func(t *Task, args Cell) bool {
+		return t.Return(NewBoolean(respondsTo(Car(args), Cdr(args))))
+	})
+	scope0.DefineMethod("run-tests", func(t *Task, args Cell) bool {
+		dirs := []string{}
+		for ; args != Null; args = Cdr(args) {
+			dirs = append(dirs, raw(Car(args)))
+		}
+		if len(dirs) == 0 {
+			dirs = append(dirs, ".")
+		}
+
+		return t.Return(runTests(t, dirs))
+	})
+	scope0.DefineMethod("secret", func(t *Task, args Cell) bool {
+		if IsSecret(Car(args)) {
+			return t.Return(Car(args))
+		}
+
+		return t.Return(NewSecret(t, raw(Car(args))))
+	})
+	scope0.DefineMethod("semaphore", func(t *Task, args Cell) bool {
+		n := Car(args).(Atom).Int()
+		if n < 1 {
+			panic("error/runtime: semaphore expects a positive integer")
+		}
+
+		return t.Return(NewSemaphore(t, int(n)))
+	})
+	scope0.DefineMethod("set-car", func(t *Task, args Cell) bool {
+		SetCar(Car(args), Cadr(args))
+
+		return t.Return(Cadr(args))
+	})
+	scope0.DefineMethod("set-cdr", func(t *Task, args Cell) bool {
+		SetCdr(Car(args), Cadr(args))
+
+		return t.Return(Cadr(args))
+	})
+	scope0.DefineMethod("set-clock", func(t *Task, args Cell) bool {
+		seconds := Car(args).(Atom).Float()
+		setClock(time.Unix(0, int64(seconds*1e9)))
+
+		return t.Return(Car(args))
+	})
+	scope0.DefineMethod("sort", func(t *Task, args Cell) bool {
+		/* Anything other than a single list goes to sort(1). */
+		if args == Null || !IsCons(Car(args)) || Cdr(args) != Null {
+			SetCar(t.Scratch, NewSymbol("sort"))
+			t.Scratch = Cons(external, t.Scratch)
+			t.Scratch = Cons(nil, t.Scratch)
+			for ; args != Null; args = Cdr(args) {
+				t.Scratch = Cons(Car(args), t.Scratch)
+			}
+			t.ReplaceStates(psExecBuiltin)
+			return true
+		}
+
+		l := elements(Car(args))
+
+		return t.Return(sorted(l, ordering(l)))
+	})
+	scope0.DefineMethod("sort-by", func(t *Task, args Cell) bool {
+		key, ok := Car(args).(Binding)
+		if !ok {
+			panic("error/runtime: sort-by expects a method")
+		}
+
+		call := t.Caller()
+
+		l := elements(Cadr(args))
+		keys := make([]Cell, len(l))
+		for i, v := range l {
+			keys[i] = call(key, v)
+		}
+
+		less := ordering(keys)
+		if c := Caddr(args); c != Null {
+			cmp, ok := c.(Binding)
+			if !ok {
+				panic("error/runtime: sort-by expects a method")
+			}
+
+			less = func(i, j int) bool {
+				return call(cmp, keys[i], keys[j]).Bool()
+			}
+		}
+
+		return t.Return(sorted(l, less))
+	})
+	scope0.DefineMethod("split-words", func(t *Task, args Cell) bool {
+		ifs := raw(t.dynamic("$ifs", NewSymbol(" \t\n")))
+
+		l := []Cell{}
+		for ; args != Null; args = Cdr(args) {
+			for _, w := range splitWords(raw(Car(args)), ifs) {
+				l = append(l, NewString(t, w))
+			}
+		}
+
+		return t.Return(List(l...))
+	})
+	scope0.DefineMethod("sqlite-open", func(t *Task, args Cell) bool {
+		return t.Return(sqliteOpen(t, raw(Car(args))))
+	})
+	scope0.DefineMethod("store-open", func(t *Task, args Cell) bool {
+		return t.Return(storeOpen(t, raw(Car(args))))
+	})
+	scope0.DefineMethod("style", func(t *Task, args Cell) bool {
+		out := Resolve(t.Lexical, t.Dynamic, NewSymbol("$stdout")).Get()
+
+		return t.Return(NewString(t, style(out, args)))
+	})
+	scope0.DefineMethod("take", func(t *Task, args Cell) bool {
+		n := Car(args).(Atom).Int()
+		next := sequence(t, "take", Cadr(args))
+
+		l := []Cell{}
+		for ; n > 0; n-- {
+			v := next()
+			if v == nil {
+				break
+			}
+			l = append(l, v)
+		}
+
+		return t.Return(List(l...))
+	})
+	scope0.DefineMethod("tcp-check", func(t *Task, args Cell) bool {
+		timeout := probeTimeout
+		if Cddr(args) != Null {
+			timeout = duration(Caddr(args))
+		}
+
+		d, err := tcpCheck(raw(Car(args)), raw(Cadr(args)), timeout)
+		if err != nil {
+			return t.Return(NewError(t, err))
+		}
+
+		return t.Return(NewFloat(d.Seconds()))
+	})
+	scope0.DefineMethod("term-size", func(t *Task, args Cell) bool {
+		rows, cols := TerminalSize()
+
+		return t.Return(List(NewInteger(int64(rows)), NewInteger(int64(cols))))
+	})
+	scope0.DefineMethod("temp-fifo", func(t *Task, args Cell) bool {
+		name, err := adapted.TempFifo("fifo-")
+		if err != nil {
+			panic(err)
+		}
+
+		return t.Return(NewSymbol(name))
+	})
+	scope0.DefineMethod("ticker", func(t *Task, args Cell) bool {
+		d := duration(Car(args))
+		if d <= 0 {
+			panic("error/runtime: ticker expects a positive duration")
+		}
+
+		return t.Return(NewTimer(t, d, true))
+	})
+	scope0.DefineMethod("timer", func(t *Task, args Cell) bool {
+		return t.Return(NewTimer(t, duration(Car(args)), false))
+	})
+	scope0.DefineMethod("umask", func(t *Task, args Cell) bool {
+		return t.Return(umask(args))
+	})
+	scope0.DefineMethod("unparse", func(t *Task, args Cell) bool {
+		return t.Return(NewString(t, unparse(Car(args))))
+	})
+	scope0.DefineMethod("unzip", func(t *Task, args Cell) bool {
+		return t.Return(List(zip(elements(Car(args)))...))
+	})
+	scope0.DefineMethod("uptime", func(t *Task, args Cell) bool {
+		seconds, err := Uptime()
+		if err != nil {
+			return t.Return(NewError(t, err))
+		}
+
+		return t.Return(NewFloat(seconds))
+	})
+	scope0.DefineMethod("verify-checksums", func(t *Task, args Cell) bool {
+		if err := verifyChecksums(t, raw(Car(args))); err != nil {
+			return t.Return(NewError(t, err))
+		}
+
+		return t.Return(True)
+	})
+	scope0.DefineMethod("wait", func(t *Task, args Cell) bool {
+		if args == Null {
+			t.Wait()
+		}
+		list := args
+		for ; args != Null; args = Cdr(args) {
+			child := Car(args).(*Task)
+			<-child.Done
+			SetCar(args, Car(child.Scratch))
+		}
+		return t.Return(list)
+	})
+	scope0.DefineMethod("wait-group", func(t *Task, args Cell) bool {
+		return t.Return(NewWaitGroup(t))
+	})
+	scope0.DefineMethod("write-to-string", func(t *Task, args Cell) bool {
+		return t.Return(NewString(t, serialize(Car(args))))
+	})
+	scope0.DefineMethod("zip", func(t *Task, args Cell) bool {
+		return t.Return(List(zip(elements(args))...))
+	})
+
+	/* Standard Methods. */
+	scope0.PublicMethod("child", func(t *Task, args Cell) bool {
+		return t.Return(NewObject(NewScope(t.Self().Expose(), nil)))
+	})
+	scope0.PublicMethod("clone", func(t *Task, args Cell) bool {
+		return t.Return(NewObject(t.Self().Expose().Copy()))
+	})
+	scope0.PublicMethod("context", func(t *Task, args Cell) bool {
+		self := t.Self()
+		bare := self.Expose()
+		if self == bare {
+			self = NewObject(bare)
+		}
+		return t.Return(self)
+	})
+	scope0.PublicMethod("eval", func(t *Task, args Cell) bool {
+		scope := t.Self().Expose()
+		t.RemoveState()
+		if t.Lexical != scope {
+			t.NewStates(SaveLexical)
+			t.Lexical = scope
+		}
+		t.NewStates(psEvalElement)
+		t.Code = Car(args)
+		t.Scratch = Cdr(t.Scratch)
+
+		return true
+	})
+	scope0.PublicMethod("get-slot", func(t *Task, args Cell) bool {
+		s := raw(Car(args))
+		k := NewSymbol(s)
+
+		c := Resolve(t.Self(), nil, k)
+		if c == nil {
+			panic("error/runtime: '" + s + "' undefined")
+		} else if a, ok := c.Get().(Binding); ok {
+			return t.Return(a.Bind(t.Lexical))
+		} else {
+			return t.Return(c.Get())
+		}
+	})
+	scope0.PublicMethod("has", func(t *Task, args Cell) bool {
+		c := Resolve(t.Self(), t.Dynamic, NewSymbol(raw(Car(args))))
+
+		return t.Return(NewBoolean(c != nil))
+	})
+	scope0.PublicMethod("interpolate", func(t *Task, args Cell) bool {
+		original := raw(Car(args))
+
+		l := t.Self()
+		if t.Lexical == l.Expose() {
+			l = t.Lexical
+		}
+
+		lookup := func(name string) Reference {
+			members := strings.Split(name, "::")
+
+			c := Resolve(l, t.Dynamic, NewSymbol(members[0]))
+			if c == nil {
+				sym := NewSymbol("$" + members[0])
+				c = Resolve(l, t.Dynamic, sym)
+			}
+
+			for _, member := range members[1:] {
+				if c == nil {
+					return nil
+				}
+
+				o, ok := c.Get().(Context)
+				if !ok {
+					return nil
+				}
+
+				c = o.Access(NewSymbol(member))
+			}
+
+			return c
+		}
+
+		f := func(ref string) string {
+			if ref == "$$" {
+				return "$"
+			}
+
+			name := ref[2 : len(ref)-1]
+
+			op, word := "", ""
+
+			i := strings.Index(name, ":-")
+			if j := strings.Index(name, ":+"); j > 0 && (i < 0 || j < i) {
+				i = j
+			}
+			if i > 0 {
+				op, word = name[i:i+2], name[i+2:]
+				name = name[:i]
+			}
+
+			value := ""
+			c := lookup(name)
+			if c != nil {
+				value = raw(c.Get())
+			}
+
+			switch op {
+			case ":-":
+				if value == "" {
+					return word
+				}
+			case ":+":
+				if value != "" {
+					return word
+				}
+				return ""
+			default:
+				if c == nil {
+					return "${" + name + "}"
+				}
+			}
+
+			return value
+		}
+
+		modified := interpolation.ReplaceAllStringFunc(original, f)
+
+		return t.Return(NewString(t, modified))
+	})
+	scope0.PublicMethod("public-slots", func(t *Task, args Cell) bool {
+		f := t.Self().Expose().Faces()
+
+		return t.Return(slots(Car(args).Bool(), f.Prev()))
+	})
+	scope0.PublicMethod("set-slot", func(t *Task, args Cell) bool {
+		s := raw(Car(args))
+		v := Cadr(args)
+
+		k := NewSymbol(s)
+
+		t.Self().Public(k, v)
+		return t.Return(v)
+	})
+	scope0.PublicMethod("slots", func(t *Task, args Cell) bool {
+		f := t.Self().Expose().Faces()
+
+		return t.Return(slots(Car(args).Bool(), f, f.Prev()))
+	})
+	scope0.PublicMethod("unset", func(t *Task, args Cell) bool {
+		r := t.Self().Remove(NewSymbol(raw(Car(args))))
+
+		return t.Return(NewBoolean(r))
+	})
+
+	/* Syntax. */
+	scope0.DefineSyntax("and", func(t *Task, args Cell) bool {
+		return t.Junction(psExecAnd)
+	})
+	scope0.DefineSyntax("block", func(t *Task, args Cell) bool {
+		t.ReplaceStates(SaveDynamic|SaveLexical, psEvalBlock)
+
+		t.NewBlock(t.Dynamic, t.Lexical)
+
+		return true
+	})
+	scope0.DefineSyntax("case", func(t *Task, args Cell) bool {
+		t.ReplaceStates(SaveDynamic|SaveLexical,
+			psExecCase, SaveCode, psEvalElement)
+
+		t.NewBlock(t.Dynamic, t.Lexical)
+
+		t.Code = Car(t.Code)
+		t.Scratch = Cdr(t.Scratch)
+
+		return true
+	})
+	scope0.DefineSyntax("cond", func(t *Task, args Cell) bool {
+		if t.Code == Null {
+			return t.Return(False)
+		}
+
+		t.ReplaceStates(SaveDynamic|SaveLexical,
+			psExecCond, SaveCode, psEvalElement)
+
+		t.NewBlock(t.Dynamic, t.Lexical)
+
+		t.Code = condition(Car(t.Code))
+		t.Scratch = Cdr(t.Scratch)
+
+		return true
+	})
+	scope0.DefineSyntax("define-record", func(t *Task, args Cell) bool {
+		defineRecord(t.Lexical, raw(Car(args)), Cadr(args))
+
+		return t.Return(True)
+	})
+	scope0.DefineSyntax("describe", func(t *Task, args Cell) bool {
+		names := Cons(NewSymbol(raw(Car(t.Code))), describing(t))
+
+		failure := runChild(t, names, Cdr(t.Code))
+		if failure != nil {
+			report(t, testNames(names), failure, 0)
+		}
+
+		return t.Return(NewBoolean(failure == nil))
+	})
+	scope0.DefineSyntax("for", func(t *Task, args Cell) bool {
+		/* Without 'in', for applies a method to each element. */
+		if _, ok := Car(t.Code).(*Symbol); !ok || raw(Cadr(t.Code)) != "in" {
+			SetCar(t.Scratch, each)
+			t.Scratch = Cons(nil, t.Scratch)
+
+			t.ReplaceStates(psExecMethod, psEvalArguments)
+
+			return true
+		}
+
+		t.ReplaceStates(SaveDynamic|SaveLexical,
+			psExecForIn, SaveCode, psEvalElement)
+
+		t.Code = Caddr(t.Code)
+		t.Scratch = Cdr(t.Scratch)
+
+		return true
+	})
+	scope0.DefineSyntax("if", func(t *Task, args Cell) bool {
+		t.ReplaceStates(SaveDynamic|SaveLexical,
+			psExecIf, SaveCode, psEvalElement)
 
 		t.NewBlock(t.Dynamic, t.Lexical)
 
+		t.Code = Car(t.Code)
+		t.Scratch = Cdr(t.Scratch)
+
+		return true
+	})
+	scope0.DefineSyntax("it", func(t *Task, args Cell) bool {
+		names := Cons(NewSymbol(raw(Car(t.Code))), describing(t))
+
+		start := now()
+		failure := runChild(t, names, Cdr(t.Code))
+		report(t, testNames(names), failure, since(start))
+
+		return t.Return(NewBoolean(failure == nil))
+	})
+	scope0.DefineSyntax("let", func(t *Task, args Cell) bool {
+		return t.Let(psExecLet)
+	})
+	scope0.DefineSyntax("letrec", func(t *Task, args Cell) bool {
+		return t.Let(psExecLetrec)
+	})
+	scope0.DefineSyntax("make-env", func(t *Task, args Cell) bool {
+		t.ReplaceStates(SaveDynamic, psEvalBlock)
+
+		t.Dynamic = NewEnv(t.Dynamic)
+
+		return true
+	})
+	scope0.DefineSyntax("make-scope", func(t *Task, args Cell) bool {
+		t.ReplaceStates(SaveLexical, psEvalBlock)
+
+		t.Lexical = NewScope(t.Lexical, nil)
+
+		return true
+	})
+	scope0.DefineSyntax("or", func(t *Task, args Cell) bool {
+		return t.Junction(psExecOr)
+	})
+	scope0.DefineSyntax("readonly", func(t *Task, args Cell) bool {
+		for ; args != Null; args = Cdr(args) {
+			k := NewSymbol(raw(Car(args)))
+
+			found := false
+			if strings.HasPrefix(k.String(), "$") {
+				found = t.Dynamic.Freeze(k)
+			}
+			for c := t.Lexical; !found && c != nil; c = c.Prev() {
+				found = c.Faces().Freeze(k)
+			}
+
+			if !found {
+				panic("error/runtime: '" + k.String() + "' undefined")
+			}
+		}
+
+		return t.Return(True)
+	})
+	scope0.DefineSyntax("restrict", func(t *Task, args Cell) bool {
+		return t.Return(restrict(args))
+	})
+	scope0.DefineSyntax("set", func(t *Task, args Cell) bool {
+		t.Scratch = Cdr(t.Scratch)
+
+		s := Null
+		if Length(t.Code) == 3 {
+			if raw(Cadr(t.Code)) != "=" {
+				panic("error/syntax: expected '='")
+			}
+			s = Caddr(t.Code)
+		} else {
+			s = Cadr(t.Code)
+		}
+
+		t.Code = Car(t.Code)
+		if !IsCons(t.Code) || !IsAtom(Cdr(t.Code)) {
+			t.ReplaceStates(psExecSet, SaveCode)
+		} else {
+			t.ReplaceStates(SaveDynamic|SaveLexical,
+				psExecSet, SaveCdrCode,
+				psChangeContext, psEvalElement,
+				SaveCarCode)
+		}
+
+		t.NewStates(psEvalElement)
+
+		t.Code = s
 		return true
 	})
-	scope0.DefineSyntax("if", func(t *Task, args Cell) bool {
+	scope0.DefineSyntax("spawn", func(t *Task, args Cell) bool {
+		child := NewTask(t.Code, NewEnv(t.Dynamic),
+			NewScope(t.Lexical, nil), t)
+
+		go child.Launch()
+
+		SetCar(t.Scratch, child)
+
+		return false
+	})
+	scope0.DefineSyntax("splice", func(t *Task, args Cell) bool {
+		t.ReplaceStates(psExecSplice, psEvalElement)
+
+		t.Code = Car(t.Code)
+		t.Scratch = Cdr(t.Scratch)
+
+		return true
+	})
+	scope0.DefineSyntax("unless", func(t *Task, args Cell) bool {
 		t.ReplaceStates(SaveDynamic|SaveLexical,
-			psExecIf, SaveCode, psEvalElement)
+			psExecUnless, SaveCode, psEvalElement)
+
+		t.NewBlock(t.Dynamic, t.Lexical)
+
+		t.Code = Car(t.Code)
+		t.Scratch = Cdr(t.Scratch)
+
+		return true
+	})
+	scope0.DefineSyntax("unwind-protect", func(t *Task, args Cell) bool {
+		t.ReplaceStates(SaveCode|SaveDynamic|SaveLexical|SaveProtect,
+			psExecProtect)
+		t.protect = t.Stack
+		t.NewStates(psEvalElement)
+
+		t.Code = Car(t.Code)
+		t.Scratch = Cdr(t.Scratch)
+
+		return true
+	})
+	scope0.DefineSyntax("while", func(t *Task, args Cell) bool {
+		t.ReplaceStates(SaveDynamic|SaveLexical, psExecWhileTest)
+
+		return true
+	})
+	scope0.DefineSyntax("with-cwd", func(t *Task, args Cell) bool {
+		t.ReplaceStates(SaveDynamic|SaveLexical, psEvalBlock)
+
+		t.NewBlock(t.Dynamic, t.Lexical)
+
+		t.Code = withCwd(Car(t.Code), Cdr(t.Code))
+
+		return true
+	})
+	scope0.DefineSyntax("with-env", func(t *Task, args Cell) bool {
+		t.ReplaceStates(SaveDynamic|SaveLexical, psEvalBlock)
+
+		t.NewBlock(t.Dynamic, t.Lexical)
+
+		t.Code = withEnv(Car(t.Code), Cdr(t.Code))
+
+		return true
+	})
+	scope0.DefineSyntax("with-open", func(t *Task, args Cell) bool {
+		t.ReplaceStates(SaveDynamic|SaveLexical, psEvalBlock)
+
+		t.NewBlock(t.Dynamic, t.Lexical)
+
+		t.Code = withOpen(Car(t.Code), Cdr(t.Code))
+
+		return true
+	})
+	scope0.DefineSyntax("with-priority", func(t *Task, args Cell) bool {
+		t.ReplaceStates(SaveDynamic|SaveLexical, psEvalBlock)
+
+		t.NewBlock(t.Dynamic, t.Lexical)
+
+		t.Code = withPriority(Car(t.Code), Cdr(t.Code))
+
+		return true
+	})
+	scope0.DefineSyntax("with-rlimit", func(t *Task, args Cell) bool {
+		t.ReplaceStates(SaveDynamic|SaveLexical, psEvalBlock)
+
+		t.NewBlock(t.Dynamic, t.Lexical)
+
+		t.Code = withRlimit(Car(t.Code), Cadr(t.Code), Cddr(t.Code))
+
+		return true
+	})
+
+	/* The rest. */
+	bindTheRest(scope0)
+
+	scope0.Define(NewSymbol("log"), logger())
+	scope0.Define(NewSymbol("math"), mathObject())
+
+	scope0.Public(NewSymbol("$root"), scope0)
+
+	/* Root Environment. */
+	env0 = NewEnv(nil)
+
+	env0.Add(NewSymbol("false"), False)
+	env0.Add(NewSymbol("true"), True)
+
+	env0.Add(NewSymbol("$flags"), flags())
+	env0.Add(NewSymbol("$ifs"), NewSymbol(" \t\n"))
+	env0.Add(NewSymbol("$log-format"), NewSymbol("text"))
+	env0.Add(NewSymbol("$log-level"), NewSymbol("info"))
+	env0.Add(NewSymbol("$options"), options())
+	env0.Add(NewSymbol("$sandbox"), sandbox())
+	env0.Add(NewSymbol("$signals"), signals())
+
+	env0.Add(NewSymbol("$$"), NewInteger(int64(os.Getpid())))
+	env0.Add(NewSymbol("$platform"), NewSymbol(Platform))
+	env0.Add(NewSymbol("$stdin"), NewPipe(scope0, os.Stdin, nil))
+	env0.Add(NewSymbol("$stdout"), NewPipe(scope0, nil, os.Stdout))
+	env0.Add(NewSymbol("$stderr"), NewPipe(scope0, nil, os.Stderr))
+
+	/* Environment variables. */
+	for _, s := range os.Environ() {
+		kv := strings.SplitN(s, "=", 2)
+		if kv[0] == "" {
+			continue
+		}
+		k := "$" + environmentName(kv[0])
+		env0.Add(NewSymbol(k), NewSymbol(kv[1]))
+	}
+
+}
+
+/* Keyword parameters and arguments are written --name. */
+func isKeyword(s string) bool {
+	return len(s) > 2 && strings.HasPrefix(s, "--")
+}
+
+func isSimple(c Cell) bool {
+	return IsAtom(c) || IsCons(c)
+}
+
+/*
+ * Append the elements of l to s, replacing lists nested up to depth
+ * levels (or any number of levels if depth is negative) with their
+ * elements.
+ */
+func flatten(l Cell, depth int64, s []Cell) []Cell {
+	for ; l != Null; l = Cdr(l) {
+		if c := Car(l); IsCons(c) && depth != 0 {
+			s = flatten(c, depth-1, s)
+		} else {
+			s = append(s, c)
+		}
+	}
+
+	return s
+}
+
+/* Return the path of the file name in the user's home directory. */
+func home(name string) string {
+	dir, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(dir, name)
+}
+
+/*
+ * Return c, an argument to the command name, as an integer. An integer
+ * written with a leading 0 or 0o is octal, 0x is hexadecimal and 0b is
+ * binary.
+ */
+func integer(name string, c Cell) *big.Int {
+	switch v := c.(type) {
+	case *Integer, *Status:
+		return big.NewInt(v.(Atom).Int())
+	case Rational:
+		if v.Rat().IsInt() {
+			return new(big.Int).Set(v.Rat().Num())
+		}
+	case *String, *Symbol:
+		if i, ok := new(big.Int).SetString(raw(c), 0); ok {
+			return i
+		}
+	}
+
+	panic("error/runtime: " + name + " expects integers")
+}
+
+/* Return i as an integer or, if it does not fit in 64 bits, a rational. */
+func integerCell(i *big.Int) Cell {
+	if i.IsInt64() {
+		return NewInteger(i.Int64())
+	}
+
+	return NewRational(new(big.Rat).SetInt(i))
+}
+
+func iterate(t *Task, name string, f, s Cell, fold bool, acc Cell,
+	collect func(it *Iterator, item, v Cell)) bool {
+	b, ok := f.(Binding)
+	if !ok {
+		panic("error/runtime: " + name + " expects a method")
+	}
+
+	it := NewIterator(t, name, b, s, fold, collect)
+	it.Acc = acc
+
+	SetCar(t.Scratch, it)
+	t.Scratch = Cons(Null, t.Scratch)
+
+	t.ReplaceStates(psExecIterate)
+
+	return true
+}
+
+func jobControlEnabled() bool {
+	return interactive && JobControlSupported()
+}
+
+/*
+ * Remove the keyword arguments for the keyword parameters in params from
+ * args. Returns the remaining arguments and a map from each keyword to
+ * its value. A keyword declared without a default value is a flag and is
+ * true when present. Otherwise the keyword is followed by its value.
+ */
+func keywords(params, args Cell) (Cell, map[string]Cell) {
+	flags := map[string]bool{}
+	for ; params != Null; params = Cdr(params) {
+		p := Car(params)
+		if IsCons(p) {
+			p = Car(p)
+		}
+
+		if k := raw(p); isKeyword(k) {
+			flags[k] = IsAtom(Car(params))
+		}
+	}
+
+	values := map[string]Cell{}
+	if len(flags) == 0 {
+		return args, values
+	}
+
+	rest := Null
+	for ; args != Null; args = Cdr(args) {
+		a := Car(args)
+
+		flag, ok := flags[raw(a)]
+		if !IsAtom(a) || !ok {
+			rest = AppendTo(rest, a)
+			continue
+		}
+
+		if flag {
+			values[raw(a)] = True
+			continue
+		}
+
+		if Cdr(args) == Null {
+			panic("error/runtime: expected value after " + raw(a))
+		}
+		args = Cdr(args)
+
+		values[raw(a)] = Car(args)
+	}
+
+	return rest, values
+}
+
+/*
+ * Return the path of the file, in one of the directories listed in
+ * $autoload, that defines the command name, or an empty string if there
+ * is none. Each file is returned only once.
+ */
+func autoload(t *Task, name string) string {
+	r := Resolve(t.Lexical, t.Dynamic, NewSymbol("$autoload"))
+	if r == nil || strings.ContainsRune(name, '/') {
+		return ""
+	}
+
+	autoloaded.Lock()
+	defer autoloaded.Unlock()
+
+	for l := r.Get(); IsCons(l) && l != Null; l = Cdr(l) {
+		path := filepath.Join(raw(Car(l)), name+".oh")
+		if autoloaded.paths[path] {
+			continue
+		}
+
+		if _, err := os.Stat(path); err == nil {
+			autoloaded.paths[path] = true
+			return path
+		}
+	}
+
+	return ""
+}
+
+/* Return the mock, if any, for the external command name. */
+func mocked(t *Task, name string) *Object {
+	r := Resolve(t.Lexical, t.Dynamic, NewSymbol("$mocks"))
+	if r == nil {
+		return nil
+	}
+
+	for l := r.Get(); l != Null; l = Cdr(l) {
+		m := Car(l).(*Object)
+		if raw(m.Access(NewSymbol("name")).Get()) == name {
+			return m
+		}
+	}
+
+	return nil
+}
+
+func module(f string) (string, error) {
+	i, err := os.Stat(f)
+	if err != nil {
+		return "", err
+	}
+
+	m := "$" + i.Name() + "-" + strconv.FormatInt(i.Size(), 10) + "-" +
+		strconv.Itoa(i.ModTime().Second()) + "." +
+		strconv.Itoa(i.ModTime().Nanosecond())
+
+	return m, nil
+}
+
+func number(s string) bool {
+	m, err := regexp.MatchString(`^[0-9]+(\.[0-9]+)?$`, s)
+	return err == nil && m
+}
+
+/*
+ * Open the file named by the second of args with the mode given by the
+ * first and, if the file is created, the permissions, in octal, given by
+ * the third (0666 if there is no third), less the umask. The mode can
+ * contain r, w and a, to read, write and append, and - or x, to not
+ * create the file, or to create it and fail if it already exists.
+ */
+func open(t *Task, args Cell) (Context, error) {
+	mode := raw(Car(args))
+	path := resolvePath(t, raw(Cadr(args)))
+	flags := 0
+
+	if strings.IndexAny(mode, "-") == -1 {
+		flags = os.O_CREATE
+	}
+
+	if strings.IndexAny(mode, "x") != -1 {
+		flags |= os.O_CREATE | os.O_EXCL
+	}
+
+	read := false
+	if strings.IndexAny(mode, "r") != -1 {
+		read = true
+	}
+
+	write := false
+	if strings.IndexAny(mode, "w") != -1 {
+		write = true
+		if strings.IndexAny(mode, "a") == -1 {
+			flags |= os.O_TRUNC
+		}
+	}
+
+	if strings.IndexAny(mode, "a") != -1 {
+		write = true
+		flags |= os.O_APPEND
+	}
+
+	if read == write {
+		read = true
+		write = true
+		flags |= os.O_RDWR
+	} else if write {
+		flags |= os.O_WRONLY
+	}
+
+	if !allowed("write") {
+		if write || flags&os.O_EXCL != 0 {
+			demand("write")
+		}
+
+		flags &^= os.O_CREATE
+	}
+
+	perm := uint64(0666)
+	if Cddr(args) != Null {
+		var err error
+
+		perm, err = strconv.ParseUint(raw(Caddr(args)), 8, 32)
+		if err != nil || perm > 0777 {
+			panic("error/runtime: invalid permissions: " + raw(Caddr(args)))
+		}
+	}
+
+	f, err := t.openFile(path, flags, os.FileMode(perm))
+	if err != nil {
+		return nil, err
+	}
+
+	r := f
+	if !read {
+		r = nil
+	}
+
+	w := f
+	if !write {
+		w = nil
+	}
+
+	return NewPipe(t.Lexical, r, w), nil
+}
+
+/*
+ * Return a less function over the indices of l. Elements are compared
+ * numerically if they are all numbers and lexicographically otherwise.
+ */
+func ordering(l []Cell) func(i, j int) bool {
+	n := make([]*big.Rat, len(l))
+	for i, c := range l {
+		r, ok := new(big.Rat).SetString(raw(c))
+		if !ok {
+			return func(i, j int) bool {
+				return raw(l[i]) < raw(l[j])
+			}
+		}
+		n[i] = r
+	}
+
+	return func(i, j int) bool {
+		return n[i].Cmp(n[j]) < 0
+	}
+}
+
+/*
+ * Match v against the case pattern p, adding (name . value) pairs to the
+ * bindings b. Atoms are globs, except inside a list pattern where symbols
+ * bind the corresponding element ("_" matches without binding) and a
+ * trailing ": name" or "@name" binds the remaining elements. The pattern
+ * (re expr) matches a regular expression, binding any named groups.
+ */
+func pattern(t *Task, p, v, b Cell, top bool) (Cell, bool) {
+	if IsAtom(p) {
+		if _, ok := p.(*Symbol); ok && !top {
+			if raw(p) != "_" {
+				b = Cons(Cons(p, v), b)
+			}
+			return b, true
+		}
+
+		if !IsAtom(v) {
+			return b, false
+		}
+
+		ok, err := path.Match(raw(p), raw(v))
+		if err != nil {
+			ok = raw(p) == raw(v)
+		}
 
-		t.NewBlock(t.Dynamic, t.Lexical)
+		return b, ok
+	}
 
-		t.Code = Car(t.Code)
-		t.Scratch = Cdr(t.Scratch)
+	if p != Null && IsAtom(Car(p)) && raw(Car(p)) == "re" {
+		if !IsAtom(v) {
+			return b, false
+		}
 
-		return true
-	})
-	scope0.DefineSyntax("make-env", func(t *Task, args Cell) bool {
-		t.ReplaceStates(SaveDynamic, psEvalBlock)
+		re, err := regexp.Compile(raw(Cadr(p)))
+		if err != nil {
+			panic(err)
+		}
 
-		t.Dynamic = NewEnv(t.Dynamic)
+		m := re.FindStringSubmatch(raw(v))
+		if m == nil {
+			return b, false
+		}
 
-		return true
-	})
-	scope0.DefineSyntax("make-scope", func(t *Task, args Cell) bool {
-		t.ReplaceStates(SaveLexical, psEvalBlock)
+		for i, name := range re.SubexpNames() {
+			if name != "" {
+				b = Cons(Cons(NewSymbol(name), NewString(t, m[i])), b)
+			}
+		}
 
-		t.Lexical = NewScope(t.Lexical, nil)
+		return b, true
+	}
 
-		return true
-	})
-	scope0.DefineSyntax("set", func(t *Task, args Cell) bool {
-		t.Scratch = Cdr(t.Scratch)
+	if !IsCons(v) {
+		return b, false
+	}
 
-		s := Null
-		if Length(t.Code) == 3 {
-			if raw(Cadr(t.Code)) != "=" {
-				panic("error/syntax: expected '='")
+	for ; p != Null; p = Cdr(p) {
+		e := Car(p)
+		if IsCons(e) && e != Null && raw(Car(e)) == "splice" {
+			if _, ok := Cadr(e).(*Symbol); ok && Cdr(p) == Null {
+				return Cons(Cons(Cadr(e), v), b), true
 			}
-			s = Caddr(t.Code)
-		} else {
-			s = Cadr(t.Code)
 		}
 
-		t.Code = Car(t.Code)
-		if !IsCons(t.Code) {
-			t.ReplaceStates(psExecSet, SaveCode)
-		} else {
-			t.ReplaceStates(SaveDynamic|SaveLexical,
-				psExecSet, SaveCdrCode,
-				psChangeContext, psEvalElement,
-				SaveCarCode)
+		if Cdr(p) == Null && IsCons(e) && e != Null && Cdr(e) == Null {
+			if _, ok := Car(e).(*Symbol); ok {
+				return Cons(Cons(Car(e), v), b), true
+			}
 		}
 
-		t.NewStates(psEvalElement)
-
-		t.Code = s
-		return true
-	})
-	scope0.DefineSyntax("spawn", func(t *Task, args Cell) bool {
-		child := NewTask(t.Code, NewEnv(t.Dynamic),
-			NewScope(t.Lexical, nil), t)
+		if v == Null {
+			return b, false
+		}
 
-		go child.Launch()
+		var ok bool
+		if b, ok = pattern(t, e, Car(v), b, false); !ok {
+			return b, false
+		}
 
-		SetCar(t.Scratch, child)
+		v = Cdr(v)
+	}
 
-		return false
-	})
-	scope0.DefineSyntax("splice", func(t *Task, args Cell) bool {
-		t.ReplaceStates(psExecSplice, psEvalElement)
+	return b, v == Null
+}
 
-		t.Code = Car(t.Code)
-		t.Scratch = Cdr(t.Scratch)
+func raw(c Cell) string {
+	if s, ok := c.(*String); ok {
+		return s.Raw()
+	}
 
-		return true
-	})
-	scope0.DefineSyntax("while", func(t *Task, args Cell) bool {
-		t.ReplaceStates(SaveDynamic|SaveLexical, psExecWhileTest)
+	return c.String()
+}
 
-		return true
-	})
+/* Write the script, formatted, to stdout, if its syntax is valid. */
+func reformat() int {
+	text, ok := checked()
+	if !ok {
+		return 1
+	}
 
-	/* The rest. */
-	bindTheRest(scope0)
+	fmt.Print(Format(text))
 
-	scope0.Public(NewSymbol("$root"), scope0)
+	return 0
+}
 
-	/* Root Environment. */
-	env0 = NewEnv(nil)
+/*
+ * Return $cwd if it is not the process's working directory, as it is not
+ * within with-cwd, and "" otherwise.
+ */
+func relativeTo(t *Task) string {
+	r := Resolve(t.Lexical, t.Dynamic, NewSymbol("$cwd"))
+	if r == nil {
+		return ""
+	}
 
-	env0.Add(NewSymbol("false"), False)
-	env0.Add(NewSymbol("true"), True)
+	cwd := raw(r.Get())
+	if wd, err := os.Getwd(); err == nil && wd == cwd {
+		return ""
+	}
 
-	env0.Add(NewSymbol("$$"), NewInteger(int64(os.Getpid())))
-	env0.Add(NewSymbol("$platform"), NewSymbol(Platform))
-	env0.Add(NewSymbol("$stdin"), NewPipe(scope0, os.Stdin, nil))
-	env0.Add(NewSymbol("$stdout"), NewPipe(scope0, nil, os.Stdout))
-	env0.Add(NewSymbol("$stderr"), NewPipe(scope0, nil, os.Stderr))
+	return cwd
+}
 
-	/* Environment variables. */
-	for _, s := range os.Environ() {
-		kv := strings.SplitN(s, "=", 2)
-		env0.Add(NewSymbol("$"+kv[0]), NewSymbol(kv[1]))
+/* Return name, if it is absolute, or name relative to $cwd. */
+func resolvePath(t *Task, name string) string {
+	if dir := relativeTo(t); dir != "" && !filepath.IsAbs(name) {
+		return filepath.Join(dir, name)
 	}
 
+	return name
 }
 
-func isSimple(c Cell) bool {
-	return IsAtom(c) || IsCons(c)
-}
+/*
+ * Return true if c has a member, that can be called, for each name in the
+ * list names.
+ */
+func respondsTo(c, names Cell) bool {
+	o, ok := c.(Context)
+	if !ok {
+		return false
+	}
 
-func jobControlEnabled() bool {
-	return interactive && JobControlSupported()
+	for ; names != Null; names = Cdr(names) {
+		r := o.Access(NewSymbol(raw(Car(names))))
+		if r == nil {
+			return false
+		}
+
+		if _, ok := r.Get().(Binding); !ok {
+			return false
+		}
+	}
+
+	return true
 }
 
-func module(f string) (string, error) {
-	i, err := os.Stat(f)
-	if err != nil {
-		return "", err
+/* Call $resize, if it is defined, with the new terminal size. */
+func resize() {
+	r := Resolve(scope0, env0, NewSymbol("$resize"))
+	if r == nil {
+		return
 	}
 
-	m := "$" + i.Name() + "-" + strconv.FormatInt(i.Size(), 10) + "-" +
-		strconv.Itoa(i.ModTime().Second()) + "." +
-		strconv.Itoa(i.ModTime().Nanosecond())
+	rows, cols := TerminalSize()
+	c := List(r.Get(), NewInteger(int64(rows)), NewInteger(int64(cols)))
 
-	return m, nil
+	go NewTask(List(c), nil, nil, nil).Launch()
 }
 
-func number(s string) bool {
-	m, err := regexp.MatchString(`^[0-9]+(\.[0-9]+)?$`, s)
-	return err == nil && m
+func rpipe(c Cell) *os.File {
+	return toConduit(c.(Context)).(*Pipe).ReadFd()
+
 }
 
-func raw(c Cell) string {
-	if s, ok := c.(*String); ok {
-		return s.Raw()
+/* Return the text of the script named on the command line, or stdin. */
+func script() (string, error) {
+	if CommandString != "" {
+		return CommandString, nil
 	}
 
-	return c.String()
+	var b []byte
+	var err error
+	if len(os.Args) > 1 {
+		b, err = ioutil.ReadFile(os.Args[1])
+	} else {
+		b, err = ioutil.ReadAll(os.Stdin)
+	}
+
+	return string(b), err
 }
 
-func rpipe(c Cell) *os.File {
-	return toConduit(c.(Context)).(*Pipe).ReadFd()
+/*
+ * Return a function that returns the next element of the sequence s, or
+ * nil when it is exhausted. Elements are read from a conduit only as they
+ * are needed: a line at a time from a pipe or file, and a value at a time
+ * from a channel or timer. The conduit's read end is closed once it has
+ * been read to the end. An integer n is the range from 0 to n, as if
+ * produced by range. Anything else is an error for the command name.
+ */
+func sequence(t *Task, name string, s Cell) func() Cell {
+	if c, ok := s.(Context); ok {
+		switch conduit := asConduit(c).(type) {
+		case nil:
+		case *Channel, *Timer:
+			return func() Cell {
+				v := conduit.Read(t)
+				if v == Null {
+					conduit.ReaderClose()
+					return nil
+				}
+				return Car(v)
+			}
+		default:
+			return func() Cell {
+				v := conduit.ReadLine(t)
+				if v == Null {
+					conduit.ReaderClose()
+					return nil
+				}
+				return v
+			}
+		}
+	}
+
+	if n, ok := count(s); ok {
+		i := int64(0)
+		return func() Cell {
+			if i >= n {
+				return nil
+			}
+			i++
+			return NewInteger(i - 1)
+		}
+	}
+
+	if s != Null && !IsCons(s) {
+		panic("error/runtime: " + name +
+			" expects a list, conduit or range")
+	}
 
+	return func() Cell {
+		if s == Null || !IsCons(s) {
+			return nil
+		}
+		v := Car(s)
+		s = Cdr(s)
+		return v
+	}
 }
 
 func setForegroundTask(t *Task) {
 	if t.Job.Group != 0 {
 		SetForegroundGroup(t.Job.Group)
-		t.Job.mode.ApplyMode()
+		if t.Job.mode != nil {
+			t.Job.mode.ApplyMode()
+		}
 	}
 	task0, t = t, task0
 	t.Stop()
 	task0.Continue()
 }
 
+/* Return the integer and the shift count in args, for the command name. */
+func shift(name string, args Cell) (*big.Int, uint) {
+	if args == Null || Cdr(args) == Null || Cddr(args) != Null {
+		panic("error/runtime: " + name + " expects an integer and a count")
+	}
+
+	i := integer(name, Car(args))
+
+	n := integer(name, Cadr(args))
+	if n.Sign() < 0 {
+		panic("error/runtime: negative shift count")
+	} else if !n.IsUint64() || n.Uint64() > maxShift {
+		panic("error/runtime: shift count too large")
+	}
+
+	return i, uint(n.Uint64())
+}
+
+/*
+ * Return the names of the members in envs, sorted by name, or if values
+ * is true, a list of (name value) pairs.
+ */
+func slots(values bool, envs ...*Env) Cell {
+	names := []string{}
+	for _, e := range envs {
+		names = append(names, e.Names()...)
+	}
+
+	sort.Strings(names)
+
+	l := []Cell{}
+	for _, name := range names {
+		k := NewSymbol(name)
+		if !values {
+			l = append(l, k)
+			continue
+		}
+
+		for _, e := range envs {
+			if r := e.Access(k); r != nil {
+				l = append(l, List(k, r.Get()))
+				break
+			}
+		}
+	}
+
+	return List(l...)
+}
+
+/* Return a list of the elements of l in the order given by less. */
+func sorted(l []Cell, less func(i, j int) bool) Cell {
+	idx := make([]int, len(l))
+	for i := range idx {
+		idx[i] = i
+	}
+
+	sort.SliceStable(idx, func(i, j int) bool {
+		return less(idx[i], idx[j])
+	})
+
+	r := Null
+	for i := len(idx) - 1; i >= 0; i-- {
+		r = Cons(l[idx[i]], r)
+	}
+
+	return r
+}
+
+/*
+ * Split s into words at the characters in ifs, as the shell splits fields.
+ * Runs of space, tab and newline in ifs separate words and are ignored at
+ * the start and end of s. Each other character in ifs ends a word, so two
+ * together have an empty word between them. If ifs is empty, s is not split.
+ */
+func splitWords(s, ifs string) []string {
+	if ifs == "" {
+		if s == "" {
+			return nil
+		}
+		return []string{s}
+	}
+
+	separator := func(r rune) bool {
+		return strings.ContainsRune(ifs, r)
+	}
+	space := func(r rune) bool {
+		return separator(r) && strings.ContainsRune(" \t\n", r)
+	}
+
+	words := []string{}
+	for s = strings.TrimFunc(s, space); s != ""; {
+		i := strings.IndexFunc(s, separator)
+		if i < 0 {
+			words = append(words, s)
+			break
+		}
+		words = append(words, s[:i])
+
+		s = strings.TrimLeftFunc(s[i:], space)
+		if r, n := utf8.DecodeRuneInString(s); separator(r) && !space(r) {
+			s = strings.TrimLeftFunc(s[n:], space)
+		}
+	}
+
+	return words
+}
+
+/* Source the startup file at path, if it exists. */
+func startup(eval func(Cell), path string) {
+	if path == "" {
+		return
+	}
+
+	if _, err := os.Stat(path); err == nil {
+		eval(List(NewSymbol("source"), NewSymbol(path)))
+	}
+}
+
 func status(c Cell) int {
 	a, ok := c.(Atom)
 	if !ok {
@@ -703,6 +2452,24 @@ func status(c Cell) int {
 	return int(a.Status())
 }
 
+/* Exit with the status passed to exit, if the foreground task was stopped. */
+func stopped() {
+	if task0.Stack == Null {
+		os.Exit(status(Car(task0.Scratch)))
+	}
+}
+
+/* Return the current terminal mode, or nil if there is no line editor. */
+func terminalMode() common.TerminalMode {
+	if editor == nil || !editor.Exists() {
+		return nil
+	}
+
+	mode, _ := editor.TerminalMode()
+
+	return mode
+}
+
 /* Convert Context into a Conduit. */
 func toConduit(o Context) Conduit {
 	conduit := asConduit(o)
@@ -726,6 +2493,128 @@ func wpipe(c Cell) *os.File {
 	return toConduit(c.(Context)).(*Pipe).WriteFd()
 }
 
+/*
+ * Return the commands for with-cwd: a dynamic $cwd set to the directory
+ * path, made absolute relative to the enclosing $cwd, then body.
+ */
+func withCwd(path, body Cell) Cell {
+	dir := NewMethod(func(t *Task, args Cell) bool {
+		name := raw(Car(args))
+		if !filepath.IsAbs(name) {
+			cwd := Resolve(t.Lexical, t.Dynamic, NewSymbol("$cwd"))
+			name = filepath.Join(raw(cwd.Get()), name)
+		}
+
+		if i, err := os.Stat(name); err != nil || !i.IsDir() {
+			panic("error/runtime: with-cwd: not a directory: " + raw(Car(args)))
+		}
+
+		return t.Return(NewSymbol(filepath.Clean(name)))
+	}, Null, Null, Null, scope0)
+
+	cwd := List(NewSymbol("dynamic"), NewSymbol("$cwd"),
+		List(NewBound(dir, scope0), path))
+
+	return Cons(cwd, body)
+}
+
+/*
+ * Return the commands for with-env: a setenv for each (name value) pair
+ * in vars, then body, with the environment variables restored to their
+ * previous values when body finishes or fails.
+ */
+func withEnv(vars, body Cell) Cell {
+	saved := map[string]*string{}
+	set := []Cell{}
+	for ; vars != Null; vars = Cdr(vars) {
+		v := Car(vars)
+
+		name := strings.TrimLeft(raw(Car(v)), "$")
+		if value, ok := os.LookupEnv(name); ok {
+			saved[name] = &value
+		} else {
+			saved[name] = nil
+		}
+
+		k := NewSymbol("$" + environmentName(name))
+		set = append(set, List(NewSymbol("setenv"), k, Cadr(v)))
+	}
+
+	restore := NewMethod(func(t *Task, args Cell) bool {
+		for name, value := range saved {
+			if value == nil {
+				os.Unsetenv(name)
+			} else {
+				os.Setenv(name, *value)
+			}
+		}
+
+		return t.Return(True)
+	}, Null, Null, Null, scope0)
+
+	protect := List(NewSymbol("unwind-protect"),
+		Cons(NewSymbol("block"), body),
+		List(NewBound(restore, scope0)))
+
+	return List(append(set, protect)...)
+}
+
+/*
+ * Return the commands for with-open: a definition of the first element of
+ * spec as the file opened with the rest, then body, after which, even if
+ * it fails, the file is closed. Unlike open, a failure to open is raised.
+ */
+func withOpen(spec, body Cell) Cell {
+	var f Context
+
+	opener := NewMethod(func(t *Task, args Cell) bool {
+		var err error
+		if f, err = open(t, args); err != nil {
+			panic("error/runtime: " + err.Error())
+		}
+
+		return t.Return(f)
+	}, Null, Null, Null, scope0)
+
+	closer := NewMethod(func(t *Task, args Cell) bool {
+		toConduit(f).Close()
+
+		return t.Return(True)
+	}, Null, Null, Null, scope0)
+
+	define := List(NewSymbol("define"), Car(spec),
+		Cons(NewBound(opener, scope0), Cdr(spec)))
+
+	protect := List(NewSymbol("unwind-protect"),
+		Cons(NewSymbol("block"), body),
+		List(NewBound(closer, scope0)))
+
+	return List(define, protect)
+}
+
+/*
+ * Return the lists formed by taking the nth element of each of the lists
+ * in l, stopping at the end of the shortest list.
+ */
+func zip(l []Cell) []Cell {
+	r := []Cell{}
+	if len(l) == 0 {
+		return r
+	}
+
+	for {
+		tuple := make([]Cell, len(l))
+		for i, c := range l {
+			if c == Null {
+				return r
+			}
+			tuple[i] = Car(c)
+			l[i] = Cdr(c)
+		}
+		r = append(r, List(tuple...))
+	}
+}
+
 func ForegroundTask() *Task {
 	return task0
 }
@@ -740,8 +2629,7 @@ func IsContext(c Cell) bool {
 
 func LaunchForegroundTask() {
 	if task0 != nil {
-		mode, _ := liner.TerminalMode()
-		task0.Job.mode = mode
+		task0.Job.mode = terminalMode()
 	}
 	task0 = NewTask(Cons(nil, Null), nil, nil, nil)
 	go task0.Listen()
@@ -765,7 +2653,9 @@ func Resolve(s Context, e *Env, k *Symbol) (v Reference) {
 	return v
 }
 
-func Start(parser reader, cli ui) {
+func Start(parser reader, cli common.LineEditor) {
+	editor = cli
+
 	LaunchForegroundTask()
 
 	parse = parser
@@ -777,6 +2667,10 @@ func Start(parser reader, cli ui) {
 	b := bufio.NewReader(strings.NewReader(boot.Script))
 	parse(nil, b, deref, eval)
 
+	/* The boot script's commands are not the user's. */
+	env0.Add(NewSymbol("$?"), NewStatus(0))
+	env0.Add(NewSymbol("$last-command"), NewString(task0, ""))
+
 	/* Command-line arguments */
 	args := Null
 	origin := ""
@@ -805,9 +2699,38 @@ func Start(parser reader, cli ui) {
 		env0.Add(NewSymbol("$origin"), NewSymbol(origin))
 	}
 
+	if ParseOnly {
+		os.Exit(check())
+	}
+
+	if FormatOnly {
+		os.Exit(reformat())
+	}
+
+	if BundleOutput != "" {
+		os.Exit(bundle())
+	}
+
+	/* A login shell is started with a name that begins with a dash. */
+	if (Login || strings.HasPrefix(os.Args[0], "-")) && !NoProfile {
+		startup(eval, home(".oh_profile"))
+	}
+
 	interactive = false
-	if len(os.Args) > 1 {
+	if Control != "" {
+		os.Exit(control(eval, Control))
+	} else if CommandString != "" {
+		b := bufio.NewReader(strings.NewReader(CommandString + "\n"))
+		parse(nil, b, deref, func(c Cell) {
+			eval(c)
+
+			stopped()
+		})
+
+		os.Exit(status(task0.result))
+	} else if len(os.Args) > 1 {
 		eval(List(NewSymbol("source"), NewSymbol(os.Args[1])))
+		stopped()
 	} else if cli.Exists() {
 		interactive = true
 
@@ -815,12 +2738,18 @@ func Start(parser reader, cli ui) {
 
 		pgid = BecomeProcessGroupLeader()
 
+		if !NoRC {
+			startup(eval, "/etc/oh/ohrc")
+			startup(eval, home(".ohrc"))
+		}
+
 		parse(nil, cli, deref, evaluate)
 
 		cli.Close()
 		fmt.Printf("\n")
 	} else {
 		eval(List(NewSymbol("source"), NewSymbol("/dev/stdin")))
+		stopped()
 	}
 
 	os.Exit(0)
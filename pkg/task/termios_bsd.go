@@ -0,0 +1,14 @@
+// Released under an MIT-style license. See LICENSE.
+
+// +build darwin dragonfly freebsd netbsd openbsd
+
+package task
+
+import (
+	"syscall"
+)
+
+const (
+	getTermios = syscall.TIOCGETA
+	setTermios = syscall.TIOCSETA
+)
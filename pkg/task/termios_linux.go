@@ -0,0 +1,12 @@
+// Released under an MIT-style license. See LICENSE.
+
+package task
+
+import (
+	"syscall"
+)
+
+const (
+	getTermios = syscall.TCGETS
+	setTermios = syscall.TCSETS
+)
@@ -0,0 +1,21 @@
+// Released under an MIT-style license. See LICENSE.
+
+// +build !linux,!darwin,!dragonfly,!freebsd,!netbsd,!openbsd
+
+package task
+
+import (
+	"errors"
+)
+
+func QuietTerminal(fd uintptr) (func() error, error) {
+	return nil, errors.New("Not implemented")
+}
+
+func RawTerminal(fd uintptr) (func() error, error) {
+	return nil, errors.New("Not implemented")
+}
+
+func TerminalWidth(fd uintptr) int {
+	return 0
+}
@@ -0,0 +1,75 @@
+// Released under an MIT-style license. See LICENSE.
+
+// +build linux darwin dragonfly freebsd netbsd openbsd
+
+package task
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+/*
+ * Put the terminal fd into raw mode, so that each key is read as it is
+ * pressed, without being echoed, and return a function that restores it.
+ */
+func RawTerminal(fd uintptr) (func() error, error) {
+	return changeTerminal(fd, func(t *syscall.Termios) {
+		t.Iflag &^= syscall.ICRNL | syscall.IXON
+		t.Lflag &^= syscall.ECHO | syscall.ICANON | syscall.IEXTEN | syscall.ISIG
+		t.Cc[syscall.VMIN] = 1
+		t.Cc[syscall.VTIME] = 0
+	})
+}
+
+/*
+ * Stop the terminal fd from echoing what is typed, and return a function
+ * that restores it. Lines can still be edited, and interrupts sent.
+ */
+func QuietTerminal(fd uintptr) (func() error, error) {
+	return changeTerminal(fd, func(t *syscall.Termios) {
+		t.Lflag &^= syscall.ECHO
+	})
+}
+
+/* Return the width of the terminal fd, or 0 if it is not known. */
+func TerminalWidth(fd uintptr) int {
+	ws, ok := winsize(fd)
+	if !ok {
+		return 0
+	}
+
+	return int(ws.Col)
+}
+
+/*
+ * Change the mode of the terminal fd, and return a function that restores
+ * it.
+ */
+func changeTerminal(fd uintptr, change func(*syscall.Termios)) (func() error, error) {
+	var saved syscall.Termios
+	if err := termios(fd, getTermios, &saved); err != nil {
+		return nil, err
+	}
+
+	t := saved
+	change(&t)
+
+	if err := termios(fd, setTermios, &t); err != nil {
+		return nil, err
+	}
+
+	return func() error {
+		return termios(fd, setTermios, &saved)
+	}, nil
+}
+
+func termios(fd, request uintptr, t *syscall.Termios) error {
+	_, _, err := syscall.Syscall(syscall.SYS_IOCTL, fd,
+		request, uintptr(unsafe.Pointer(t)))
+	if err != 0 {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,168 @@
+// Released under an MIT-style license. See LICENSE.
+
+package task
+
+import (
+	"fmt"
+	. "github.com/michaelmacinnis/oh/pkg/cell"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+ * Tests are written with describe, which groups tests, and it, which runs
+ * a single test in a child task so that it cannot affect the tests that
+ * follow. A test fails if evaluating it raises an error, for example,
+ * from assert-equal or assert-status. Results are written as TAP or, if
+ * $test-format is go, in the style of go test. The run-tests method
+ * sources each *_test.oh file below the directories given and reports
+ * the totals.
+ */
+
+var tests struct {
+	sync.Mutex
+	count  int
+	failed int
+}
+
+/* Report the result of the test named by names. */
+func report(t *Task, names []string, failure interface{}, elapsed time.Duration) {
+	tests.Lock()
+	tests.count++
+	n := tests.count
+	if failure != nil {
+		tests.failed++
+	}
+	tests.Unlock()
+
+	lines := []string{}
+	if testFormat(t) == "go" {
+		name := strings.Join(names, "/")
+		result := "PASS"
+		if failure != nil {
+			result = "FAIL"
+		}
+
+		lines = append(lines, "=== RUN   "+name, fmt.Sprintf(
+			"--- %s: %s (%.2fs)", result, name, elapsed.Seconds()))
+		if failure != nil {
+			lines = append(lines, fmt.Sprintf("    %v", failure))
+		}
+	} else {
+		result := "ok"
+		if failure != nil {
+			result = "not ok"
+		}
+
+		name := strings.Join(names, " ")
+		lines = append(lines, fmt.Sprintf("%s %d - %s", result, n, name))
+		if failure != nil {
+			lines = append(lines, fmt.Sprintf("# %v", failure))
+		}
+	}
+
+	writeLines(t, lines...)
+}
+
+/*
+ * Run the commands in body in a child task, with names as the names of
+ * the enclosing describe blocks, and return the child's failure, if any.
+ */
+func runChild(t *Task, names, body Cell) interface{} {
+	d := NewEnv(t.Dynamic)
+	d.Add(NewSymbol("$describe"), names)
+
+	child := NewTask(body, d, NewScope(t.Lexical, nil), t)
+	child.capture = true
+
+	go child.Launch()
+	<-child.Done
+
+	delete(t.children, child)
+
+	return child.failure
+}
+
+/* Return the names of the enclosing describe blocks, innermost first. */
+func describing(t *Task) Cell {
+	if r := t.Dynamic.Access(NewSymbol("$describe")); r != nil {
+		return r.Get()
+	}
+
+	return Null
+}
+
+func runTests(t *Task, dirs []string) Cell {
+	tests.Lock()
+	tests.count, tests.failed = 0, 0
+	tests.Unlock()
+
+	files := []string{}
+	for _, dir := range dirs {
+		filepath.Walk(dir, func(p string, i os.FileInfo, err error) error {
+			if err == nil && !i.IsDir() &&
+				strings.HasSuffix(p, "_test.oh") {
+				files = append(files, p)
+			}
+			return nil
+		})
+	}
+
+	for _, f := range files {
+		start := now()
+		cmd := List(List(NewSymbol("source"), NewSymbol(f)))
+		if failure := runChild(t, describing(t), cmd); failure != nil {
+			report(t, []string{f}, failure, since(start))
+		}
+	}
+
+	tests.Lock()
+	count, failed := tests.count, tests.failed
+	tests.Unlock()
+
+	if testFormat(t) == "go" {
+		result := "PASS"
+		if failed > 0 {
+			result = "FAIL"
+		}
+		writeLines(t, result)
+	} else {
+		writeLines(t, fmt.Sprintf("1..%d", count))
+	}
+
+	if failed > 0 {
+		return NewStatus(1)
+	}
+
+	return NewStatus(0)
+}
+
+func testFormat(t *Task) string {
+	if r := Resolve(t.Lexical, t.Dynamic, NewSymbol("$test-format")); r != nil {
+		return raw(r.Get())
+	}
+
+	return "tap"
+}
+
+/* Return the test names in l, outermost first. */
+func testNames(l Cell) []string {
+	names := []string{}
+	for ; l != Null; l = Cdr(l) {
+		names = append([]string{raw(Car(l))}, names...)
+	}
+
+	return names
+}
+
+func writeLines(t *Task, lines ...string) {
+	out := Resolve(t.Lexical, t.Dynamic, NewSymbol("$stdout")).Get()
+	c := toConduit(out.(Context))
+
+	for _, line := range lines {
+		c.Write(List(NewSymbol(line)))
+	}
+}
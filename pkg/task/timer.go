@@ -0,0 +1,120 @@
+// Released under an MIT-style license. See LICENSE.
+
+package task
+
+import (
+	. "github.com/michaelmacinnis/oh/pkg/cell"
+	"strconv"
+	"sync"
+	"time"
+)
+
+/*
+ * A timer is a conduit that can be read once, when its duration has
+ * elapsed, and a ticker is a conduit that can be read each time its
+ * duration elapses. Reading yields the time, in seconds since the epoch,
+ * at which the deadline was reached. After a timer has been read, or a
+ * timer or ticker has been closed, reading yields an empty list.
+ */
+
+/* Timer cell definition. */
+
+type Timer struct {
+	*Scope
+	c      <-chan time.Time
+	closed chan bool
+	once   sync.Once
+	repeat bool
+	stop   func()
+}
+
+func NewTimer(t *Task, d time.Duration, repeat bool) *Timer {
+	tm := &Timer{
+		Scope:  NewScope(t.Lexical.Expose(), conduitEnv()),
+		closed: make(chan bool),
+		repeat: repeat,
+	}
+
+	if repeat {
+		ticker := time.NewTicker(d)
+		tm.c, tm.stop = ticker.C, ticker.Stop
+	} else {
+		timer := time.NewTimer(d)
+		tm.c, tm.stop = timer.C, func() { timer.Stop() }
+	}
+
+	return tm
+}
+
+func (tm *Timer) Equal(c Cell) bool {
+	return tm == c
+}
+
+func (tm *Timer) String() string {
+	if tm.repeat {
+		return identify("ticker", tm)
+	}
+
+	return identify("timer", tm)
+}
+
+func (tm *Timer) Close() {
+	tm.once.Do(func() {
+		tm.stop()
+		close(tm.closed)
+	})
+}
+
+func (tm *Timer) Expose() Context {
+	return tm
+}
+
+func (tm *Timer) ReaderClose() {
+	tm.Close()
+}
+
+func (tm *Timer) Read(t *Task) Cell {
+	select {
+	case v := <-tm.c:
+		if !tm.repeat {
+			tm.Close()
+		}
+		return List(NewFloat(float64(v.UnixNano()) / 1e9))
+	case <-tm.closed:
+		return Null
+	}
+}
+
+func (tm *Timer) ReadLine(t *Task) Cell {
+	v := tm.Read(t)
+	if v == Null {
+		return Null
+	}
+
+	return NewString(t, Car(v).String())
+}
+
+func (tm *Timer) WriterClose() {
+}
+
+func (tm *Timer) Write(c Cell) {
+	panic("error/runtime: cannot write to a timer")
+}
+
+/*
+ * Return the duration given by c, either as a number of seconds or in the
+ * form accepted by time.ParseDuration, for example, 1m30s.
+ */
+func duration(c Cell) time.Duration {
+	s := raw(c)
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.Duration(f * float64(time.Second))
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		panic("error/runtime: invalid duration: " + s)
+	}
+
+	return d
+}
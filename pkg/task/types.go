@@ -7,13 +7,19 @@ import (
 	"fmt"
 	"github.com/michaelmacinnis/adapted"
 	. "github.com/michaelmacinnis/oh/pkg/cell"
-	"github.com/peterh/liner"
+	"github.com/michaelmacinnis/oh/pkg/common"
+	"github.com/rivo/uniseg"
+	"golang.org/x/text/unicode/norm"
 	"math/big"
 	"os"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 )
 
 type Binding interface {
@@ -47,6 +53,21 @@ type Conduit interface {
 	Write(c Cell)
 }
 
+/*
+ * The ends of channels and pipes are reference counted. Creating one
+ * holds each of its ends, as does starting a task with it bound to $stdin
+ * (the read end), $stdout or $stderr (the write end). Closing an end, or
+ * the task finishing, releases the hold, and the end is closed when the
+ * last is released. So a pipe connecting two commands is closed as soon
+ * as the tasks that use it are done, even if they fail, rather than when
+ * it is garbage collected.
+ */
+type Shared interface {
+	Conduit
+
+	Hold(write bool)
+}
+
 type Context interface {
 	Cell
 
@@ -72,6 +93,7 @@ type Function func(t *Task, args Cell) bool
 var (
 	envc *Env
 	envs *Env
+	envt *Env
 	str  = map[string]*String{}
 )
 
@@ -101,6 +123,26 @@ func conduitEnv() *Env {
 	envc.Method("read", func(t *Task, args Cell) bool {
 		return t.Return(toConduit(t.Self()).Read(t))
 	})
+	envc.Method("read-all", func(t *Task, args Cell) bool {
+		c := toConduit(t.Self())
+
+		l := []Cell{}
+		for v := c.Read(t); v != Null; v = c.Read(t) {
+			l = append(l, v)
+		}
+
+		return t.Return(List(l...))
+	})
+	envc.Method("read-lines", func(t *Task, args Cell) bool {
+		c := toConduit(t.Self())
+
+		l := []Cell{}
+		for v := c.ReadLine(t); v != Null && v != False; v = c.ReadLine(t) {
+			l = append(l, v)
+		}
+
+		return t.Return(List(l...))
+	})
 	envc.Method("readline", func(t *Task, args Cell) bool {
 		return t.Return(toConduit(t.Self()).ReadLine(t))
 	})
@@ -129,9 +171,34 @@ func stringEnv() *Env {
 	envs.Method("clone", func(t *Task, args Cell) bool {
 		panic("strings cannot be cloned")
 	})
+	envs.Method("decode", func(t *Task, args Cell) bool {
+		s := decode([]byte(raw(toString(t.Self()))), raw(Car(args)))
+
+		return t.Return(NewString(t, s))
+	})
 	envs.Method("define", func(t *Task, args Cell) bool {
 		panic("private members cannot be added to a string")
 	})
+	envs.Method("display-width", func(t *Task, args Cell) bool {
+		s := escapes.ReplaceAllString(raw(toString(t.Self())), "")
+
+		return t.Return(NewInteger(int64(uniseg.StringWidth(s))))
+	})
+	envs.Method("encode", func(t *Task, args Cell) bool {
+		b := encode(raw(toString(t.Self())), raw(Car(args)))
+
+		return t.Return(NewBuffer(t, b))
+	})
+	envs.Method("graphemes", func(t *Task, args Cell) bool {
+		l := Null
+
+		g := uniseg.NewGraphemes(raw(toString(t.Self())))
+		for g.Next() {
+			l = Cons(NewString(t, g.Str()), l)
+		}
+
+		return t.Return(Reverse(l))
+	})
 	envs.Method("join", func(t *Task, args Cell) bool {
 		sep := toString(t.Self())
 		arr := make([]string, Length(args))
@@ -145,6 +212,26 @@ func stringEnv() *Env {
 
 		return t.Return(NewString(t, r))
 	})
+	envs.Method("normalize", func(t *Task, args Cell) bool {
+		form := "NFC"
+		if args != Null {
+			form = strings.ToUpper(raw(Car(args)))
+		}
+
+		f, ok := map[string]norm.Form{
+			"NFC":  norm.NFC,
+			"NFD":  norm.NFD,
+			"NFKC": norm.NFKC,
+			"NFKD": norm.NFKD,
+		}[form]
+		if !ok {
+			panic("error/runtime: unknown normalization form: " + form)
+		}
+
+		s := f.String(raw(toString(t.Self())))
+
+		return t.Return(NewString(t, s))
+	})
 	envs.Method("split", func(t *Task, args Cell) bool {
 		r := Null
 
@@ -182,6 +269,11 @@ func stringEnv() *Env {
 
 		return t.Return(NewString(t, s))
 	})
+	envs.Method("strip-ansi", func(t *Task, args Cell) bool {
+		s := raw(toString(t.Self()))
+
+		return t.Return(NewString(t, escapes.ReplaceAllString(s, "")))
+	})
 	envs.Method("substring", func(t *Task, args Cell) bool {
 		s := []rune(raw(toString(t.Self())))
 
@@ -210,6 +302,59 @@ created:
 	return envs
 }
 
+func taskEnv() *Env {
+	if envt != nil {
+		goto created
+	}
+
+	envt = NewEnv(nil)
+	envt.Method("child", func(t *Task, args Cell) bool {
+		panic("tasks cannot be parents")
+	})
+	envt.Method("clone", func(t *Task, args Cell) bool {
+		panic("tasks cannot be cloned")
+	})
+	envt.Method("define", func(t *Task, args Cell) bool {
+		panic("private members cannot be added to a task")
+	})
+	envt.Method("cancel", func(t *Task, args Cell) bool {
+		t.Self().(*Task).Cancel()
+		return t.Return(True)
+	})
+	envt.Method("done?", func(t *Task, args Cell) bool {
+		select {
+		case <-t.Self().(*Task).Done:
+			return t.Return(True)
+		default:
+			return t.Return(False)
+		}
+	})
+	envt.Method("result", func(t *Task, args Cell) bool {
+		task := t.Self().(*Task)
+		<-task.Done
+		return t.Return(Car(task.Scratch))
+	})
+	envt.Method("then", func(t *Task, args Cell) bool {
+		task := t.Self().(*Task)
+		child := NewTask(nil, NewEnv(t.Dynamic),
+			NewScope(t.Lexical, nil), t)
+
+		go func() {
+			<-task.Done
+
+			v := List(NewSymbol("quote"), Car(task.Scratch))
+			child.Code = List(List(Car(args), v))
+
+			child.Launch()
+		}()
+
+		return t.Return(child)
+	})
+
+created:
+	return envt
+}
+
 /* Bound cell definition. */
 
 type Bound struct {
@@ -233,7 +378,7 @@ func (b *Bound) Equal(c Cell) bool {
 }
 
 func (b *Bound) String() string {
-	return fmt.Sprintf("%%bound %p%%", b)
+	return identify("bound", b)
 }
 
 /* Bound-specific functions */
@@ -283,14 +428,15 @@ func (b *Builtin) Equal(c Cell) bool {
 }
 
 func (b *Builtin) String() string {
-	return fmt.Sprintf("%%builtin %p%%", b)
+	return identify("builtin", b)
 }
 
 /* Channel cell definition. */
 
 type Channel struct {
 	*Scope
-	v chan Cell
+	v       chan Cell
+	writers int32
 }
 
 func IsChannel(c Cell) bool {
@@ -315,11 +461,12 @@ func NewChannel(t *Task, cap int) Context {
 	return &Channel{
 		NewScope(t.Lexical.Expose(), conduitEnv()),
 		make(chan Cell, cap),
+		1,
 	}
 }
 
 func (ch *Channel) String() string {
-	return fmt.Sprintf("%%channel %p%%", ch)
+	return identify("channel", ch)
 }
 
 func (ch *Channel) Equal(c Cell) bool {
@@ -355,13 +502,23 @@ func (ch *Channel) ReadLine(t *Task) Cell {
 }
 
 func (ch *Channel) WriterClose() {
-	close(ch.v)
+	if atomic.AddInt32(&ch.writers, -1) == 0 {
+		close(ch.v)
+	}
 }
 
 func (ch *Channel) Write(c Cell) {
 	ch.v <- c
 }
 
+/* Channel-specific functions. */
+
+func (ch *Channel) Hold(write bool) {
+	if write {
+		atomic.AddInt32(&ch.writers, 1)
+	}
+}
+
 /* Command cell definition. */
 
 type Command struct {
@@ -401,6 +558,9 @@ func (c *Command) Scope() Context {
 type Continuation struct {
 	Scratch Cell
 	Stack   Cell
+
+	/* The stack at the innermost protected region, or nil if none. */
+	protect Cell
 }
 
 func IsContinuation(c Cell) bool {
@@ -424,18 +584,23 @@ func (ct *Continuation) Equal(c Cell) bool {
 }
 
 func (ct *Continuation) String() string {
-	return fmt.Sprintf("%%continuation %p%%", ct)
+	return identify("continuation", ct)
 }
 
 /* Env cell definition. */
 
+/*
+ * Tasks started with spawn share the envs of the task that started them,
+ * so access to an env's variables is guarded by a read-write lock.
+ */
 type Env struct {
+	sync.RWMutex
 	hash map[string]Reference
 	prev *Env
 }
 
 func NewEnv(prev *Env) *Env {
-	return &Env{make(map[string]Reference), prev}
+	return &Env{hash: make(map[string]Reference), prev: prev}
 }
 
 func (e *Env) Bool() bool {
@@ -447,14 +612,15 @@ func (e *Env) Equal(c Cell) bool {
 }
 
 func (e *Env) String() string {
-	return fmt.Sprintf("%%env %p%%", e)
+	return identify("env", e)
 }
 
 /* Env-specific functions */
 
 func (e *Env) Access(key Cell) Reference {
+	k := key.String()
 	for env := e; env != nil; env = env.prev {
-		if value, ok := env.hash[key.String()]; ok {
+		if value, ok := env.get(k); ok {
 			return value
 		}
 	}
@@ -463,13 +629,20 @@ func (e *Env) Access(key Cell) Reference {
 }
 
 func (e *Env) Add(key Cell, value Cell) {
+	e.Lock()
+	defer e.Unlock()
+
+	constant(e.hash, key.String())
+
 	e.hash[key.String()] = NewVariable(value)
+
+	optionsChanged(key)
 }
 
 func (e *Env) Complete(word string) []string {
 	cl := []string{}
 
-	for k := range e.hash {
+	for _, k := range e.Names() {
 		if strings.HasPrefix(k, word) {
 			cl = append(cl, k)
 		}
@@ -489,6 +662,9 @@ func (e *Env) Copy() *Env {
 
 	fresh := NewEnv(e.prev.Copy())
 
+	e.RLock()
+	defer e.RUnlock()
+
 	for k, v := range e.hash {
 		fresh.hash[k] = v.Copy()
 	}
@@ -496,35 +672,253 @@ func (e *Env) Copy() *Env {
 	return fresh
 }
 
+/*
+ * Make the variable key constant in the first env, starting with this
+ * one, in which it is defined. Returns false if it is not defined.
+ */
+func (e *Env) Freeze(key Cell) bool {
+	k := key.String()
+	for env := e; env != nil; env = env.prev {
+		env.Lock()
+		r, ok := env.hash[k]
+		if _, c := r.(*Constant); ok && !c {
+			env.hash[k] = NewConstant(r.Get())
+		}
+		env.Unlock()
+
+		if ok {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (e *Env) Method(name string, m Function) {
+	e.Lock()
+	defer e.Unlock()
+
 	e.hash[name] =
 		NewConstant(NewBound(NewMethod(m, Null, Null, Null, nil), nil))
 }
 
+/* Returns the sorted names of the variables added to this env. */
+func (e *Env) Names() []string {
+	e.RLock()
+
+	names := make([]string, 0, len(e.hash))
+	for k := range e.hash {
+		names = append(names, k)
+	}
+
+	e.RUnlock()
+
+	sort.Strings(names)
+
+	return names
+}
+
 func (e *Env) Prev() *Env {
 	return e.prev
 }
 
 func (e *Env) Remove(key Cell) bool {
+	e.Lock()
+	defer e.Unlock()
+
 	_, ok := e.hash[key.String()]
 
+	constant(e.hash, key.String())
+
 	delete(e.hash, key.String())
 
+	optionsChanged(key)
+
 	return ok
 }
 
+func (e *Env) get(k string) (Reference, bool) {
+	e.RLock()
+	defer e.RUnlock()
+
+	value, ok := e.hash[k]
+
+	return value, ok
+}
+
+/* Panic if the variable k in hash is constant. */
+func constant(hash map[string]Reference, k string) {
+	if _, ok := hash[k].(*Constant); ok {
+		panic("error/runtime: '" + k + "' is constant")
+	}
+}
+
+/* Iterator cell definition. */
+
+type Iterator struct {
+	Acc     Cell
+	collect func(it *Iterator, item, v Cell)
+	f       Binding
+	fold    bool
+	index   bool
+	item    Cell
+	n       int64
+	next    func() Cell
+	l       Cell
+	tail    Cell
+}
+
+func NewIterator(t *Task, name string, f Binding, s Cell, fold bool,
+	collect func(it *Iterator, item, v Cell)) *Iterator {
+	/*
+	 * The method is passed the index of each element only if it has
+	 * room for it after the element (and, for a fold, the accumulator).
+	 */
+	n := 0
+	for p := f.Ref().Params(); p != Null && IsAtom(Car(p)); p = Cdr(p) {
+		n++
+	}
+	if fold {
+		n--
+	}
+
+	l := Cons(Null, Null)
+
+	return &Iterator{
+		collect: collect,
+		f:       f,
+		fold:    fold,
+		index:   n > 1,
+		next:    sequence(t, name, s),
+		l:       l,
+		tail:    l,
+	}
+}
+
+func (it *Iterator) Bool() bool {
+	return true
+}
+
+func (it *Iterator) Equal(c Cell) bool {
+	return it == c
+}
+
+func (it *Iterator) String() string {
+	return identify("iterator", it)
+}
+
+/* Iterator-specific functions. */
+
+func (it *Iterator) Append(v Cell) {
+	SetCdr(it.tail, Cons(v, Null))
+	it.tail = Cdr(it.tail)
+}
+
+/*
+ * Next hands the result of the last call to the iterator's collect
+ * function and returns the arguments for the next call, or nil when the
+ * sequence is exhausted.
+ */
+func (it *Iterator) Next(v Cell) Cell {
+	if it.item != nil {
+		it.collect(it, it.item, v)
+	}
+
+	it.item = it.next()
+	if it.item == nil {
+		return nil
+	}
+
+	args := List(it.item)
+	if it.fold {
+		args = Cons(it.Acc, args)
+	}
+	if it.index {
+		args = AppendTo(args, NewInteger(it.n))
+	}
+	it.n++
+
+	return args
+}
+
+func (it *Iterator) Result() Cell {
+	if it.fold {
+		return it.Acc
+	}
+
+	return Cdr(it.l)
+}
+
 /* Job definition. */
 
 type Job struct {
 	*sync.Mutex
 	Command string
 	Group   int
-	mode    liner.ModeApplier
+	mode    common.TerminalMode
 }
 
 func NewJob() *Job {
-	mode, _ := liner.TerminalMode()
-	return &Job{&sync.Mutex{}, "", 0, mode}
+	return &Job{&sync.Mutex{}, "", 0, terminalMode()}
+}
+
+/* Loop cell definition. */
+
+type Loop struct {
+	Break   *Continuation
+	body    Cell
+	dynamic *Env
+	lexical Context
+	name    Cell
+	next    func() Cell
+}
+
+func NewLoop(t *Task, name, s, body Cell) *Loop {
+	return &Loop{
+		body:    body,
+		dynamic: t.Dynamic,
+		lexical: t.Lexical,
+		name:    name,
+		next:    sequence(t, "for", s),
+	}
+}
+
+func (l *Loop) Bool() bool {
+	return true
+}
+
+func (l *Loop) Equal(c Cell) bool {
+	return l == c
+}
+
+func (l *Loop) String() string {
+	return identify("loop", l)
+}
+
+/* Loop-specific functions. */
+
+/*
+ * Next arranges for the body of the loop to be evaluated in a new block
+ * with the loop variable bound to the next element of the sequence and
+ * with break and continue bound. Returns false when the sequence is
+ * exhausted.
+ */
+func (l *Loop) Next(t *Task) bool {
+	item := l.next()
+	if item == nil {
+		return false
+	}
+
+	t.NewStates(psEvalBlock)
+	t.NewBlock(l.dynamic, l.lexical)
+
+	t.Lexical.Public(l.name, item)
+	t.Lexical.Public(NewSymbol("break"), l.Break)
+	t.Lexical.Public(NewSymbol("continue"), t.Capture(t.Scratch))
+
+	t.Code = l.body
+
+	return true
 }
 
 /* Method cell definition. */
@@ -557,7 +951,7 @@ func (m *Method) Equal(c Cell) bool {
 }
 
 func (m *Method) String() string {
-	return fmt.Sprintf("%%method %p%%", m)
+	return identify("method", m)
 }
 
 /*
@@ -577,14 +971,14 @@ func (o *Object) Equal(c Cell) bool {
 	if o == c {
 		return true
 	}
-	if o, ok := c.(*Object); ok {
-		return o.Context == o.Expose()
+	if p, ok := c.(*Object); ok {
+		return o.Expose() == p.Expose()
 	}
 	return false
 }
 
 func (o *Object) String() string {
-	return fmt.Sprintf("%%object %p%%", o)
+	return identify("object", o)
 }
 
 /* Object-specific functions */
@@ -618,11 +1012,14 @@ func (o *Object) Define(key Cell, value Cell) {
 
 type Pipe struct {
 	*Scope
-	b *bufio.Reader
-	c chan Cell
-	d chan bool
-	r *os.File
-	w *os.File
+	b       *bufio.Reader
+	c       chan Cell
+	d       chan bool
+	q       chan bool
+	r       *os.File
+	w       *os.File
+	readers int32
+	writers int32
 }
 
 func IsPipe(c Cell) bool {
@@ -647,6 +1044,7 @@ func NewPipe(l Context, r *os.File, w *os.File) Context {
 	p := &Pipe{
 		Scope: NewScope(l.Expose(), conduitEnv()),
 		b:     nil, c: nil, d: nil, r: r, w: w,
+		readers: 1, writers: 1,
 	}
 
 	if r == nil && w == nil {
@@ -663,7 +1061,7 @@ func NewPipe(l Context, r *os.File, w *os.File) Context {
 }
 
 func (p *Pipe) String() string {
-	return fmt.Sprintf("%%pipe %p%%", p)
+	return identify("pipe", p)
 }
 
 func (p *Pipe) Equal(c Cell) bool {
@@ -693,6 +1091,15 @@ func (p *Pipe) reader() *bufio.Reader {
 }
 
 func (p *Pipe) ReaderClose() {
+	if atomic.AddInt32(&p.readers, -1) > 0 {
+		return
+	}
+
+	if p.q != nil {
+		close(p.q)
+		p.q = nil
+	}
+
 	if p.r != nil {
 		p.r.Close()
 		p.r = nil
@@ -707,18 +1114,19 @@ func (p *Pipe) Read(t *Task) Cell {
 	if p.c == nil {
 		p.c = make(chan Cell)
 		p.d = make(chan bool)
-		go func() {
-			parse(t, p.reader(), deref, func(c Cell) {
-				p.c <- c
-				<-p.d
-			})
-			p.c <- Null
-		}()
-	} else {
+		p.q = make(chan bool)
+		go p.parse(p.c, p.d, p.q)
+	} else if p.d != nil {
 		p.d <- true
 	}
 
-	return <-p.c
+	c, ok := <-p.c
+	if !ok {
+		p.d = nil
+		return Null
+	}
+
+	return c
 }
 
 func (p *Pipe) ReadLine(t *Task) Cell {
@@ -732,6 +1140,10 @@ func (p *Pipe) ReadLine(t *Task) Cell {
 }
 
 func (p *Pipe) WriterClose() {
+	if atomic.AddInt32(&p.writers, -1) > 0 {
+		return
+	}
+
 	if p.w != nil {
 		p.w.Close()
 		p.w = nil
@@ -748,6 +1160,40 @@ func (p *Pipe) Write(c Cell) {
 
 /* Pipe-specific functions */
 
+/*
+ * Parse commands from the read end of the pipe, sending each on c and
+ * waiting on d before parsing the next. The parser runs as its own task,
+ * rather than as the first task to read from the pipe, and stops, closing
+ * c, at the end of input or when q is closed by the pipe's last reader.
+ */
+func (p *Pipe) parse(c chan Cell, d, q chan bool) {
+	t := NewTask(Null, nil, nil, nil)
+	defer t.release()
+	defer close(c)
+
+	parse(t, p.reader(), deref, func(v Cell) {
+		select {
+		case c <- v:
+		case <-q:
+			runtime.Goexit()
+		}
+
+		select {
+		case <-d:
+		case <-q:
+			runtime.Goexit()
+		}
+	})
+}
+
+func (p *Pipe) Hold(write bool) {
+	if write {
+		atomic.AddInt32(&p.writers, 1)
+	} else {
+		atomic.AddInt32(&p.readers, 1)
+	}
+}
+
 func (p *Pipe) ReadFd() *os.File {
 	return p.r
 }
@@ -764,6 +1210,14 @@ type Registers struct {
 	Code    Cell // Control
 	Dynamic *Env
 	Lexical Context
+
+	/*
+	 * The top fresh pairs on the stack were pushed after the stack was
+	 * last captured and are referenced from nowhere else. When popped
+	 * they are kept on the free list and reused by the next push.
+	 */
+	free  Cell
+	fresh int
 }
 
 /* Registers-specific functions. */
@@ -784,6 +1238,15 @@ func (r *Registers) Arguments() Cell {
 	return l
 }
 
+func (r *Registers) Capture(scratch Cell) *Continuation {
+	r.fresh = 0
+
+	k := NewContinuation(scratch, r.Stack)
+	k.protect = r.protect
+
+	return k
+}
+
 func (r *Registers) Complete(word string) []string {
 	completions := r.Lexical.Complete(word)
 	return append(completions, r.Dynamic.Complete(word)...)
@@ -804,7 +1267,7 @@ func (r *Registers) NewBlock(dynamic *Env, lexical Context) {
 func (r *Registers) NewStates(l ...int64) {
 	for _, f := range l {
 		if f >= SaveMax {
-			r.Stack = Cons(NewInteger(f), r.Stack)
+			r.push(NewInteger(f))
 			continue
 		}
 
@@ -814,52 +1277,60 @@ func (r *Registers) NewStates(l ...int64) {
 
 		if f&SaveCode > 0 {
 			if f&SaveCode == SaveCode {
-				r.Stack = Cons(r.Code, r.Stack)
+				r.push(r.Code)
 			} else if f&SaveCarCode > 0 {
-				r.Stack = Cons(Car(r.Code), r.Stack)
+				r.push(Car(r.Code))
 			} else if f&SaveCdrCode > 0 {
-				r.Stack = Cons(Cdr(r.Code), r.Stack)
+				r.push(Cdr(r.Code))
 			}
 		}
 
 		if f&SaveDynamic > 0 {
-			r.Stack = Cons(r.Dynamic, r.Stack)
+			r.push(r.Dynamic)
 		}
 
 		if f&SaveLexical > 0 {
-			r.Stack = Cons(r.Lexical, r.Stack)
+			r.push(r.Lexical)
 		}
 
 		if f&SaveScratch > 0 {
-			r.Stack = Cons(r.Scratch, r.Stack)
+			r.push(r.Scratch)
 		}
 
-		r.Stack = Cons(NewInteger(f), r.Stack)
+		if f&SaveProtect > 0 {
+			r.push(r.protect)
+		}
+
+		r.push(NewInteger(f))
 	}
 }
 
 func (r *Registers) RemoveState() {
 	f := r.GetState()
 
-	r.Stack = Cdr(r.Stack)
+	r.pop()
 	if f >= SaveMax {
 		return
 	}
 
+	if f&SaveProtect > 0 {
+		r.pop()
+	}
+
 	if f&SaveScratch > 0 {
-		r.Stack = Cdr(r.Stack)
+		r.pop()
 	}
 
 	if f&SaveLexical > 0 {
-		r.Stack = Cdr(r.Stack)
+		r.pop()
 	}
 
 	if f&SaveDynamic > 0 {
-		r.Stack = Cdr(r.Stack)
+		r.pop()
 	}
 
 	if f&SaveCode > 0 {
-		r.Stack = Cdr(r.Stack)
+		r.pop()
 	}
 }
 
@@ -875,27 +1346,32 @@ func (r *Registers) RestoreState() {
 		return
 	}
 
+	if f&SaveProtect > 0 {
+		r.pop()
+		r.protect = Car(r.Stack)
+	}
+
 	if f&SaveScratch > 0 {
-		r.Stack = Cdr(r.Stack)
+		r.pop()
 		r.Scratch = Car(r.Stack)
 	}
 
 	if f&SaveLexical > 0 {
-		r.Stack = Cdr(r.Stack)
+		r.pop()
 		r.Lexical = Car(r.Stack).(Context)
 	}
 
 	if f&SaveDynamic > 0 {
-		r.Stack = Cdr(r.Stack)
+		r.pop()
 		r.Dynamic = Car(r.Stack).(*Env)
 	}
 
 	if f&SaveCode > 0 {
-		r.Stack = Cdr(r.Stack)
+		r.pop()
 		r.Code = Car(r.Stack)
 	}
 
-	r.Stack = Cdr(r.Stack)
+	r.pop()
 }
 
 func (r *Registers) Return(rv Cell) bool {
@@ -904,6 +1380,40 @@ func (r *Registers) Return(rv Cell) bool {
 	return false
 }
 
+func (r *Registers) pop() {
+	p := r.Stack
+	if p == Null {
+		return
+	}
+
+	r.Stack = Cdr(p)
+
+	if r.fresh == 0 {
+		return
+	}
+	r.fresh--
+
+	SetCar(p, nil)
+	SetCdr(p, r.free)
+	r.free = p
+}
+
+func (r *Registers) push(c Cell) {
+	r.fresh++
+
+	if r.free == nil {
+		r.Stack = Cons(c, r.Stack)
+		return
+	}
+
+	p := r.free
+	r.free = Cdr(p)
+
+	SetCar(p, c)
+	SetCdr(p, r.Stack)
+	r.Stack = p
+}
+
 /*
  * Scope cell definition.
  * (A scope cell allows access to a context's public and private members).
@@ -927,7 +1437,7 @@ func (s *Scope) Equal(c Cell) bool {
 }
 
 func (s *Scope) String() string {
-	return fmt.Sprintf("%%scope %p%%", s)
+	return identify("scope", s)
 }
 
 /* Scope-specific functions */
@@ -1055,7 +1565,7 @@ func (s *String) Bool() bool {
 
 func (s *String) Equal(c Cell) bool {
 	if a, ok := c.(Atom); ok {
-		return string(s.v) == a.String()
+		return string(s.v) == raw(a)
 	}
 	return false
 }
@@ -1067,7 +1577,7 @@ func (s *String) String() string {
 func (s *String) Float() (f float64) {
 	var err error
 	if f, err = strconv.ParseFloat(string(s.v), 64); err != nil {
-		panic(err)
+		panic("error/runtime: not a number: " + s.String())
 	}
 	return f
 }
@@ -1075,7 +1585,7 @@ func (s *String) Float() (f float64) {
 func (s *String) Int() (i int64) {
 	var err error
 	if i, err = strconv.ParseInt(string(s.v), 0, 64); err != nil {
-		panic(err)
+		panic("error/runtime: not an integer: " + s.String())
 	}
 	return i
 }
@@ -1083,7 +1593,7 @@ func (s *String) Int() (i int64) {
 func (s *String) Rat() *big.Rat {
 	r := new(big.Rat)
 	if _, err := fmt.Sscan(string(s.v), r); err != nil {
-		panic(err)
+		panic("error/runtime: not a number: " + s.String())
 	}
 	return r
 }
@@ -1091,7 +1601,7 @@ func (s *String) Rat() *big.Rat {
 func (s *String) Status() (i int64) {
 	var err error
 	if i, err = strconv.ParseInt(string(s.v), 0, 64); err != nil {
-		panic(err)
+		panic("error/runtime: not a status: " + s.String())
 	}
 	return i
 }
@@ -1106,6 +1616,42 @@ func (s *String) Raw() string {
 	return string(s.v)
 }
 
+/*
+ * Super cell definition.
+ * (A super cell is the receiver of a method, with its public members
+ * looked up starting with the parent of the context in which the method
+ * was defined).
+ */
+
+type Super struct {
+	Context
+	parent Context
+}
+
+func NewSuper(receiver, defined Context) *Super {
+	return &Super{receiver, defined.Prev()}
+}
+
+func (s *Super) Equal(c Cell) bool {
+	return s == c
+}
+
+func (s *Super) String() string {
+	return identify("super", s)
+}
+
+/* Super-specific functions */
+
+func (s *Super) Access(key Cell) Reference {
+	for obj := s.parent; obj != nil; obj = obj.Prev() {
+		if value := obj.Faces().prev.Access(key); value != nil {
+			return value
+		}
+	}
+
+	return nil
+}
+
 /* Syntax cell definition. */
 
 type Syntax struct {
@@ -1136,7 +1682,7 @@ func (m *Syntax) Equal(c Cell) bool {
 }
 
 func (m *Syntax) String() string {
-	return fmt.Sprintf("%%syntax %p%%", m)
+	return identify("syntax", m)
 }
 
 /* Task cell definition. */
@@ -1144,12 +1690,24 @@ func (m *Syntax) String() string {
 type Task struct {
 	*Job
 	*Registers
-	Done      chan Cell
-	Eval      chan Cell
-	children  map[*Task]bool
-	parent    *Task
-	pid       int
-	suspended chan bool
+	*Scope
+	Done        chan Cell
+	Eval        chan Cell
+	cancelled   int32
+	capture     bool
+	children    map[*Task]bool
+	failure     interface{}
+	held        []func()
+	interrupted int32
+	optionsFrom *Env
+	optionsGen  int64
+	optionsRef  Reference
+	parent      *Task
+	pid         int
+	process     Process
+	result      Cell
+	started     Runner
+	suspended   chan bool
 }
 
 func NewTask(c Cell, d *Env, l Context, p *Task) *Task {
@@ -1179,6 +1737,7 @@ func NewTask(c Cell, d *Env, l Context, p *Task) *Task {
 			Dynamic: d,
 			Lexical: l,
 		},
+		Scope:     NewScope(l.Expose(), taskEnv()),
 		Done:      make(chan Cell, 1),
 		Eval:      make(chan Cell, 1),
 		children:  make(map[*Task]bool),
@@ -1191,6 +1750,8 @@ func NewTask(c Cell, d *Env, l Context, p *Task) *Task {
 		p.children[t] = true
 	}
 
+	t.hold()
+
 	return t
 }
 
@@ -1199,13 +1760,22 @@ func (t *Task) Bool() bool {
 }
 
 func (t *Task) String() string {
-	return fmt.Sprintf("%%task %p%%", t)
+	return identify("task", t)
 }
 
 func (t *Task) Equal(c Cell) bool {
 	return t == c
 }
 
+/* Complete word using the task's lexical and dynamic environments. */
+func (t *Task) Complete(word string) []string {
+	return t.Registers.Complete(word)
+}
+
+func (t *Task) Expose() Context {
+	return t
+}
+
 /* Task-specific functions. */
 
 func (t *Task) Apply(args Cell) bool {
@@ -1226,22 +1796,105 @@ func (t *Task) Apply(args Cell) bool {
 		t.Lexical.Public(label, m.Self().Expose())
 	}
 
-	params := m.Ref().Params()
-	for args != Null && params != Null && IsAtom(Car(params)) {
-		t.Lexical.Public(Car(params), Car(args))
-		args, params = Cdr(args), Cdr(params)
-	}
-	if IsCons(Car(params)) {
-		t.Lexical.Public(Caar(params), args)
+	if self := m.Self(); self != nil && m.Ref().Scope() != nil {
+		t.Lexical.Public(NewSymbol("super"),
+			NewSuper(self, m.Ref().Scope()))
 	}
 
-	cc := NewContinuation(Cdr(t.Scratch), t.Stack)
-	t.Lexical.Public(NewSymbol("return"), cc)
+	params := m.Ref().Params()
+	args, values := keywords(params, args)
 
-	return true
-}
+	defaults := Null
+	for ; params != Null; params = Cdr(params) {
+		p := Car(params)
+		if IsCons(p) && Cdr(p) == Null {
+			t.Lexical.Public(Car(p), args)
+			break
+		}
 
-func (t *Task) Closure(n ClosureGenerator) bool {
+		name, expr := p, Cell(nil)
+		if IsCons(p) {
+			name, expr = Car(p), Cadr(p)
+		}
+
+		if k := raw(name); isKeyword(k) {
+			name = NewSymbol(k[2:])
+			if v, ok := values[k]; ok {
+				t.Lexical.Public(name, v)
+			} else if expr != nil {
+				defaults = AppendTo(defaults, Cons(name, expr))
+			} else {
+				t.Lexical.Public(name, False)
+			}
+		} else if args != Null {
+			t.Lexical.Public(name, Car(args))
+			args = Cdr(args)
+		} else if expr != nil {
+			defaults = AppendTo(defaults, Cons(name, expr))
+		}
+	}
+
+	cc := t.Capture(Cdr(t.Scratch))
+	t.Lexical.Public(NewSymbol("return"), cc)
+
+	/* Default values are evaluated, in order, in the method's scope. */
+	if defaults != Null {
+		t.NewStates(SaveCode)
+
+		t.Code = defaults
+		t.NewStates(psExecDefault, SaveCode, psEvalElement)
+
+		t.Code = Cdar(defaults)
+	}
+
+	return true
+}
+
+/*
+ * Caller returns a function that applies a method to its arguments in a
+ * child task, running it to completion. This lets Go code, such as the
+ * less function passed to sort.SliceStable, call back into oh.
+ */
+func (t *Task) Caller() func(f Binding, args ...Cell) Cell {
+	c := NewTask(Null, t.Dynamic, t.Lexical, t)
+	delete(t.children, c)
+	c.release()
+
+	return func(f Binding, args ...Cell) Cell {
+		c.Scratch = Cons(nil, List(f))
+		for _, v := range args {
+			c.Scratch = Cons(v, c.Scratch)
+		}
+		c.Stack = List(NewInteger(psExecMethod))
+		c.protect = nil
+		c.fresh = 0
+
+		if !c.Run(nil) {
+			panic("error/runtime: method failed")
+		}
+
+		return Car(c.Scratch)
+	}
+}
+
+/*
+ * Cancel interrupts t and its children, terminating any external command
+ * that t is running. The resulting error is not reported.
+ */
+func (t *Task) Cancel() {
+	atomic.StoreInt32(&t.cancelled, 1)
+	atomic.StoreInt32(&t.interrupted, 1)
+
+	t.terminate()
+
+	for k, v := range t.children {
+		if v {
+			k.Cancel()
+		}
+	}
+}
+
+func (t *Task) Closure(n ClosureGenerator) bool {
 	label := Null
 	params := Car(t.Code)
 	for t.Code != Null && raw(Cadr(t.Code)) != "as" {
@@ -1282,12 +1935,57 @@ func (t *Task) Continue() {
 }
 
 func (t *Task) Debug(s string) {
-	fmt.Printf("%s: t.Code = %v, t.Scratch = %v\n", s, t.Code, t.Scratch)
+	t.Fprintf("$stdout", "%s: t.Code = %v, t.Scratch = %v\n",
+		s, t.Code, t.Scratch)
+}
+
+/*
+ * Record v, the result of the interactive command c, as $_ (shifting the
+ * previous results to $__ and $___) and, unless c is a definition or an
+ * assignment, display it. If $display is bound to a method, it is called
+ * with v. Otherwise, if v is a list or an object, it is pretty printed
+ * (in color and paged when the standard output is a terminal).
+ */
+func (t *Task) Display(c, v Cell) {
+	names := []string{"$___", "$__", "$_"}
+	for i, k := range names[1:] {
+		if r := env0.Access(NewSymbol(k)); r != nil {
+			env0.Add(NewSymbol(names[i]), r.Get())
+		}
+	}
+	env0.Add(NewSymbol("$_"), v)
+
+	if IsCons(c) {
+		switch raw(Car(c)) {
+		case "define", "define-constant", "local", "public", "set",
+			"setenv":
+			return
+		}
+	}
+
+	if r := Resolve(t.Lexical, t.Dynamic, NewSymbol("$display")); r != nil {
+		t.execute(List(r.Get(), List(NewSymbol("quote"), v)))
+		return
+	}
+
+	if _, ok := v.(*Object); ok || (IsCons(v) && v != Null) {
+		width := defaultWidth
+		if _, cols := TerminalSize(); cols > 0 {
+			width = cols
+		}
+
+		if !t.terminal("$stdout") {
+			t.Fprintf("$stdout", "%s\n", pretty(v, width, false))
+			return
+		}
+
+		t.page(pretty(v, width, true) + "\n")
+	}
 }
 
 func (t *Task) DynamicVar(state int64) bool {
 	r := raw(Car(t.Code))
-	if t.Strict() && number(r) {
+	if t.Option("numbers").Bool() && number(r) {
 		msg := r + " cannot be used as a variable name"
 		panic("error/syntax: " + msg)
 	}
@@ -1324,23 +2022,42 @@ func (t *Task) Execute(arg0 string, argv []string, attr *os.ProcAttr) (*Status,
 		attr.Sys = SysProcAttr(t.Group)
 	}
 
-	proc, err := os.StartProcess(arg0, argv, attr)
+	r := t.runner()
+
+	if _, ok := r.(local); ok {
+		if err := t.confine(attr); err != nil {
+			t.Unlock()
+			return nil, err
+		}
+	}
+
+	proc, err := r.Start(arg0, argv, attr)
 	if err != nil {
 		t.Unlock()
 		return nil, err
 	}
 
+	if _, ok := r.(local); ok {
+		if err = t.limit(proc); err != nil {
+			_ = r.Signal(proc, os.Kill)
+			_, _ = r.Wait(proc)
+			t.Unlock()
+			return nil, err
+		}
+	}
+
 	if jobControlEnabled() {
 		if t.Group == 0 {
-			t.Group = proc.Pid
+			t.Group = proc.Pid()
 		}
 	}
 
-	t.pid = proc.Pid
+	t.pid = proc.Pid()
+	t.process, t.started = proc, r
 
 	t.Unlock()
 
-	status := JoinProcess(proc)
+	status, err := r.Wait(proc)
 
 	if jobControlEnabled() {
 		if t.Group == t.pid {
@@ -1348,6 +2065,7 @@ func (t *Task) Execute(arg0 string, argv []string, attr *os.ProcAttr) (*Status,
 		}
 	}
 	t.pid = 0
+	t.process, t.started = nil, nil
 
 	return NewStatus(int64(status)), err
 }
@@ -1355,12 +2073,28 @@ func (t *Task) Execute(arg0 string, argv []string, attr *os.ProcAttr) (*Status,
 func (t *Task) External(args Cell) bool {
 	t.Scratch = Cdr(t.Scratch)
 
-	arg0, problem := adapted.LookPath(raw(Car(t.Scratch)))
+	if m := mocked(t, raw(Car(t.Scratch))); m != nil {
+		calls := NewSymbol("calls")
+		m.Public(calls, AppendTo(m.Access(calls).Get(), args))
+
+		b, ok := m.Access(NewSymbol("method")).Get().(Binding)
+		if !ok {
+			panic("error/runtime: mock-command expects a method")
+		}
+		SetCar(t.Scratch, b)
+
+		return b.Ref().Applier()(t, args)
+	}
+
+	demand("exec")
+
+	name := raw(Car(t.Scratch))
+	arg0, problem := t.runner().LookPath(name)
 
 	SetCar(t.Scratch, False)
 
 	if problem != nil {
-		panic("error/runtime: " + problem.Error())
+		arg0 = t.correct(name, problem)
 	}
 
 	argv := []string{arg0}
@@ -1388,29 +2122,133 @@ func (t *Task) External(args Cell) bool {
 	return t.Return(status)
 }
 
+/*
+ * Fprintf formats its arguments, as fmt.Sprintf does, and writes them, less
+ * any trailing newline, as a line to t's $stdout or $stderr, named by name.
+ * If that cannot be done (because the conduit has been closed, or the
+ * variable rebound), the line is written to the process's own stdout or
+ * stderr, so that errors, in particular, are not lost.
+ */
+func (t *Task) Fprintf(name, format string, a ...interface{}) {
+	t.fprint(name, strings.TrimSuffix(fmt.Sprintf(format, a...), "\n"), true)
+}
+
+/*
+ * Fprint writes s as it is, without ending the line, to t's $stdout or
+ * $stderr, named by name, which must be a pipe. Like Fprintf, it falls back
+ * to the process's own stdout or stderr.
+ */
+func (t *Task) Fprint(name, s string) {
+	t.fprint(name, s, false)
+}
+
+func (t *Task) fprint(name, s string, line bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			f := os.Stdout
+			if name == "$stderr" {
+				f = os.Stderr
+			}
+			if line {
+				fmt.Fprintln(f, s)
+			} else {
+				fmt.Fprint(f, s)
+			}
+		}
+	}()
+
+	c := Resolve(t.Lexical, t.Dynamic, NewSymbol(name)).Get()
+	if line {
+		toConduit(c.(Context)).Write(NewSymbol(s))
+		return
+	}
+
+	f := wpipe(c)
+	if f == nil {
+		panic("write to closed pipe")
+	}
+	fmt.Fprint(f, s)
+}
+
+/*
+ * Cancel the command being evaluated by t. The cancellation takes effect
+ * at t's next state transition, after any foreground external command,
+ * which is sent an interrupt, has finished.
+ */
+func (t *Task) Interrupt() {
+	atomic.StoreInt32(&t.interrupted, 1)
+
+	if t.Job.Group > 0 && t.Job.Group != pgid {
+		InterruptProcessGroup(t.Job.Group)
+	}
+}
+
+/*
+ * Junction evaluates the operands of and (or) from left to right until
+ * one is false (true). The value of the last operand evaluated is
+ * returned. With no operands, and returns true and or returns false.
+ */
+func (t *Task) Junction(state int64) bool {
+	if t.Code == Null {
+		return t.Return(NewBoolean(state == psExecAnd))
+	}
+
+	t.ReplaceStates(state, SaveCode, psEvalElement)
+
+	t.Code = Car(t.Code)
+	t.Scratch = Cdr(t.Scratch)
+
+	return true
+}
+
 func (t *Task) Launch() {
 	t.Run(nil)
+	t.release()
 	close(t.Done)
 }
 
-func (t *Task) Listen() {
-	for c := range t.Eval {
-		saved := *(t.Registers)
+/*
+ * Let evaluates the value of each (name value) binding and then the body
+ * in a new block with the names bound. For let the values are evaluated
+ * in the enclosing block. For letrec they are evaluated in the new block
+ * so that methods can refer to each other.
+ */
+func (t *Task) Let(state int64) bool {
+	values := Null
+	for l := Car(t.Code); l != Null; l = Cdr(l) {
+		b := Car(l)
+		if _, ok := Car(b).(*Symbol); !ok || !IsCons(b) {
+			panic("error/syntax: expected (name value)")
+		}
+		values = AppendTo(values, Cadr(b))
+	}
+
+	t.ReplaceStates(SaveDynamic|SaveLexical,
+		state, SaveCode, psEvalArguments)
 
-		end := Cons(nil, Null)
+	if state == psExecLetrec {
+		t.NewBlock(t.Dynamic, t.Lexical)
+	}
 
-		SetCar(t.Code, c)
-		SetCdr(t.Code, end)
+	t.Code = values
+	t.Scratch = Cons(nil, t.Scratch)
 
-		t.Code = end
-		t.NewStates(SaveCode, psEvalCommand)
+	return true
+}
 
-		t.Code = c
-		if !t.Run(end) {
-			*(t.Registers) = saved
+func (t *Task) Listen() {
+	for c := range t.Eval {
+		start := now()
 
-			SetCar(t.Code, nil)
-			SetCdr(t.Code, Null)
+		ok := t.execute(c)
+		if !ok {
+			t.result = NewStatus(1)
+		}
+
+		t.record(c, t.result, since(start))
+
+		if ok && interactive {
+			t.Display(c, t.result)
 		}
 
 		t.Done <- nil
@@ -1420,8 +2258,9 @@ func (t *Task) Listen() {
 func (t *Task) LexicalVar(state int64) bool {
 	t.RemoveState()
 
+	/* A local is always bound in the innermost scope. */
 	l := t.Self().Expose()
-	if t.Lexical != l {
+	if t.Lexical != l && state != psExecLocal {
 		t.NewStates(SaveLexical)
 		t.Lexical = l
 	}
@@ -1429,7 +2268,7 @@ func (t *Task) LexicalVar(state int64) bool {
 	t.NewStates(state)
 
 	r := raw(Car(t.Code))
-	if t.Strict() && number(r) {
+	if t.Option("numbers").Bool() && number(r) {
 		msg := r + " cannot be used as a variable name"
 		panic("error/syntax: " + msg)
 	}
@@ -1452,10 +2291,19 @@ func (t *Task) LexicalVar(state int64) bool {
 }
 
 func (t *Task) Lookup(sym *Symbol, simple bool) (bool, string) {
+	return t.lookup(sym, simple, false)
+}
+
+/*
+ * Look up sym, which the caller may already know to read as a number. A
+ * number is never undefined.
+ */
+func (t *Task) lookup(sym *Symbol, simple, numeric bool) (bool, string) {
 	c := Resolve(t.Lexical, t.Dynamic, sym)
 	if c == nil {
 		r := raw(sym)
-		if t.GetState() == psEvalMember || (t.Strict() && !number(r)) {
+		if t.GetState() == psEvalMember || (!numeric &&
+			t.optionIs("undefined", "fail") && !number(r)) {
 			return false, "'" + r + "' undefined"
 		}
 		t.Scratch = Cons(sym, t.Scratch)
@@ -1470,6 +2318,30 @@ func (t *Task) Lookup(sym *Symbol, simple bool) (bool, string) {
 	return true, ""
 }
 
+/*
+ * Evaluating an atom cannot capture a continuation so a run of atoms in
+ * an argument list is looked up directly, without pushing a state for
+ * each element. Returns true if arguments remain to be evaluated.
+ */
+func (t *Task) LookupAtoms(simple bool) bool {
+	for ; t.Code != Null; t.Code = Cdr(t.Code) {
+		switch op := instruction(t.Code); op {
+		case opConstant, opNull:
+			t.Scratch = Cons(Car(t.Code), t.Scratch)
+		case opNumber, opSymbol:
+			sym := Car(t.Code).(*Symbol)
+			ok, msg := t.lookup(sym, simple, op == opNumber)
+			if !ok {
+				panic("error/runtime: " + msg)
+			}
+		default:
+			return true
+		}
+	}
+
+	return false
+}
+
 func (t *Task) Run(end Cell) (successful bool) {
 	successful = true
 
@@ -1479,12 +2351,28 @@ func (t *Task) Run(end Cell) (successful bool) {
 			return
 		}
 
-		fmt.Printf("oh: %v\n", r)
+		if t.capture {
+			t.failure = r
+		} else if atomic.LoadInt32(&t.cancelled) == 0 {
+			msg := fmt.Sprintf("oh: %v", r)
+			if interactive && t.terminal("$stderr") {
+				msg = ansiRed + msg + ansiReset
+			}
+			t.Fprintf("$stderr", "%s\n", msg)
+		}
 
 		successful = false
+
+		if t.Unwind(nil, Null) {
+			t.Run(end)
+		}
 	}()
 
 	for t.Runnable() && t.Stack != Null {
+		if atomic.CompareAndSwapInt32(&t.interrupted, 1, 0) {
+			panic("error/interrupted: command cancelled")
+		}
+
 		state := t.GetState()
 
 		switch state {
@@ -1509,8 +2397,8 @@ func (t *Task) Run(end Cell) (successful bool) {
 				continue
 			}
 
-		case psExecIf, psExecWhileBody:
-			if !Car(t.Scratch).Bool() {
+		case psExecIf, psExecUnless, psExecWhileBody:
+			if Car(t.Scratch).Bool() == (state == psExecUnless) {
 				t.Code = Cdr(t.Code)
 
 				for Car(t.Code) != Null &&
@@ -1536,17 +2424,24 @@ func (t *Task) Run(end Cell) (successful bool) {
 			fallthrough
 		case psEvalBlock:
 			if t.Code == end {
+				t.result = Car(t.Scratch)
 				t.Scratch = Cdr(t.Scratch)
 				return
 			}
 
-			if t.Code == Null ||
-				!IsCons(t.Code) || !IsCons(Car(t.Code)) {
+			if t.Code == Null || !IsCons(t.Code) {
+				break
+			}
+
+			op := instruction(t.Code)
+			if op == opConstant || op == opNumber || op == opSymbol {
 				break
 			}
 
 			if Cdr(t.Code) == Null || !IsCons(Cadr(t.Code)) {
 				t.ReplaceStates(psEvalCommand)
+			} else if op != opUnchecked && t.Option("errexit").Bool() {
+				t.NewStates(SaveCdrCode, psExecErrexit, psEvalCommand)
 			} else {
 				t.NewStates(SaveCdrCode, psEvalCommand)
 			}
@@ -1561,16 +2456,53 @@ func (t *Task) Run(end Cell) (successful bool) {
 				break
 			}
 
-			t.ReplaceStates(psExecCommand,
-				SaveCdrCode,
-				psEvalElement)
-			t.Code = Car(t.Code)
+			/*
+			 * A head that is an atom is looked up in place. Only
+			 * a head that must itself be evaluated gets a state.
+			 */
+			switch op := instruction(t.Code); op {
+			case opConstant, opNull:
+				t.Scratch = Cons(Car(t.Code), t.Scratch)
+			case opNumber, opSymbol:
+				sym := Car(t.Code).(*Symbol)
+				ok, msg := t.lookup(sym, false, op == opNumber)
+				if !ok {
+					panic("error/runtime: " + msg)
+				}
+			default:
+				t.ReplaceStates(psExecCommand,
+					SaveCdrCode,
+					psEvalElement)
+				t.Code = Car(t.Code)
 
-			continue
+				continue
+			}
+
+			t.ReplaceStates(psExecCommand)
+			t.Code = Cdr(t.Code)
 
+			fallthrough
 		case psExecCommand:
 			switch k := Car(t.Scratch).(type) {
 			case *String, *Symbol:
+				if path := autoload(t, raw(k)); path != "" {
+					/*
+					 * Source the file in the root scope and
+					 * then evaluate the command again.
+					 */
+					eval := scope0.Access(NewSymbol("eval"))
+					source := List(NewSymbol("source"),
+						NewSymbol(path))
+
+					t.ReplaceStates(psEvalBlock)
+					t.Code = List(List(
+						eval.Get().(Binding).Bind(scope0),
+						List(NewSymbol("quote"), source),
+					), Cons(k, t.Code))
+
+					continue
+				}
+
 				t.Scratch = Cons(external, t.Scratch)
 
 				t.ReplaceStates(psExecBuiltin,
@@ -1590,7 +2522,24 @@ func (t *Task) Run(end Cell) (successful bool) {
 				}
 
 			case *Continuation:
-				t.ReplaceStates(psReturn, psEvalArguments)
+				if t.Code == Null || Cdr(t.Code) != Null ||
+					t.protected(k) != nil {
+					t.ReplaceStates(psReturn, psEvalArguments)
+					break
+				}
+
+				/*
+				 * A continuation applied to a single expression is
+				 * a tail call. Jump first and evaluate the expression
+				 * in place of the state the jump would have removed.
+				 */
+				t.Continuation = *k
+				t.fresh = 0
+
+				t.ReplaceStates(psEvalElement)
+				t.Code = Car(t.Code)
+
+				continue
 
 			default:
 				msg := fmt.Sprintf("can't evaluate: %v", t)
@@ -1601,10 +2550,18 @@ func (t *Task) Run(end Cell) (successful bool) {
 
 			fallthrough
 		case psEvalArguments, psEvalArgumentsBuiltin:
-			if t.Code == Null {
+			simple := t.GetState() == psEvalArgumentsBuiltin
+			if !t.LookupAtoms(simple) {
 				break
 			}
 
+			if instruction(t.Code) == opCommand {
+				t.NewStates(SaveCdrCode, psEvalCommand)
+				t.Code = Car(t.Code)
+
+				continue
+			}
+
 			t.NewStates(next[t.GetState()]...)
 
 			t.Code = Car(t.Code)
@@ -1638,32 +2595,78 @@ func (t *Task) Run(end Cell) (successful bool) {
 				break
 			}
 
-		case psExecDefine:
-			t.Lexical.Define(t.Code, Car(t.Scratch))
+		case psExecConstant, psExecDefine, psExecLocal:
+			b := List(Cons(t.Code, Car(t.Scratch)))
+			if IsCons(t.Code) {
+				b = destructure(t, t.Code, Car(t.Scratch))
+			}
+
+			/*
+			 * A local is bound in a new scope that lasts until the
+			 * end of the enclosing block, leaving the block's own
+			 * scope, which may be an object, unchanged.
+			 */
+			if state == psExecLocal {
+				t.Lexical = NewScope(t.Lexical, nil)
+			}
+
+			for ; b != Null; b = Cdr(b) {
+				t.Lexical.Define(Caar(b), Cdar(b))
+				if state == psExecConstant {
+					t.Lexical.Faces().Freeze(Caar(b))
+				}
+			}
 
 		case psExecPublic:
-			t.Lexical.Public(t.Code, Car(t.Scratch))
+			if !IsCons(t.Code) {
+				t.Lexical.Public(t.Code, Car(t.Scratch))
+				break
+			}
+
+			b := destructure(t, t.Code, Car(t.Scratch))
+			for ; b != Null; b = Cdr(b) {
+				t.Lexical.Public(Caar(b), Cdar(b))
+			}
 
 		case psExecDynamic, psExecSetenv:
 			k := t.Code
 			v := Car(t.Scratch)
 
 			if state == psExecSetenv {
-				s := raw(v)
-				os.Setenv(strings.TrimLeft(k.String(), "$"), s)
+				name := strings.TrimLeft(k.String(), "$")
+				k = NewSymbol("$" + environmentName(name))
+				os.Setenv(name, raw(v))
 			}
 
 			t.Dynamic.Add(k, v)
 
+		case psExecErrexit:
+			if failed(Car(t.Scratch)) && t.Option("errexit").Bool() {
+				t.Scratch = List(Car(t.Scratch))
+				t.Stop()
+
+				continue
+			}
+
 		case psExecSet:
-			k := t.Code.(*Symbol)
-			r := Resolve(t.Lexical, t.Dynamic, k)
-			if r == nil {
-				msg := "'" + k.String() + "' undefined"
-				panic("error/runtime: " + msg)
+			b := List(Cons(t.Code, Car(t.Scratch)))
+			if IsCons(t.Code) {
+				b = destructure(t, t.Code, Car(t.Scratch))
 			}
 
-			r.Set(Car(t.Scratch))
+			for ; b != Null; b = Cdr(b) {
+				k := Caar(b).(*Symbol)
+				r := Resolve(t.Lexical, t.Dynamic, k)
+				if r == nil {
+					msg := "'" + k.String() + "' undefined"
+					panic("error/runtime: " + msg)
+				} else if _, ok := r.(*Constant); ok {
+					msg := "'" + k.String() + "' is constant"
+					panic("error/runtime: " + msg)
+				}
+
+				r.Set(Cdar(b))
+			}
 
 		case psExecSplice:
 			l := Car(t.Scratch)
@@ -1688,10 +2691,178 @@ func (t *Task) Run(end Cell) (successful bool) {
 
 			continue
 
+		case psExecDefault:
+			t.Lexical.Public(Caar(t.Code), Car(t.Scratch))
+			t.Scratch = Cdr(t.Scratch)
+
+			t.Code = Cdr(t.Code)
+			if t.Code == Null {
+				break
+			}
+
+			t.NewStates(SaveCode, psEvalElement)
+
+			t.Code = Cdar(t.Code)
+
+			continue
+
+		case psExecAnd, psExecOr:
+			if Car(t.Scratch).Bool() == (state == psExecOr) {
+				break
+			}
+
+			t.Code = Cdr(t.Code)
+			if t.Code == Null {
+				break
+			}
+
+			t.NewStates(SaveCode, psEvalElement)
+
+			t.Code = Car(t.Code)
+			t.Scratch = Cdr(t.Scratch)
+
+			continue
+
+		case psExecCond:
+			if Car(t.Scratch).Bool() {
+				t.ReplaceStates(psEvalBlock)
+
+				t.Code = Cdar(t.Code)
+
+				continue
+			}
+
+			t.Code = Cdr(t.Code)
+			if t.Code == Null {
+				break
+			}
+
+			t.NewStates(SaveCode, psEvalElement)
+
+			t.Code = condition(Car(t.Code))
+			t.Scratch = Cdr(t.Scratch)
+
+			continue
+
+		case psExecCase:
+			body, b := choose(t, Car(t.Scratch), Cdr(t.Code))
+			if body == nil {
+				SetCar(t.Scratch, False)
+				break
+			}
+
+			for ; b != Null; b = Cdr(b) {
+				t.Lexical.Public(Caar(b), Cdar(b))
+			}
+
+			t.ReplaceStates(psEvalBlock)
+
+			t.Code = body
+
+			continue
+
+		case psExecLet, psExecLetrec:
+			args := t.Arguments()
+
+			if state == psExecLet {
+				t.NewBlock(t.Dynamic, t.Lexical)
+			}
+
+			for l := Car(t.Code); l != Null; l = Cdr(l) {
+				t.Lexical.Public(Caar(l), Car(args))
+				args = Cdr(args)
+			}
+
+			t.ReplaceStates(psEvalBlock)
+
+			t.Code = Cdr(t.Code)
+
+			continue
+
+		case psExecForIn:
+			loop := NewLoop(t, Car(t.Code), Car(t.Scratch),
+				Cdr(Cddr(t.Code)))
+
+			SetCar(t.Scratch, loop)
+			loop.Break = t.Capture(Cdr(t.Scratch))
+
+			t.ReplaceStates(psExecForNext)
+			t.Scratch = Cons(False, t.Scratch)
+
+			continue
+
+		case psExecForNext:
+			v := Car(t.Scratch)
+			t.Scratch = Cdr(t.Scratch)
+
+			loop := Car(t.Scratch).(*Loop)
+			if !loop.Next(t) {
+				SetCar(t.Scratch, v)
+				break
+			}
+
+			t.Scratch = Cons(v, t.Scratch)
+
+			continue
+
+		case psExecIterate:
+			v := Car(t.Scratch)
+			t.Scratch = Cdr(t.Scratch)
+
+			it := Car(t.Scratch).(*Iterator)
+
+			args := it.Next(v)
+			if args == nil {
+				SetCar(t.Scratch, it.Result())
+				break
+			}
+
+			t.Scratch = Cons(nil, Cons(it.f, t.Scratch))
+			for ; args != Null; args = Cdr(args) {
+				t.Scratch = Cons(Car(args), t.Scratch)
+			}
+
+			t.NewStates(psExecMethod)
+
+			continue
+
+		case psExecProtect:
+			t.RemoveState()
+			t.RestoreState()
+
+			t.NewStates(SaveScratch, psEvalBlock)
+			t.Code = Cdr(t.Code)
+
+			continue
+
+		case psExecUnwind:
+			v := Car(t.Scratch)
+			k := Cadr(t.Scratch)
+			t.Scratch = Cddr(t.Scratch)
+
+			if t.Unwind(k, v) {
+				continue
+			}
+
+			if k == nil {
+				successful = false
+				return
+			}
+
+			t.Continuation = *k.(*Continuation)
+			t.fresh = 0
+			t.Scratch = Cons(v, t.Scratch)
+
 		case psReturn:
 			args := t.Arguments()
+			k := Car(t.Scratch)
+
+			if t.Unwind(k, Car(args)) {
+				continue
+			}
 
-			t.Continuation = *Car(t.Scratch).(*Continuation)
+			t.Continuation = *k.(*Continuation)
+			t.fresh = 0
 			t.Scratch = Cons(Car(args), t.Scratch)
 
 			break
@@ -1723,6 +2894,7 @@ func (t *Task) Self() Context {
 
 func (t *Task) Stop() {
 	t.Stack = Null
+	t.protect = nil
 	close(t.Eval)
 
 	select {
@@ -1731,9 +2903,7 @@ func (t *Task) Stop() {
 		close(t.suspended)
 	}
 
-	if t.pid > 0 {
-		TerminateProcess(t.pid)
-	}
+	t.terminate()
 
 	for k, v := range t.children {
 		if v {
@@ -1742,24 +2912,6 @@ func (t *Task) Stop() {
 	}
 }
 
-func (t *Task) Strict() (ok bool) {
-	defer func() {
-		r := recover()
-		if r == nil {
-			return
-		}
-
-		ok = false
-	}()
-
-	c := Resolve(t.Lexical, nil, NewSymbol("strict"))
-	if c == nil {
-		return false
-	}
-
-	return c.Get().(Cell).Bool()
-}
-
 func (t *Task) Suspend() {
 	for k, v := range t.children {
 		if v {
@@ -1770,6 +2922,33 @@ func (t *Task) Suspend() {
 	t.suspended = make(chan bool)
 }
 
+/*
+ * Jumping to the continuation k (or, if k is nil, abandoning the stack
+ * after an error) must first run the cleanup commands of any protected
+ * regions being left. If there are any, Unwind arranges for the cleanup
+ * of the innermost to be evaluated, followed by the rest of the jump,
+ * and returns true.
+ */
+func (t *Task) Unwind(k Cell, v Cell) bool {
+	p := t.protected(k)
+	if p == nil {
+		return false
+	}
+
+	t.Stack = p
+	t.fresh = 0
+
+	t.RemoveState()
+	t.RestoreState()
+
+	t.Scratch = Cons(v, Cons(k, t.Scratch))
+
+	t.NewStates(psExecUnwind, SaveScratch, psEvalBlock)
+	t.Code = Cdr(t.Code)
+
+	return true
+}
+
 func (t *Task) Wait() {
 	for k, v := range t.children {
 		if v {
@@ -1779,6 +2958,186 @@ func (t *Task) Wait() {
 	}
 }
 
+/* Returns the stack below the state on top of stack s. */
+func below(s Cell) Cell {
+	f := Car(s).(Atom).Int()
+
+	s = Cdr(s)
+	if f >= SaveMax {
+		return s
+	}
+
+	for _, m := range []int64{
+		SaveCode, SaveDynamic, SaveLexical, SaveScratch, SaveProtect,
+	} {
+		if f&m > 0 {
+			s = Cdr(s)
+		}
+	}
+
+	return s
+}
+
+/* Evaluate the command c, returning false if it was unsuccessful. */
+func (t *Task) execute(c Cell) bool {
+	atomic.StoreInt32(&t.interrupted, 0)
+
+	t.fresh = 0
+	saved := *(t.Registers)
+	saved.free = nil
+
+	end := Cons(nil, Null)
+
+	SetCar(t.Code, c)
+	SetCdr(t.Code, end)
+
+	t.Code = end
+	t.NewStates(SaveCode, psEvalCommand)
+
+	t.Code = c
+	if !t.Run(end) {
+		*(t.Registers) = saved
+
+		SetCar(t.Code, nil)
+		SetCdr(t.Code, Null)
+
+		return false
+	}
+
+	return true
+}
+
+/* Hold the conduits bound to t's $stdin, $stdout and $stderr. */
+func (t *Task) hold() {
+	for _, name := range []string{"$stdin", "$stdout", "$stderr"} {
+		r := Resolve(t.Lexical, t.Dynamic, NewSymbol(name))
+		if r == nil {
+			continue
+		}
+
+		c, ok := r.Get().(Context)
+		if !ok {
+			continue
+		}
+
+		s, ok := asConduit(c).(Shared)
+		if !ok {
+			continue
+		}
+
+		write := name != "$stdin"
+		s.Hold(write)
+
+		release := s.ReaderClose
+		if write {
+			release = s.WriterClose
+		}
+		t.held = append(t.held, release)
+	}
+}
+
+/*
+ * Returns the stack at the innermost protected region that is on the
+ * current stack but not on the stack of the continuation k, or nil.
+ */
+func (t *Task) protected(k Cell) Cell {
+	if t.protect == nil {
+		return nil
+	}
+
+	target := Null
+	if c, ok := k.(*Continuation); ok {
+		if c.protect == t.protect {
+			return nil
+		}
+		target = c.Stack
+	}
+
+	regions := []Cell{}
+	for s := t.Stack; s != target; s = below(s) {
+		if s == Null {
+			return t.unshared(regions, target)
+		}
+
+		if Car(s).(Atom).Int() == psExecProtect {
+			regions = append(regions, s)
+		}
+	}
+
+	if len(regions) == 0 {
+		return nil
+	}
+
+	return regions[0]
+}
+
+/*
+ * Record the status of the top-level command c, whose result is v, as $?,
+ * its text as $last-command and the time d that it took, in seconds, as
+ * $last-duration. If c was run in the background, the task running it is
+ * recorded as $!. A result that is text, but not a number, is a success.
+ */
+func (t *Task) record(c, v Cell, d time.Duration) {
+	code := 0
+	if kind(v) != "text" {
+		code = status(v)
+	}
+
+	env0.Add(NewSymbol("$?"), NewStatus(int64(code)))
+	env0.Add(NewSymbol("$last-command"), NewString(t, unparse(List(c))))
+	env0.Add(NewSymbol("$last-duration"), NewFloat(d.Seconds()))
+
+	if _, ok := v.(*Task); ok && IsCons(c) && raw(Car(c)) == "spawn" {
+		env0.Add(NewSymbol("$!"), v)
+	}
+}
+
+/* Release the conduits held by t. */
+func (t *Task) release() {
+	for _, f := range t.held {
+		f()
+	}
+	t.held = nil
+}
+
+/* Return true if the conduit bound to name is a terminal. */
+func (t *Task) terminal(name string) (ok bool) {
+	defer func() {
+		if recover() != nil {
+			ok = false
+		}
+	}()
+
+	return terminal(Resolve(t.Lexical, t.Dynamic, NewSymbol(name)).Get())
+}
+
+/* Terminate the external command, if any, that t is running. */
+func (t *Task) terminate() {
+	if p, r := t.process, t.started; p != nil && r != nil {
+		r.Signal(p, syscall.SIGTERM)
+	}
+}
+
+/*
+ * Returns the first of the regions that is not also on the stack target.
+ * (Used when jumping to a continuation that is not an ancestor of the
+ * current stack).
+ */
+func (t *Task) unshared(regions []Cell, target Cell) Cell {
+	shared := map[Cell]bool{}
+	for s := target; s != Null; s = below(s) {
+		shared[s] = true
+	}
+
+	for _, s := range regions {
+		if !shared[s] {
+			return s
+		}
+	}
+
+	return nil
+}
+
 /* Unbound cell definition. */
 
 type Unbound struct {
@@ -1801,7 +3160,7 @@ func (u *Unbound) Equal(c Cell) bool {
 }
 
 func (u *Unbound) String() string {
-	return fmt.Sprintf("%%unbound %p%%", u)
+	return identify("unbound", u)
 }
 
 /* Unbound-specific functions */
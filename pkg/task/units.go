@@ -0,0 +1,207 @@
+// Released under an MIT-style license. See LICENSE.
+
+package task
+
+import (
+	"fmt"
+	. "github.com/michaelmacinnis/oh/pkg/cell"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+ * The format-bytes command writes a number of bytes in the largest unit in
+ * which it is at least 1:
+ *
+ *     format-bytes n [--precision p] [--si]
+ *
+ * Units are powers of 1024 (KiB, MiB, GiB, TiB, PiB and EiB), or of 1000
+ * (kB, MB, GB, TB, PB and EB) with --si, and the number is rounded to p
+ * digits after the point, 1 by default. The parse-bytes command reads a
+ * size written this way, or with only the first letter of the unit, where
+ * a unit ending in i is a power of 1024, and any other a power of 1000.
+ *
+ * The format-duration command writes a duration, given in seconds or in the
+ * form accepted by sleep, as days, hours, minutes and seconds, for example,
+ * 1d 2h 3m 4s, with the seconds rounded to p digits after the point, 0 by
+ * default. A duration of less than a second is written in milliseconds,
+ * microseconds or nanoseconds. The parse-duration command reads a duration
+ * written this way, or in the form accepted by sleep, and returns it in
+ * seconds. Rather than failing, parse-bytes and parse-duration return false
+ * if the text is not a size or a duration.
+ */
+
+var bytesParams = List(
+	List(NewSymbol("--precision"), Null),
+	NewSymbol("--si"),
+)
+
+var durationParams = List(
+	List(NewSymbol("--precision"), Null),
+)
+
+/* Sizes, as read by parse-bytes. */
+var sizePattern = regexp.MustCompile(`^([0-9]*\.?[0-9]+)\s*([kmgtpe]?)(i?)b?$`)
+
+/* Durations, as read by parse-duration. */
+var spanPattern = regexp.MustCompile(`([0-9]*\.?[0-9]+)\s*(ms|us|µs|ns|[dhms])`)
+
+/* Unit prefixes, from kilo to exa. */
+const prefixes = "kmgtpe"
+
+func formatBytes(args Cell) string {
+	args, values := keywords(bytesParams, args)
+
+	n := toFloat(Car(args))
+
+	precision := 1
+	if p, ok := values["--precision"]; ok {
+		precision = int(p.(Atom).Int())
+	}
+
+	base, suffix := 1024.0, "iB"
+	if _, ok := values["--si"]; ok {
+		base, suffix = 1000.0, "B"
+	}
+
+	sign := ""
+	if n < 0 {
+		sign, n = "-", -n
+	}
+
+	if n < base {
+		return sign + strconv.FormatFloat(n, 'f', -1, 64) + " B"
+	}
+
+	i := 0
+	for n /= base; n >= base && i < len(prefixes)-1; i++ {
+		n /= base
+	}
+
+	prefix := strings.ToUpper(prefixes[i : i+1])
+	if i == 0 && suffix == "B" {
+		prefix = "k"
+	}
+
+	return sign + strconv.FormatFloat(n, 'f', precision, 64) + " " +
+		prefix + suffix
+}
+
+func formatDuration(args Cell) string {
+	args, values := keywords(durationParams, args)
+
+	d := duration(Car(args))
+
+	precision := 0
+	if p, ok := values["--precision"]; ok {
+		precision = int(p.(Atom).Int())
+	}
+
+	sign := ""
+	if d < 0 {
+		sign, d = "-", -d
+	}
+
+	if d < time.Second {
+		return sign + d.String()
+	}
+
+	unit := time.Second
+	for i := 0; i < precision && unit > 1; i++ {
+		unit /= 10
+	}
+	d = d.Round(unit)
+
+	parts := []string{}
+	for _, u := range []struct {
+		d    time.Duration
+		name string
+	}{
+		{24 * time.Hour, "d"},
+		{time.Hour, "h"},
+		{time.Minute, "m"},
+	} {
+		if d >= u.d {
+			parts = append(parts, fmt.Sprintf("%d%s", d/u.d, u.name))
+			d %= u.d
+		}
+	}
+
+	if d > 0 || len(parts) == 0 {
+		s := strconv.FormatFloat(d.Seconds(), 'f', precision, 64)
+		parts = append(parts, s+"s")
+	}
+
+	return sign + strings.Join(parts, " ")
+}
+
+func parseBytes(s string) Cell {
+	m := sizePattern.FindStringSubmatch(strings.ToLower(strings.TrimSpace(s)))
+	if m == nil {
+		return False
+	}
+
+	n, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return False
+	}
+
+	base := 1000.0
+	if m[3] != "" {
+		if m[2] == "" {
+			return False
+		}
+		base = 1024.0
+	}
+
+	if m[2] != "" {
+		n *= math.Pow(base, float64(strings.Index(prefixes, m[2])+1))
+	}
+
+	if n > math.MaxInt64 {
+		return False
+	}
+
+	return NewInteger(int64(math.Round(n)))
+}
+
+func parseDuration(s string) Cell {
+	s = strings.TrimSpace(s)
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return NewFloat(f)
+	}
+
+	sign := 1.0
+	if strings.HasPrefix(s, "-") {
+		sign, s = -1.0, s[1:]
+	}
+
+	units := map[string]float64{
+		"d":  24 * 60 * 60,
+		"h":  60 * 60,
+		"m":  60,
+		"s":  1,
+		"ms": 1e-3,
+		"us": 1e-6,
+		"µs": 1e-6,
+		"ns": 1e-9,
+	}
+
+	total := 0.0
+	rest := spanPattern.ReplaceAllStringFunc(s, func(span string) string {
+		m := spanPattern.FindStringSubmatch(span)
+		n, _ := strconv.ParseFloat(m[1], 64)
+		total += n * units[m[2]]
+
+		return ""
+	})
+
+	if s == "" || strings.TrimSpace(rest) != "" {
+		return False
+	}
+
+	return NewFloat(sign * total)
+}
@@ -3,7 +3,9 @@
 package ui
 
 import (
+	"fmt"
 	"github.com/michaelmacinnis/oh/pkg/cell"
+	"github.com/michaelmacinnis/oh/pkg/common"
 	"github.com/michaelmacinnis/oh/pkg/task"
 	"github.com/peterh/liner"
 	"os"
@@ -12,8 +14,16 @@ import (
 	"strings"
 )
 
+/* Characters after which a new command starts. */
+const separators = "&(:;{|"
+
+/* Characters that must be quoted in a word. */
+const special = " \t\n!\"#%&'(),:;<>@^`{|}"
+
 type cli struct {
 	*liner.State
+	prompt string
+	right  string
 }
 
 var CtrlCPressed error = liner.ErrPromptAborted
@@ -24,7 +34,7 @@ var (
 )
 
 func New(args []string) *cli {
-	if len(args) > 1 {
+	if len(args) > 1 || task.CommandString != "" {
 		return nil
 	}
 
@@ -34,7 +44,7 @@ func New(args []string) *cli {
 		return nil
 	}
 
-	i := &cli{liner.NewLiner()}
+	i := &cli{liner.NewLiner(), "> ", ""}
 
 	if history_path, err := task.GetHistoryFilePath(); err == nil {
 		if f, err := os.Open(history_path); err == nil {
@@ -47,7 +57,7 @@ func New(args []string) *cli {
 
 	i.SetCtrlCAborts(true)
 	i.SetTabCompletionStyle(liner.TabPrints)
-	i.SetWordCompleter(complete)
+	i.SetCompleter(complete)
 
 	return i
 }
@@ -74,7 +84,9 @@ func (i *cli) ReadString(delim byte) (line string, err error) {
 	uncooked.ApplyMode()
 	defer cooked.ApplyMode()
 
-	if line, err = i.State.Prompt("> "); err == nil {
+	i.drawRightPrompt()
+
+	if line, err = i.State.Prompt(i.prompt); err == nil {
 		i.AppendHistory(line)
 		if task.ForegroundTask().Job.Command == "" {
 			task.ForegroundTask().Job.Command = line
@@ -84,31 +96,79 @@ func (i *cli) ReadString(delim byte) (line string, err error) {
 	return
 }
 
+func (i *cli) SetCompleter(f func(string, int) (string, []string, string)) {
+	i.SetWordCompleter(f)
+}
+
+func (i *cli) SetPrompt(prompt string) {
+	i.prompt = prompt
+}
+
+func (i *cli) SetRightPrompt(prompt string) {
+	i.right = prompt
+}
+
+/*
+ * Draw the right-hand prompt at the right edge of the line, if it fits
+ * beside the prompt. The line editor redraws the line, and so erases the
+ * right-hand prompt, whenever the line is edited.
+ */
+func (i *cli) drawRightPrompt() {
+	if i.right == "" {
+		return
+	}
+
+	_, cols := task.TerminalSize()
+
+	col := cols - task.DisplayWidth(i.right) - 1
+	if col <= task.DisplayWidth(i.prompt) {
+		return
+	}
+
+	right := fmt.Sprintf("\r\x1b[%dC%s\r", col, i.right)
+	task.ForegroundTask().Fprint("$stdout", right)
+}
+
+func (i *cli) TerminalMode() (common.TerminalMode, error) {
+	return liner.TerminalMode()
+}
+
 func complete(line string, pos int) (string, []string, string) {
 	head := line[:pos]
 	tail := line[pos:]
 
-	fields := strings.Fields(head)
-
-	if len(fields) == 0 {
+	if strings.TrimSpace(head) == "" {
 		return head, []string{"    "}, tail
 	}
 
-	word := fields[len(fields)-1]
-	if !strings.HasSuffix(head, word) {
+	start, word, quote := lastWord(head)
+	if start == len(head) {
 		return head, []string{}, tail
 	}
 
-	head = head[0 : len(head)-len(word)]
+	head = head[:start]
 
-	completions := task.ForegroundTask().Complete(word)
-	completions = append(completions, files(word)...)
-	if len(fields) == 1 {
-		completions = append(completions, executables(word)...)
+	completions := []string{}
+	if quote == 0 {
+		completions = append(completions,
+			task.ForegroundTask().Complete(word)...)
+
+		if first(head) {
+			completions = append(completions, task.Executables(word)...)
+		} else if strings.HasPrefix(word, "-") {
+			completions = append(completions,
+				task.Flags(command(head), word)...)
+		}
+	}
+
+	if word != "" {
+		for _, f := range files(word) {
+			completions = append(completions, quoted(f, quote))
+		}
 	}
 
 	if len(completions) == 0 {
-		return head, []string{word}, tail
+		return head, []string{line[start:pos]}, tail
 	}
 
 	unique := make(map[string]bool)
@@ -124,56 +184,25 @@ func complete(line string, pos int) (string, []string, string) {
 	return head, completions, tail
 }
 
-func executables(word string) []string {
-	completions := []string{}
-
-	if strings.Contains(word, string(os.PathSeparator)) {
-		return completions
+/* Return the name of the command being typed after head. */
+func command(head string) string {
+	if i := strings.LastIndexAny(head, separators); i >= 0 {
+		head = head[i+1:]
 	}
 
-	pathenv := os.Getenv("PATH")
-	for _, dir := range strings.Split(pathenv, string(os.PathListSeparator)) {
-		if dir == "" {
-			dir = "."
-		} else {
-			dir = path.Clean(dir)
-		}
-
-		stat, err := os.Stat(dir)
-		if err != nil || !stat.IsDir() {
-			continue
-		}
-
-		max := strings.Count(dir, "/") + 1
-		filepath.Walk(dir, func(p string, i os.FileInfo, err error) error {
-			depth := strings.Count(p, "/")
-			if depth > max {
-				if i.IsDir() {
-					return filepath.SkipDir
-				}
-				return nil
-			} else if depth < max {
-				return nil
-			}
-
-			_, basename := filepath.Split(p)
-
-			if strings.HasPrefix(basename, word) {
-				completions = append(completions, basename)
-			}
-
-			return nil
-		})
+	fields := strings.Fields(head)
+	if len(fields) == 0 {
+		return ""
 	}
 
-	return completions
+	return strings.Trim(fields[0], "'\"")
 }
 
 func files(word string) []string {
 	completions := []string{}
 
 	candidate := word
-	if candidate[:1] == "~" {
+	if strings.HasPrefix(candidate, "~") {
 		candidate = filepath.Join(os.Getenv("HOME"), candidate[1:])
 	}
 
@@ -238,3 +267,80 @@ func files(word string) []string {
 
 	return completions
 }
+
+/* Return true if the word after head is the name of a command. */
+func first(head string) bool {
+	head = strings.TrimRight(head, " \t")
+
+	return head == "" || strings.ContainsAny(head[len(head)-1:], separators)
+}
+
+/*
+ * Return the start of the last word in head, the word without quotes, and
+ * the quote, if the word is an unfinished quoted string. If head ends in
+ * whitespace, the start is the end of head.
+ */
+func lastWord(head string) (int, string, byte) {
+	start, quote, word := len(head), byte(0), false
+	for i := 0; i < len(head); i++ {
+		c := head[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == ' ' || c == '\t':
+			start, word = len(head), false
+		default:
+			if !word {
+				start, word = i, true
+			}
+			if c == '"' || c == '\'' {
+				quote = c
+			}
+		}
+	}
+
+	s := head[start:]
+	if quote == 0 || len(s) == 0 || s[0] != quote {
+		return start, s, 0
+	}
+
+	s = s[1:]
+	if quote == '"' {
+		s = strings.NewReplacer(`\\`, `\`, `\"`, `"`).Replace(s)
+	}
+
+	return start, s, quote
+}
+
+/*
+ * Return the file name s quoted, with quote if it is not 0, or if s
+ * contains characters special to oh. The quote is left open after a
+ * directory so that more of its path can be completed.
+ */
+func quoted(s string, quote byte) string {
+	if quote == 0 {
+		if !strings.ContainsAny(s, special) {
+			return s
+		}
+		quote = '\''
+	}
+
+	if quote == '\'' && strings.ContainsRune(s, '\'') {
+		quote = '"'
+	}
+
+	if quote == '"' {
+		s = strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+	}
+
+	q := string(quote)
+	if strings.HasSuffix(s, "/") {
+		return q + s
+	}
+
+	return q + s + q
+}